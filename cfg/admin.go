@@ -0,0 +1,304 @@
+package cfg
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wecisecode/util/mio"
+	"github.com/wecisecode/util/sortedmap"
+	"gopkg.in/ini.v1"
+)
+
+// 配置信息管理接口，挂载到服务的调试端口，如
+//
+//	ah := cfg.NewAdminHandler(cfg.DefaultConfig, nil)
+//	defer ah.Close()
+//	mux.Handle("/debug/config/", http.StripPrefix("/debug/config", ah))
+//
+//	GET /          扁平化后的配置信息，敏感配置值以 ****** 代替
+//	GET /info      Info() 输出的配置信息，敏感配置值以 ****** 代替
+//	GET /sources   各配置项的来源
+//	GET /history   最近的配置变更记录
+//	PUT /          设置配置项，参数 key value，persist=true 时同时通过 AdminOption.Persist 持久化，否则仅在内存中设置
+//	               请求体也可以是 JSON 格式的 {key: value, ...}，大小不超过 AdminOption.MaxBodySize
+//	               多个配置项先一起持久化，持久化成功后才在内存中设置，失败时不设置任何配置项
+//
+// 未设置 AdminOption.Guard 时不支持 PUT
+type AdminOption struct {
+	// 判断 PUT 请求是否允许
+	Guard func(r *http.Request) bool
+	// 持久化一次请求中的所有配置项，出错时应保证没有配置项被持久化
+	Persist func(kvs map[string]string) error
+	// 保留的配置变更记录数，默认100
+	HistorySize int
+	// 敏感配置项名匹配规则，默认匹配 pass secret token 等
+	SecretKeys *regexp.Regexp
+	// PUT 请求体的最大字节数，默认1MB
+	MaxBodySize int64
+}
+
+var defaultSecretKeys = regexp.MustCompile(`(?i)(pass|passwd|password|secret|token|credential|private[_\-]?key|api[_\-]?key)$`)
+
+const redacted = "******"
+
+// 配置变更记录
+type ChangeEvent struct {
+	Time    time.Time               `json:"time"`
+	Added   map[string]string       `json:"added,omitempty"`
+	Removed map[string]string       `json:"removed,omitempty"`
+	Changed map[string]*ValueChange `json:"changed,omitempty"`
+}
+
+// 配置项变更前后的值
+type ValueChange struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// 配置信息管理接口，不再使用时需调用 Close 取消对配置变更的监听
+type AdminHandler struct {
+	cfg      Configure
+	opt      AdminOption
+	mutex    sync.Mutex
+	last     map[string]string
+	history  []*ChangeEvent
+	handleid int64
+}
+
+func NewAdminHandler(c Configure, opt *AdminOption) *AdminHandler {
+	ah := &AdminHandler{cfg: c}
+	if opt != nil {
+		ah.opt = *opt
+	}
+	if ah.opt.HistorySize <= 0 {
+		ah.opt.HistorySize = 100
+	}
+	if ah.opt.SecretKeys == nil {
+		ah.opt.SecretKeys = defaultSecretKeys
+	}
+	if ah.opt.MaxBodySize <= 0 {
+		ah.opt.MaxBodySize = 1 << 20
+	}
+	ah.handleid = c.OnChange(ah.onChange)
+	return ah
+}
+
+// 取消对配置变更的监听
+func (ah *AdminHandler) Close() {
+	ah.cfg.RemoveChangeHandler(ah.handleid)
+}
+
+// 通过请求头 Authorization: Bearer <token> 校验 PUT 请求
+func TokenGuard(token string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		return token != "" && r.Header.Get("Authorization") == "Bearer "+token
+	}
+}
+
+// 将配置项持久化到 INI 文件，配置项名 a.b.c 对应 [a.b] 节中的 c，所有配置项一次写入文件
+func IniFilePersister(filename string) func(kvs map[string]string) error {
+	var mutex sync.Mutex
+	return func(kvs map[string]string) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		bs, err := mio.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		f, err := ini.Load(bs)
+		if err != nil {
+			return err
+		}
+		for key, value := range kvs {
+			section, name := "", key
+			if n := strings.LastIndex(key, "."); n > 0 {
+				section, name = key[:n], key[n+1:]
+			}
+			f.Section(section).Key(name).SetValue(value)
+		}
+		buf := &bytes.Buffer{}
+		if _, err = f.WriteTo(buf); err != nil {
+			return err
+		}
+		return mio.WriteFile(filename, buf.Bytes(), false)
+	}
+}
+
+func (ah *AdminHandler) isSecret(key string, value string) bool {
+	return IsEncryptedValue(value) || ah.opt.SecretKeys.MatchString(key)
+}
+
+// 扁平化配置信息，多个值时取最后一个值，敏感配置值以 ****** 代替
+func (ah *AdminHandler) values() map[string]string {
+	m := map[string]string{}
+	for k, v := range ah.cfg.Map() {
+		var s string
+		if vs, ok := v.([]interface{}); ok {
+			if len(vs) > 0 {
+				s = toString(vs[len(vs)-1])
+			}
+		} else {
+			s = toString(v)
+		}
+		if ah.isSecret(k, s) {
+			s = redacted
+		}
+		m[k] = s
+	}
+	return m
+}
+
+// 变更处理在各自的协程中执行，加锁后再获取当前配置，保证按顺序比较
+func (ah *AdminHandler) onChange() {
+	ah.mutex.Lock()
+	defer ah.mutex.Unlock()
+	values := ah.values()
+	if ah.last != nil {
+		evt := &ChangeEvent{Time: time.Now()}
+		for k, v := range values {
+			if ov, ok := ah.last[k]; !ok {
+				if evt.Added == nil {
+					evt.Added = map[string]string{}
+				}
+				evt.Added[k] = v
+			} else if ov != v {
+				if evt.Changed == nil {
+					evt.Changed = map[string]*ValueChange{}
+				}
+				evt.Changed[k] = &ValueChange{Old: ov, New: v}
+			}
+		}
+		for k, v := range ah.last {
+			if _, ok := values[k]; !ok {
+				if evt.Removed == nil {
+					evt.Removed = map[string]string{}
+				}
+				evt.Removed[k] = v
+			}
+		}
+		if evt.Added != nil || evt.Removed != nil || evt.Changed != nil {
+			ah.history = append(ah.history, evt)
+			if len(ah.history) > ah.opt.HistorySize {
+				ah.history = ah.history[len(ah.history)-ah.opt.HistorySize:]
+			}
+		}
+	}
+	ah.last = values
+}
+
+// 递归处理 Info 输出中的敏感配置值
+func (ah *AdminHandler) redact(key string, v interface{}) interface{} {
+	switch tv := v.(type) {
+	case *sortedmap.LinkedMap:
+		for _, k := range tv.Keys() {
+			tv.Put(k, ah.redact(toString(k), tv.GetValue(k)))
+		}
+	case []interface{}:
+		for i, u := range tv {
+			tv[i] = ah.redact(key, u)
+		}
+	case string:
+		if ah.isSecret(key, tv) {
+			return redacted
+		}
+	}
+	return v
+}
+
+func (ah *AdminHandler) info() interface{} {
+	sm := sortedmap.NewLinkedMap()
+	if err := sortedmap.UnmarshalJSON(sm, []byte(ah.cfg.Info())); err != nil {
+		return err.Error()
+	}
+	return ah.redact("", sm)
+}
+
+func (ah *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+	switch r.Method {
+	case http.MethodGet:
+		switch path {
+		case "":
+			ah.writeJSON(w, http.StatusOK, map[string]interface{}{
+				"time":   ah.cfg.Stamp().Format("2006-01-02 15:04:05.000000000"),
+				"config": ah.values(),
+			})
+		case "info":
+			ah.writeJSON(w, http.StatusOK, ah.info())
+		case "sources":
+			ah.writeJSON(w, http.StatusOK, Sources(ah.cfg))
+		case "history":
+			ah.mutex.Lock()
+			history := append([]*ChangeEvent{}, ah.history...)
+			ah.mutex.Unlock()
+			ah.writeJSON(w, http.StatusOK, history)
+		default:
+			http.NotFound(w, r)
+		}
+	case http.MethodPut:
+		if path != "" {
+			http.NotFound(w, r)
+			return
+		}
+		if ah.opt.Guard == nil || !ah.opt.Guard(r) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		ah.put(w, r)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (ah *AdminHandler) put(w http.ResponseWriter, r *http.Request) {
+	kvs := map[string]string{}
+	if key := r.URL.Query().Get("key"); key != "" {
+		kvs[key] = r.URL.Query().Get("value")
+	} else if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, ah.opt.MaxBodySize)).Decode(&kvs); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(kvs) == 0 {
+		http.Error(w, "key not specified", http.StatusBadRequest)
+		return
+	}
+	persist := r.URL.Query().Get("persist") == "true"
+	if persist && ah.opt.Persist == nil {
+		http.Error(w, "persist not supported", http.StatusBadRequest)
+		return
+	}
+	for k := range kvs {
+		if k == "" {
+			http.Error(w, "key is empty", http.StatusBadRequest)
+			return
+		}
+	}
+	if persist {
+		if err := ah.opt.Persist(kvs); err != nil {
+			ah.cfg.LogError(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	for k, v := range kvs {
+		ah.cfg.Set(k, v)
+	}
+	ah.writeJSON(w, http.StatusOK, map[string]interface{}{"updated": len(kvs)})
+}
+
+func (ah *AdminHandler) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	bs, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(bs)
+}
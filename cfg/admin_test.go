@@ -0,0 +1,100 @@
+package cfg_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	mc "github.com/wecisecode/util/cfg"
+)
+
+func TestAdminHandler(t *testing.T) {
+	cfg := mc.MConfig(&mc.CfgOption{Name: "m:admin", Type: mc.INI_TEXT, Values: []string{"[db]\nhost=a\npass=p\n"}})
+	inifile := filepath.Join(t.TempDir(), "override.ini")
+	h := mc.NewAdminHandler(cfg, &mc.AdminOption{
+		Guard:   mc.TokenGuard("token"),
+		Persist: mc.IniFilePersister(inifile),
+	})
+
+	get := func(path string) string {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		return w.Body.String()
+	}
+	put := func(path string, body string, token string) int {
+		r := httptest.NewRequest(http.MethodPut, path, strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	values := struct{ Config map[string]string }{}
+	assert.Nil(t, json.Unmarshal([]byte(get("/")), &values))
+	assert.Equal(t, "a", values.Config["db.host"])
+	assert.Equal(t, "******", values.Config["db.pass"])
+	assert.NotContains(t, get("/info"), `"p"`)
+	assert.Contains(t, get("/sources"), "m:admin")
+
+	assert.Equal(t, http.StatusForbidden, put("/?key=db.host&value=b", "", ""))
+	assert.Equal(t, http.StatusOK, put("/?key=db.host&value=b", "", "token"))
+	assert.Equal(t, "b", cfg.GetString("db.host"))
+	assert.Equal(t, http.StatusOK, put("/?persist=true", `{"db.port":"3306"}`, "token"))
+	bs, _ := os.ReadFile(inifile)
+	assert.Contains(t, string(bs), "port = 3306")
+
+	time.Sleep(100 * time.Millisecond)
+	history := []*mc.ChangeEvent{}
+	assert.Nil(t, json.Unmarshal([]byte(get("/history")), &history))
+	changed := map[string]*mc.ValueChange{}
+	added := map[string]string{}
+	for _, evt := range history {
+		for k, v := range evt.Changed {
+			changed[k] = v
+		}
+		for k, v := range evt.Added {
+			added[k] = v
+		}
+	}
+	assert.Equal(t, &mc.ValueChange{Old: "a", New: "b"}, changed["db.host"])
+	// 持久化的同时在内存中生效
+	assert.Equal(t, "3306", cfg.GetString("db.port"))
+	assert.Equal(t, "3306", added["db.port"])
+
+	assert.Equal(t, http.StatusBadRequest, put("/", `{"db.x":"`+strings.Repeat("x", 2<<20)+`"}`, "token"))
+}
+
+func TestAdminHandlerPersistFailed(t *testing.T) {
+	cfg := mc.MConfig(&mc.CfgOption{Name: "m:admin", Type: mc.INI_TEXT, Values: []string{"[db]\nhost=a\n"}})
+	h := mc.NewAdminHandler(cfg, &mc.AdminOption{
+		Guard: func(r *http.Request) bool { return true },
+		Persist: func(kvs map[string]string) error {
+			return errors.New("disk full")
+		},
+	})
+	r := httptest.NewRequest(http.MethodPut, "/?persist=true", strings.NewReader(`{"db.host":"b","db.port":"3306"}`))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	// 持久化失败时不设置任何配置项
+	assert.Equal(t, "a", cfg.GetString("db.host"))
+	assert.Equal(t, "", cfg.GetString("db.port"))
+
+	// Close 后不再记录配置变更
+	h.Close()
+	cfg.Set("db.host", "c")
+	time.Sleep(100 * time.Millisecond)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/history", nil))
+	assert.Equal(t, "[]", w.Body.String())
+}
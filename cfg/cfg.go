@@ -88,6 +88,27 @@ func GetJsonETCDCfgOption(filename string) (co *CfgOption) {
 	return
 }
 
+func GetJsonFileCfgOption(filename string) (co *CfgOption) {
+	co = getCfgOptionByKey("m:file:/" + filename)
+	co.Type = JSON_FILE
+	co.Values = []string{filename}
+	return
+}
+
+func GetYamlFileCfgOption(filename string) (co *CfgOption) {
+	co = getCfgOptionByKey("m:file:/" + filename)
+	co.Type = YAML_FILE
+	co.Values = []string{filename}
+	return
+}
+
+func GetYamlETCDCfgOption(filename string) (co *CfgOption) {
+	co = getCfgOptionByKey("m:etcd:/" + filename)
+	co.Type = YAML_ETCD
+	co.Values = []string{filename}
+	return
+}
+
 func getCfgOptionByKey(key string) (co *CfgOption) {
 	cfgOptionsmu.Lock()
 	defer cfgOptionsmu.Unlock()
@@ -132,6 +153,7 @@ type Configure interface {
 	Option() *CfgOption
 	// 通过程序设置改变配置信息
 	Set(key string, value interface{})
+	// Get* 获取的 ENC(...) 形式加密配置值自动解密，参见 SetKeyProvider
 	Get(key string, defaultvalue ...interface{}) interface{}
 	GetMapping(key string, defaultvalue ...map[string]string) (m map[string]string)
 	GetStrings(key string, defaultvalue ...string) []string
@@ -489,6 +511,7 @@ func (mc *mConfig) get(key string, defaultvalue ...interface{}) (v interface{},
 	for _, k := range keys {
 		v, ok = mc.allConfig.Get(k)
 		if ok {
+			v = mc.decrypt(v)
 			return
 		}
 	}
@@ -513,7 +536,7 @@ func (mc *mConfig) GetMapping(key string, defaultvalue ...map[string]string) (m
 			sk := cast.ToString(key)
 			if strings.HasPrefix(sk, k+".") {
 				sk = sk[len(k)+1:]
-				m[sk] = cast.ToString(value)
+				m[sk] = cast.ToString(mc.decrypt(value))
 			}
 			return true
 		})
@@ -863,6 +886,53 @@ func (mc *mConfig) Info() string {
 	return string(bs)
 }
 
+// 通过 Set 设置的配置项在 Sources 中的来源名称
+const SourceSet = "set"
+
+// 可报告配置项来源的 Configure，MConfig 创建的 Configure 均已实现
+type SourceReporter interface {
+	// 各配置项的来源，按合并顺序排列，同名配置项以最后一个来源的值为准
+	// 通过 Set 设置的配置项来源为 SourceSet
+	Sources() map[string][]string
+}
+
+// 各配置项的来源，c 未实现 SourceReporter 时所有配置项的来源均为 c.Name()
+func Sources(c Configure) map[string][]string {
+	if sr, ok := c.(SourceReporter); ok {
+		return sr.Sources()
+	}
+	srcs := map[string][]string{}
+	for _, key := range c.Keys() {
+		srcs[key] = []string{c.Name()}
+	}
+	return srcs
+}
+
+func (mc *mConfig) Sources() map[string][]string {
+	srcs := map[string][]string{}
+	addsrc := func(name string, sm *sortedmap.LinkedMap) {
+		if sm == nil || sm.Len() == 0 {
+			return
+		}
+		fsm := sortedmap.NewLinkedMap()
+		mc.mergeFlatting(fsm, "", sm)
+		fsm.Fetch(func(k, v interface{}) bool {
+			key := cast.ToString(k)
+			srcs[key] = append(srcs[key], name)
+			return true
+		})
+	}
+	addsrc(mc.name, mc.basecfg)
+	mc.mergeConfigure.Fetch(func(k, v interface{}) bool {
+		for key, names := range Sources(v.(Configure)) {
+			srcs[key] = append(srcs[key], names...)
+		}
+		return true
+	})
+	addsrc(SourceSet, mc.setcfg)
+	return srcs
+}
+
 func (mc *mConfig) WithLogger(log ConfLog) Configure {
 	return mc.withLogger(log, true)
 }
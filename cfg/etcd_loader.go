@@ -14,21 +14,26 @@ import (
 )
 
 func getEtcd() (etcd.Client, error) {
+	if cli := etcd.Current(); cli != nil {
+		// 通过 etcd.Set 设置的客户端优先，如 etcd.NewMemClient()
+		return cli, nil
+	}
 	etcdPath := os.Getenv("ETCDPATH")
 	if etcdPath == "" {
 		return nil, merrs.NewError(errors.New("ETCDPATH not set"))
 	}
 	etcdUser := os.Getenv("ETCDUSER")
-	etcdPass := os.Getenv("ETCDPASS")
 	//
-	chcli := make(chan etcd.Client)
-	cherr := make(chan error)
+	chcli := make(chan etcd.Client, 1)
+	cherr := make(chan error, 1)
 	timer := time.NewTimer(3 * time.Second)
 	defer timer.Stop()
 	go func() {
-		cli, err := etcd.NewClient(etcdPath, etcdUser, etcdPass)
+		// 同时支持 ETCDCACERT ETCDCERT ETCDKEY 等 TLS 环境变量
+		cli, err := etcd.New()
 		if err != nil {
 			cherr <- merrs.NewError(err)
+			return
 		}
 		chcli <- cli
 	}()
@@ -44,26 +49,16 @@ func getEtcd() (etcd.Client, error) {
 }
 
 func etcdGet(cli etcd.Client, key string) (*etcd.Node, error) {
-	chnode := make(chan *etcd.Node)
-	cherr := make(chan error)
-	timer := time.NewTimer(10 * time.Second)
-	defer timer.Stop()
-	go func() {
-		node, err := cli.GetNode(key)
-		if err != nil {
-			cherr <- merrs.NewError(err)
-		}
-		chnode <- node
-	}()
-	select {
-	case <-timer.C:
-		err := merrs.NewError(fmt.Errorf("etcd get %s timeout", key))
-		return nil, err
-	case node := <-chnode:
-		return node, nil
-	case err := <-cherr:
-		return nil, err
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	node, err := cli.GetNodeCtx(ctx, key)
+	if etcd.IsNotFound(err) {
+		return &etcd.Node{Key: key}, nil
 	}
+	if err != nil {
+		return nil, merrs.NewError(err)
+	}
+	return node, nil
 }
 
 func (mc *mConfig) watchETCDFiles(cli etcd.Client, parserf CfgParser, etcdfiles []string, chcfginfo chan *CfgInfo, stopped <-chan struct{}) (err error) {
@@ -113,7 +108,9 @@ func (mc *mConfig) watchETCDFiles(cli etcd.Client, parserf CfgParser, etcdfiles
 			}
 			chcfginfo <- &ci
 		}
-		err = func() error {
+		// 已加载的 key，重新同步时用于发现已删除的 key
+		loaded := map[string]struct{}{}
+		load := func() error {
 			node, err := etcdGet(cli, etcdfileprefix)
 			if err != nil {
 				return err
@@ -137,21 +134,44 @@ func (mc *mConfig) watchETCDFiles(cli etcd.Client, parserf CfgParser, etcdfiles
 					fcm[n.Key] = n.Value
 				}
 			}
+			for k := range loaded {
+				if _, ok := fcm[k]; !ok {
+					fcm[k] = ""
+				}
+			}
+			loaded = map[string]struct{}{}
+			for k, v := range fcm {
+				if v != "" {
+					loaded[k] = struct{}{}
+				}
+			}
 			on_change(fcm)
 			return nil
-		}()
-		if err != nil {
-			return err
 		}
+		// 先开始监听，避免错过加载过程中的修改
 		ctx, cancel := context.WithCancel(context.Background())
 		ch := cli.Watch(ctx, etcdfileprefix, true)
+		if err = load(); err != nil {
+			cancel()
+			return err
+		}
 		go func() {
 			mc.log.Debug("start watching", watchinfo)
 			defer mc.log.Debug("stop watching", watchinfo)
 			for {
 				select {
-				case evt := <-ch:
-					if etcdfilematcher != nil && !etcdfilematcher.MatchString(evt.Node.Key) {
+				case evt, ok := <-ch:
+					if !ok {
+						cancel()
+						return
+					}
+					if evt.Action == etcd.ActionResync {
+						// 监听历史已被压缩，可能错过了修改，重新加载
+						mc.log.Warn("resync", watchinfo, "at revision", evt.Revision)
+						if err := load(); err != nil {
+							mc.log.Error("resync", watchinfo, "error", err)
+						}
+					} else if etcdfilematcher != nil && !etcdfilematcher.MatchString(evt.Node.Key) {
 						mc.log.Debug("ignore not match ETCD Path:", evt.Node.Key, "Action:", evt.Action)
 					} else if evt.Action == etcd.ActionPut {
 						mc.log.Debug(evt.Node.Key, "changed")
@@ -0,0 +1,30 @@
+package cfg_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	mc "github.com/wecisecode/util/cfg"
+	"github.com/wecisecode/util/etcd"
+)
+
+func TestETCDLoader(t *testing.T) {
+	cli := etcd.NewMemClient()
+	etcd.Set(cli)
+	defer etcd.Set(nil)
+	defer cli.Close()
+
+	// 配置选项全局缓存，每次使用不同的 key
+	key := fmt.Sprint("/test/cfg/", time.Now().UnixNano(), ".ini")
+	assert.Nil(t, cli.Put(key, "[db]\nhost=a\n"))
+	cfg := mc.MConfig(mc.GetIniETCDCfgOption(key))
+	assert.Equal(t, "a", cfg.GetString("db.host"))
+
+	assert.Nil(t, cli.Put(key, "[db]\nhost=b\n"))
+	for i := 0; i < 100 && cfg.GetString("db.host") != "b"; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, "b", cfg.GetString("db.host"))
+}
@@ -0,0 +1,118 @@
+package cfg
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/wecisecode/util/cast"
+	"github.com/wecisecode/util/merrs"
+	"github.com/wecisecode/util/mfmt"
+	"gopkg.in/yaml.v3"
+)
+
+// 配置项校验规则
+//
+//	type 支持 string int float bool duration bytes，默认 string
+//	pattern 为正则表达式，匹配配置值的字符串形式
+//	enum 为可选值列表
+type SchemaItem struct {
+	Type     string   `json:"type,omitempty" yaml:"type,omitempty"`
+	Required bool     `json:"required,omitempty" yaml:"required,omitempty"`
+	Pattern  string   `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+	Enum     []string `json:"enum,omitempty" yaml:"enum,omitempty"`
+}
+
+// 配置校验规则，扁平化后的配置项名 -> 校验规则
+type Schema map[string]*SchemaItem
+
+// 解析 JSON 或 YAML 格式的配置校验规则
+func ParseSchema(bs []byte) (Schema, error) {
+	schema := Schema{}
+	err := yaml.Unmarshal(bs, &schema)
+	if err != nil {
+		return nil, merrs.ErrParser.New(err)
+	}
+	return schema, nil
+}
+
+// 校验配置信息，strict 为 true 时未定义校验规则的配置项也视为错误
+func (schema Schema) Validate(cfg Configure, strict bool) (errs []error) {
+	keys := make([]string, 0, len(schema))
+	for key := range schema {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	values := cfg.Map()
+	for _, key := range keys {
+		item := schema[key]
+		if item == nil {
+			continue
+		}
+		if _, ok := values[key]; !ok {
+			if item.Required {
+				errs = append(errs, merrs.ErrValid.New("config %s is required", key))
+			}
+			continue
+		}
+		if err := item.validate(key, cfg.GetString(key)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if strict {
+		for _, key := range cfg.Keys() {
+			if _, ok := schema[key]; !ok {
+				errs = append(errs, merrs.ErrValid.New("config %s is not defined in schema", key))
+			}
+		}
+	}
+	return
+}
+
+var regxNumber = regexp.MustCompile(`^\s*-?\d`)
+
+func (item *SchemaItem) validate(key string, value string) error {
+	switch strings.ToLower(item.Type) {
+	case "", "string":
+	case "int":
+		if _, err := cast.ToInt64E(strings.TrimSpace(value)); err != nil {
+			return merrs.ErrValid.New("config %s=%s is not an int", key, value)
+		}
+	case "float":
+		if _, err := cast.ToFloat64E(strings.TrimSpace(value)); err != nil {
+			return merrs.ErrValid.New("config %s=%s is not a float", key, value)
+		}
+	case "bool":
+		if _, err := cast.ToBoolE(strings.TrimSpace(value)); err != nil {
+			return merrs.ErrValid.New("config %s=%s is not a bool", key, value)
+		}
+	case "duration":
+		if !regxNumber.MatchString(value) || mfmt.ParseDuration(value) == 0 && strings.Trim(value, " 0") != "" {
+			return merrs.ErrValid.New("config %s=%s is not a duration", key, value)
+		}
+	case "bytes":
+		if !regxNumber.MatchString(value) || mfmt.ParseBytesCount(value) == 0 && strings.Trim(value, " 0") != "" {
+			return merrs.ErrValid.New("config %s=%s is not a bytes count", key, value)
+		}
+	default:
+		return merrs.ErrValid.New("config %s schema type %s unsupported", key, item.Type)
+	}
+	if item.Pattern != "" {
+		regx, err := regexp.Compile(item.Pattern)
+		if err != nil {
+			return merrs.ErrValid.New("config %s schema pattern error: %v", key, err)
+		}
+		if !regx.MatchString(value) {
+			return merrs.ErrValid.New("config %s=%s not match %s", key, value, item.Pattern)
+		}
+	}
+	if len(item.Enum) > 0 {
+		for _, e := range item.Enum {
+			if e == value {
+				return nil
+			}
+		}
+		return merrs.ErrValid.New("config %s=%s not in %v", key, value, item.Enum)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package cfg_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	mc "github.com/wecisecode/util/cfg"
+)
+
+func TestSourcesAndSchema(t *testing.T) {
+	a := &mc.CfgOption{Name: "m:a", Type: mc.INI_TEXT, Values: []string{"[db]\nhost=a\nport=1\n"}}
+	b := &mc.CfgOption{Name: "m:b", Type: mc.JSON_TEXT, Values: []string{`{"db":{"host":"b","user":"u"}}`}}
+	cfg := mc.MConfig(a, b)
+	cfg.Set("db.port", "x")
+
+	srcs := mc.Sources(cfg)
+	assert.Equal(t, []string{"m:a", "m:b"}, srcs["db.host"])
+	assert.Equal(t, []string{"m:a", mc.SourceSet}, srcs["db.port"])
+	assert.Equal(t, []string{"m:b"}, srcs["db.user"])
+
+	schema, err := mc.ParseSchema([]byte(`
+db.host: {enum: [a, b]}
+db.port: {type: int}
+db.pass: {required: true}
+`))
+	assert.Nil(t, err)
+	errs := schema.Validate(cfg, false)
+	assert.Equal(t, 2, len(errs))
+	errs = schema.Validate(cfg, true)
+	assert.Equal(t, 3, len(errs))
+}
+
+type plainConfigure struct {
+	mc.Configure
+}
+
+func TestSourcesFallback(t *testing.T) {
+	a := &mc.CfgOption{Name: "m:a", Type: mc.INI_TEXT, Values: []string{"[db]\nhost=a\n"}}
+	cfg := plainConfigure{mc.MConfig(a)}
+	_, ok := interface{}(cfg).(mc.SourceReporter)
+	assert.False(t, ok)
+	assert.Equal(t, []string{cfg.Name()}, mc.Sources(cfg)["db.host"])
+}
+
+func TestSchemaPatternError(t *testing.T) {
+	a := &mc.CfgOption{Name: "m:a", Type: mc.INI_TEXT, Values: []string{"[db]\nhost=a\n"}}
+	schema, err := mc.ParseSchema([]byte(`db.host: {pattern: "a("}`))
+	assert.Nil(t, err)
+	errs := schema.Validate(mc.MConfig(a), false)
+	if assert.Equal(t, 1, len(errs)) {
+		assert.Contains(t, errs[0].Error(), "schema pattern error: error parsing regexp")
+	}
+}
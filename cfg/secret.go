@@ -0,0 +1,183 @@
+package cfg
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/wecisecode/util/cmap"
+	"github.com/wecisecode/util/crypto"
+	"github.com/wecisecode/util/merrs"
+)
+
+// 加密配置信息
+// 配置值以 ENC(密文) 或 ENC(keyid:密文) 的形式保存时，通过 Get* 获取配置信息时自动解密
+// 密文通过 crypto.AesEncrypt 生成，可以使用 cmd/cfgencrypt 命令行工具或 EncryptValue 函数生成
+// 解密密钥由 KeyProvider 提供，默认从环境变量 MCONFIG_KEY 获取
+
+// 根据 keyid 获取密钥，keyid 为空表示默认密钥
+// 密钥长度必须为16, 24或者32
+type KeyProvider func(keyid string) (key string, err error)
+
+const DefaultKeyEnv = "MCONFIG_KEY"
+
+var encryptedValueRegexp = regexp.MustCompile(`^ENC\((?:([\w\-\.]+):)?([A-Za-z0-9\+/=]+)\)$`)
+
+// 从环境变量获取密钥，指定 keyid 时环境变量名为 envname_keyid
+func EnvKeyProvider(envname string) KeyProvider {
+	return func(keyid string) (string, error) {
+		name := envname
+		if keyid != "" {
+			name = envname + "_" + strings.ToUpper(keyid)
+		}
+		key := os.Getenv(name)
+		if key == "" {
+			return "", merrs.NewError(fmt.Errorf("encrypt key environment variable %s not set", name))
+		}
+		return key, nil
+	}
+}
+
+// 从文件获取密钥，忽略首尾空白字符，指定 keyid 时文件名为 filename.keyid
+func FileKeyProvider(filename string) KeyProvider {
+	return func(keyid string) (string, error) {
+		fn := filename
+		if keyid != "" {
+			fn = filename + "." + keyid
+		}
+		bs, err := os.ReadFile(fn)
+		if err != nil {
+			return "", merrs.NewError(err)
+		}
+		return strings.TrimSpace(string(bs)), nil
+	}
+}
+
+// 本地 KMS 替身，密钥保存在 dir 目录下的 keyid.key 文件中，keyid 为空时使用 default.key
+func LocalKMSKeyProvider(dir string) KeyProvider {
+	return func(keyid string) (string, error) {
+		if keyid == "" {
+			keyid = "default"
+		}
+		return FileKeyProvider(filepath.Join(dir, keyid+".key"))("")
+	}
+}
+
+// 固定密钥，主要用于测试
+func StaticKeyProvider(key string) KeyProvider {
+	return func(keyid string) (string, error) {
+		return key, nil
+	}
+}
+
+var keyProviderMutex sync.RWMutex
+var keyProvider = EnvKeyProvider(DefaultKeyEnv)
+
+// 已解密配置值缓存，密文 -> 明文
+var decryptedValues = cmap.New[string, string]()
+
+// 设置密钥提供者，同时清除已解密配置值缓存
+func SetKeyProvider(kp KeyProvider) {
+	keyProviderMutex.Lock()
+	defer keyProviderMutex.Unlock()
+	if kp == nil {
+		kp = EnvKeyProvider(DefaultKeyEnv)
+	}
+	keyProvider = kp
+	decryptedValues.Clear()
+}
+
+func getKey(keyid string) (string, error) {
+	keyProviderMutex.RLock()
+	kp := keyProvider
+	keyProviderMutex.RUnlock()
+	return kp(keyid)
+}
+
+// 判断配置值是否为 ENC(...) 形式的加密值
+func IsEncryptedValue(value string) bool {
+	return encryptedValueRegexp.MatchString(value)
+}
+
+// 加密配置值，返回 ENC(密文) 或 ENC(keyid:密文)
+func EncryptValue(plain string, keyid string) (string, error) {
+	key, err := getKey(keyid)
+	if err != nil {
+		return "", err
+	}
+	crypted, err := crypto.AesEncryptE(plain, key)
+	if err != nil {
+		return "", merrs.NewError(err)
+	}
+	if keyid != "" {
+		return "ENC(" + keyid + ":" + crypted + ")", nil
+	}
+	return "ENC(" + crypted + ")", nil
+}
+
+// 解密配置值，非加密值原样返回
+func DecryptValue(value string) (string, error) {
+	ms := encryptedValueRegexp.FindStringSubmatch(value)
+	if ms == nil {
+		return value, nil
+	}
+	if plain, ok := decryptedValues.Get(value); ok {
+		return plain, nil
+	}
+	key, err := getKey(ms[1])
+	if err != nil {
+		return value, err
+	}
+	plain, err := crypto.AesDecryptE(ms[2], key)
+	if err != nil {
+		return value, merrs.NewError(errors.New("decrypt config value failed"), err)
+	}
+	decryptedValues.Set(value, plain)
+	return plain, nil
+}
+
+// 解密 Get* 获取的配置值，解密失败时记录错误并返回原值
+func (mc *mConfig) decrypt(v interface{}) interface{} {
+	switch tv := v.(type) {
+	case string:
+		if !IsEncryptedValue(tv) {
+			return tv
+		}
+		s, err := DecryptValue(tv)
+		if err != nil {
+			mc.log.Error(mc.name, err)
+		}
+		return s
+	case []interface{}:
+		var nv []interface{}
+		for i, u := range tv {
+			if s, ok := u.(string); ok && IsEncryptedValue(s) {
+				if nv == nil {
+					nv = append([]interface{}{}, tv...)
+				}
+				nv[i] = mc.decrypt(s)
+			}
+		}
+		if nv != nil {
+			return nv
+		}
+	case []string:
+		var nv []string
+		for i, s := range tv {
+			if IsEncryptedValue(s) {
+				if nv == nil {
+					nv = append([]string{}, tv...)
+				}
+				nv[i] = mc.decrypt(s).(string)
+			}
+		}
+		if nv != nil {
+			return nv
+		}
+	}
+	return v
+}
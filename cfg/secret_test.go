@@ -0,0 +1,45 @@
+package cfg_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	mc "github.com/wecisecode/util/cfg"
+)
+
+func TestEncryptedValue(t *testing.T) {
+	mc.SetKeyProvider(mc.StaticKeyProvider("0123456789abcdef"))
+	defer mc.SetKeyProvider(nil)
+
+	enc, err := mc.EncryptValue("secret", "")
+	assert.Nil(t, err)
+	assert.True(t, mc.IsEncryptedValue(enc))
+
+	cfg := mc.MConfig(&mc.CfgOption{Name: "m:secret", Type: mc.INI_TEXT, Values: []string{`
+[db]
+user=root
+pass=` + enc + `
+`}})
+	assert.Equal(t, "root", cfg.GetString("db.user"))
+	assert.Equal(t, "secret", cfg.GetString("db.pass"))
+	assert.Equal(t, enc, cfg.Map()["db.pass"].([]interface{})[0])
+}
+
+func TestLocalKMSKeyProvider(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "db.key"), []byte("0123456789abcdef0123456789abcdef\n"), 0600))
+	mc.SetKeyProvider(mc.LocalKMSKeyProvider(dir))
+	defer mc.SetKeyProvider(nil)
+
+	enc, err := mc.EncryptValue("secret", "db")
+	assert.Nil(t, err)
+	assert.Regexp(t, `^ENC\(db:.+\)$`, enc)
+	plain, err := mc.DecryptValue(enc)
+	assert.Nil(t, err)
+	assert.Equal(t, "secret", plain)
+
+	_, err = mc.EncryptValue("secret", "nokey")
+	assert.NotNil(t, err)
+}
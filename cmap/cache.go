@@ -0,0 +1,510 @@
+package cmap
+
+import (
+	"container/heap"
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wecisecode/util/merrs"
+)
+
+// 淘汰策略
+type EvictPolicy int
+
+const (
+	LRU EvictPolicy = iota // 最近最少使用
+	LFU                    // 最不经常使用，使用次数相同时淘汰最久未使用的
+)
+
+// 淘汰原因
+type EvictReason int
+
+const (
+	EvictExpired  EvictReason = iota // 过期
+	EvictCapacity                    // 超过最大条目数或最大权重
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictExpired:
+		return "expired"
+	case EvictCapacity:
+		return "capacity"
+	}
+	return "unknown"
+}
+
+type CacheOption[K comparable, V any] struct {
+	// 默认过期时间，0 表示不过期
+	TTL time.Duration
+	// 最大条目数，0 表示不限制，按碎片平均分配
+	MaxEntries int
+	// 最大权重，0 表示不限制，按碎片平均分配
+	MaxWeight int64
+	// 条目权重，默认为 1
+	Weigher func(key K, value V) int64
+	Policy  EvictPolicy
+	// 条目过期或因容量被淘汰时调用，Remove Clear 不调用
+	OnEvict func(key K, value V, reason EvictReason)
+	// 碎片数，默认为 SHARD_COUNT
+	Shards int
+	// 选择碎片的哈希函数，默认使用 fnv32，参见 NewWithHasher
+	Hasher func(K) uint64
+	// 定期清理过期条目的间隔，0 表示只在访问时清理，大于 0 时需调用 Close 停止清理
+	CleanupInterval time.Duration
+}
+
+// 命中统计
+type CacheStats struct {
+	Hits        int64
+	Misses      int64
+	Loads       int64 // GetWithNew 调用新建函数次数
+	LoadErrors  int64
+	Evictions   int64 // 因容量淘汰
+	Expirations int64 // 过期淘汰
+}
+
+func (s CacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// 支持过期时间及容量限制的并发缓存，每个碎片独立按 LRU 或 LFU 淘汰
+type Cache[K comparable, V any] struct {
+	shards []*cacheShard[K, V]
+	option CacheOption[K, V]
+
+	hits        atomic.Int64
+	misses      atomic.Int64
+	loads       atomic.Int64
+	loaderrors  atomic.Int64
+	evictions   atomic.Int64
+	expirations atomic.Int64
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+type cacheEntry[K comparable, V any] struct {
+	key    K
+	value  V
+	expire time.Time
+	weight int64
+	// LRU
+	elem *list.Element
+	// LFU
+	freq  int64
+	tick  uint64
+	index int
+}
+
+type cacheShard[K comparable, V any] struct {
+	mutex      sync.Mutex
+	items      map[K]*cacheEntry[K, V]
+	policy     EvictPolicy
+	lru        *list.List
+	lfu        lfuHeap[K, V]
+	tick       uint64
+	weight     int64
+	maxEntries int
+	maxWeight  int64
+	calls      map[K]*call[V]
+}
+
+type evicted[K comparable, V any] struct {
+	entry  *cacheEntry[K, V]
+	reason EvictReason
+}
+
+func NewCache[K comparable, V any](opt *CacheOption[K, V]) *Cache[K, V] {
+	c := &Cache[K, V]{stop: make(chan struct{})}
+	if opt != nil {
+		c.option = *opt
+	}
+	n := c.option.Shards
+	if n <= 0 {
+		n = SHARD_COUNT
+	}
+	c.shards = make([]*cacheShard[K, V], n)
+	for i := range c.shards {
+		s := &cacheShard[K, V]{
+			items:  map[K]*cacheEntry[K, V]{},
+			policy: c.option.Policy,
+			lru:    list.New(),
+		}
+		if c.option.MaxEntries > 0 {
+			s.maxEntries = (c.option.MaxEntries + n - 1) / n
+		}
+		if c.option.MaxWeight > 0 {
+			s.maxWeight = (c.option.MaxWeight + int64(n) - 1) / int64(n)
+		}
+		c.shards[i] = s
+	}
+	if c.option.CleanupInterval > 0 {
+		go c.cleanup()
+	}
+	return c
+}
+
+func (c *Cache[K, V]) getShard(key K) *cacheShard[K, V] {
+	if len(c.shards) == 1 {
+		return c.shards[0]
+	}
+	if c.option.Hasher != nil {
+		return c.shards[c.option.Hasher(key)%uint64(len(c.shards))]
+	}
+	return c.shards[uint(fnv32(key))%uint(len(c.shards))]
+}
+
+func (c *Cache[K, V]) cleanup() {
+	ticker := time.NewTicker(c.option.CleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.Cleanup()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// 停止定期清理
+func (c *Cache[K, V]) Close() {
+	c.stopOnce.Do(func() {
+		close(c.stop)
+	})
+}
+
+// 清理所有过期条目
+func (c *Cache[K, V]) Cleanup() {
+	now := time.Now()
+	for _, s := range c.shards {
+		var evs []evicted[K, V]
+		s.mutex.Lock()
+		for _, e := range s.items {
+			if e.expired(now) {
+				s.unlink(e)
+				evs = append(evs, evicted[K, V]{e, EvictExpired})
+			}
+		}
+		s.mutex.Unlock()
+		c.notify(evs)
+	}
+}
+
+func (c *Cache[K, V]) notify(evs []evicted[K, V]) {
+	for _, ev := range evs {
+		if ev.reason == EvictExpired {
+			c.expirations.Add(1)
+		} else {
+			c.evictions.Add(1)
+		}
+		if c.option.OnEvict != nil {
+			c.option.OnEvict(ev.entry.key, ev.entry.value, ev.reason)
+		}
+	}
+}
+
+// 以默认过期时间设置
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.SetWithTTL(key, value, c.option.TTL)
+}
+
+// ttl 为 0 表示不过期
+func (c *Cache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	s := c.getShard(key)
+	s.mutex.Lock()
+	evs := c.set(s, key, value, ttl)
+	s.mutex.Unlock()
+	c.notify(evs)
+}
+
+// 调用前需持有 s.mutex
+func (c *Cache[K, V]) set(s *cacheShard[K, V], key K, value V, ttl time.Duration) []evicted[K, V] {
+	var expire time.Time
+	if ttl > 0 {
+		expire = time.Now().Add(ttl)
+	}
+	weight := int64(1)
+	if c.option.Weigher != nil {
+		weight = c.option.Weigher(key, value)
+	}
+	if e, ok := s.items[key]; ok {
+		s.weight += weight - e.weight
+		e.value, e.expire, e.weight = value, expire, weight
+		s.touch(e)
+	} else {
+		e = &cacheEntry[K, V]{key: key, value: value, expire: expire, weight: weight}
+		s.items[key] = e
+		s.weight += weight
+		// 先淘汰已有条目再加入新条目，避免 LFU 时新条目被立即淘汰
+		evs := s.evict()
+		s.add(e)
+		return evs
+	}
+	return s.evict()
+}
+
+func (c *Cache[K, V]) Get(key K) (v V, ok bool) {
+	s := c.getShard(key)
+	s.mutex.Lock()
+	v, ok, evs := s.get(key)
+	s.mutex.Unlock()
+	c.notify(evs)
+	if ok {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+	return
+}
+
+// 不存在时调用新建函数，新建成功后以默认过期时间保存
+// 同一 key 并发调用时只执行一次新建函数，其它调用等待并返回相同结果
+// 新建过程中 key 被 Set 等操作写入时，不覆盖已写入的值，返回已写入的值
+func (c *Cache[K, V]) GetWithNew(key K, new_value_func func() (V, error)) (v V, err error) {
+	s := c.getShard(key)
+	s.mutex.Lock()
+	v, ok, evs := s.get(key)
+	if ok {
+		s.mutex.Unlock()
+		c.hits.Add(1)
+		return
+	}
+	c.misses.Add(1)
+	if cl, ok := s.calls[key]; ok {
+		s.mutex.Unlock()
+		c.notify(evs)
+		<-cl.done
+		return cl.value, cl.err
+	}
+	cl := &call[V]{done: make(chan struct{})}
+	if s.calls == nil {
+		s.calls = map[K]*call[V]{}
+	}
+	s.calls[key] = cl
+	s.mutex.Unlock()
+	c.notify(evs)
+	c.loads.Add(1)
+	normal := false
+	defer func() {
+		if !normal {
+			// 新建函数 panic，等待的调用返回错误
+			cl.err = merrs.NewError("new value function of key %v panic", key)
+		}
+		var evs []evicted[K, V]
+		loaderr := cl.err
+		s.mutex.Lock()
+		if e, ok := s.items[key]; ok && !e.expired(time.Now()) {
+			cl.value, cl.err = e.value, nil
+		} else if cl.err == nil {
+			evs = c.set(s, key, cl.value, c.option.TTL)
+		}
+		delete(s.calls, key)
+		s.mutex.Unlock()
+		close(cl.done)
+		if loaderr != nil {
+			c.loaderrors.Add(1)
+		}
+		c.notify(evs)
+		v, err = cl.value, cl.err
+	}()
+	cl.value, cl.err = new_value_func()
+	normal = true
+	return
+}
+
+// 是否存在且未过期，不影响淘汰顺序
+func (c *Cache[K, V]) Has(key K) bool {
+	s := c.getShard(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	e, ok := s.items[key]
+	return ok && !e.expired(time.Now())
+}
+
+func (c *Cache[K, V]) Remove(key K) (v V, ok bool) {
+	s := c.getShard(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	e, ok := s.items[key]
+	if !ok {
+		return
+	}
+	s.unlink(e)
+	if e.expired(time.Now()) {
+		return v, false
+	}
+	return e.value, true
+}
+
+// 条目数，包括尚未清理的过期条目
+func (c *Cache[K, V]) Len() int {
+	n := 0
+	for _, s := range c.shards {
+		s.mutex.Lock()
+		n += len(s.items)
+		s.mutex.Unlock()
+	}
+	return n
+}
+
+// 总权重
+func (c *Cache[K, V]) Weight() int64 {
+	w := int64(0)
+	for _, s := range c.shards {
+		s.mutex.Lock()
+		w += s.weight
+		s.mutex.Unlock()
+	}
+	return w
+}
+
+// 未过期的 key
+func (c *Cache[K, V]) Keys() []K {
+	now := time.Now()
+	keys := []K{}
+	for _, s := range c.shards {
+		s.mutex.Lock()
+		for k, e := range s.items {
+			if !e.expired(now) {
+				keys = append(keys, k)
+			}
+		}
+		s.mutex.Unlock()
+	}
+	return keys
+}
+
+func (c *Cache[K, V]) Clear() {
+	for _, s := range c.shards {
+		s.mutex.Lock()
+		s.items = map[K]*cacheEntry[K, V]{}
+		s.lru.Init()
+		s.lfu = nil
+		s.weight = 0
+		s.mutex.Unlock()
+	}
+}
+
+func (c *Cache[K, V]) Stats() CacheStats {
+	return CacheStats{
+		Hits:        c.hits.Load(),
+		Misses:      c.misses.Load(),
+		Loads:       c.loads.Load(),
+		LoadErrors:  c.loaderrors.Load(),
+		Evictions:   c.evictions.Load(),
+		Expirations: c.expirations.Load(),
+	}
+}
+
+func (e *cacheEntry[K, V]) expired(now time.Time) bool {
+	return !e.expire.IsZero() && now.After(e.expire)
+}
+
+// 以下方法调用前需持有 s.mutex
+
+func (s *cacheShard[K, V]) get(key K) (v V, ok bool, evs []evicted[K, V]) {
+	e, ok := s.items[key]
+	if !ok {
+		return
+	}
+	if e.expired(time.Now()) {
+		s.unlink(e)
+		return v, false, []evicted[K, V]{{e, EvictExpired}}
+	}
+	s.touch(e)
+	return e.value, true, nil
+}
+
+func (s *cacheShard[K, V]) add(e *cacheEntry[K, V]) {
+	if s.policy == LFU {
+		s.tick++
+		e.freq, e.tick = 1, s.tick
+		heap.Push(&s.lfu, e)
+	} else {
+		e.elem = s.lru.PushFront(e)
+	}
+}
+
+func (s *cacheShard[K, V]) touch(e *cacheEntry[K, V]) {
+	if s.policy == LFU {
+		s.tick++
+		e.freq, e.tick = e.freq+1, s.tick
+		heap.Fix(&s.lfu, e.index)
+	} else {
+		s.lru.MoveToFront(e.elem)
+	}
+}
+
+func (s *cacheShard[K, V]) unlink(e *cacheEntry[K, V]) {
+	if s.policy == LFU {
+		heap.Remove(&s.lfu, e.index)
+	} else {
+		s.lru.Remove(e.elem)
+	}
+	delete(s.items, e.key)
+	s.weight -= e.weight
+}
+
+func (s *cacheShard[K, V]) victim() *cacheEntry[K, V] {
+	if s.policy == LFU {
+		if len(s.lfu) == 0 {
+			return nil
+		}
+		return s.lfu[0]
+	}
+	if elem := s.lru.Back(); elem != nil {
+		return elem.Value.(*cacheEntry[K, V])
+	}
+	return nil
+}
+
+func (s *cacheShard[K, V]) evict() (evs []evicted[K, V]) {
+	for s.maxEntries > 0 && len(s.items) > s.maxEntries || s.maxWeight > 0 && s.weight > s.maxWeight {
+		e := s.victim()
+		if e == nil {
+			break
+		}
+		s.unlink(e)
+		evs = append(evs, evicted[K, V]{e, EvictCapacity})
+	}
+	return
+}
+
+type lfuHeap[K comparable, V any] []*cacheEntry[K, V]
+
+func (h lfuHeap[K, V]) Len() int { return len(h) }
+
+func (h lfuHeap[K, V]) Less(i, j int) bool {
+	if h[i].freq != h[j].freq {
+		return h[i].freq < h[j].freq
+	}
+	return h[i].tick < h[j].tick
+}
+
+func (h lfuHeap[K, V]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap[K, V]) Push(x any) {
+	e := x.(*cacheEntry[K, V])
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *lfuHeap[K, V]) Pop() any {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return e
+}
@@ -0,0 +1,140 @@
+package cmap_test
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wecisecode/util/cmap"
+)
+
+func TestCacheEvict(t *testing.T) {
+	evicted := []string{}
+	onEvict := func(key string, value int, reason cmap.EvictReason) {
+		evicted = append(evicted, key+":"+reason.String())
+	}
+
+	lru := cmap.NewCache(&cmap.CacheOption[string, int]{MaxEntries: 2, Shards: 1, OnEvict: onEvict})
+	lru.Set("a", 1)
+	lru.Set("b", 2)
+	lru.Get("a")
+	lru.Set("c", 3)
+	assert.False(t, lru.Has("b"))
+	assert.True(t, lru.Has("a"))
+	assert.Equal(t, []string{"b:capacity"}, evicted)
+
+	evicted = evicted[:0]
+	lfu := cmap.NewCache(&cmap.CacheOption[string, int]{MaxEntries: 2, Shards: 1, Policy: cmap.LFU, OnEvict: onEvict})
+	lfu.Set("a", 1)
+	lfu.Set("b", 2)
+	lfu.Get("a")
+	lfu.Get("a")
+	lfu.Get("b")
+	lfu.Set("c", 3)
+	lfu.Set("d", 4)
+	assert.Equal(t, []string{"b:capacity", "c:capacity"}, evicted)
+	assert.True(t, lfu.Has("a"))
+
+	evicted = evicted[:0]
+	weighted := cmap.NewCache(&cmap.CacheOption[string, int]{MaxWeight: 10, Shards: 1, OnEvict: onEvict,
+		Weigher: func(key string, value int) int64 { return int64(value) }})
+	weighted.Set("a", 4)
+	weighted.Set("b", 4)
+	weighted.Set("c", 4)
+	assert.Equal(t, int64(8), weighted.Weight())
+	assert.Equal(t, []string{"a:capacity"}, evicted)
+
+	evicted = evicted[:0]
+	ttl := cmap.NewCache(&cmap.CacheOption[string, int]{TTL: 10 * time.Millisecond, OnEvict: onEvict})
+	ttl.Set("a", 1)
+	ttl.SetWithTTL("b", 2, 0)
+	time.Sleep(20 * time.Millisecond)
+	_, ok := ttl.Get("a")
+	assert.False(t, ok)
+	v, ok := ttl.Get("b")
+	assert.True(t, ok)
+	assert.Equal(t, 2, v)
+	assert.Equal(t, []string{"a:expired"}, evicted)
+	stats := ttl.Stats()
+	assert.Equal(t, int64(1), stats.Hits)
+	assert.Equal(t, int64(1), stats.Misses)
+	assert.Equal(t, int64(1), stats.Expirations)
+	assert.Equal(t, 0.5, stats.HitRate())
+}
+
+func TestCacheGetWithNew(t *testing.T) {
+	c := cmap.NewCache[string, int](nil)
+	m := cmap.New[string, int]()
+	for _, getWithNew := range []func(string, func() (int, error)) (int, error){c.GetWithNew, m.GetWithNew} {
+		var loads atomic.Int32
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				v, err := getWithNew("k", func() (int, error) {
+					loads.Add(1)
+					time.Sleep(10 * time.Millisecond)
+					return 1, nil
+				})
+				assert.Nil(t, err)
+				assert.Equal(t, 1, v)
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int32(1), loads.Load())
+
+		_, err := getWithNew("e", func() (int, error) { return 0, errors.New("load error") })
+		assert.NotNil(t, err)
+		v, err := getWithNew("e", func() (int, error) { return 2, nil })
+		assert.Nil(t, err)
+		assert.Equal(t, 2, v)
+	}
+	assert.Equal(t, int64(3), c.Stats().Loads)
+	assert.Equal(t, int64(1), c.Stats().LoadErrors)
+}
+
+func TestGetWithNewSetDuringLoad(t *testing.T) {
+	c := cmap.NewCache[string, int](nil)
+	m := cmap.New[string, int]()
+	for _, fs := range []struct {
+		getWithNew func(string, func() (int, error)) (int, error)
+		set        func(string, int)
+		get        func(string) (int, bool)
+	}{{c.GetWithNew, c.Set, c.Get}, {m.GetWithNew, m.Set, m.Get}} {
+		loading := make(chan struct{})
+		release := make(chan struct{})
+		var wg sync.WaitGroup
+		results := make(chan int, 2)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			v, err := fs.getWithNew("k", func() (int, error) {
+				close(loading)
+				<-release
+				return 1, nil
+			})
+			assert.Nil(t, err)
+			results <- v
+		}()
+		<-loading
+		go func() {
+			defer wg.Done()
+			// 等待正在执行的新建函数
+			v, err := fs.getWithNew("k", func() (int, error) { return 3, nil })
+			assert.Nil(t, err)
+			results <- v
+		}()
+		// 新建过程中写入的值不被覆盖
+		fs.set("k", 2)
+		close(release)
+		wg.Wait()
+		assert.Equal(t, 2, <-results)
+		assert.Equal(t, 2, <-results)
+		v, _ := fs.get("k")
+		assert.Equal(t, 2, v)
+	}
+}
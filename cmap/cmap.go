@@ -2,9 +2,11 @@ package cmap
 
 import (
 	"encoding/json"
+	"reflect"
 	"sync"
 
 	"github.com/wecisecode/util/cast"
+	"github.com/wecisecode/util/merrs"
 )
 
 var SHARD_COUNT = 32
@@ -16,7 +18,16 @@ type ConcurrentMap[K comparable, V any] []*ConcurrentMapShared[K, V]
 // A "thread" safe string to anything map.
 type ConcurrentMapShared[K comparable, V any] struct {
 	items        map[K]V
-	sync.RWMutex // Read Write mutex, guards access to internal map.
+	sync.RWMutex                // Read Write mutex, guards access to internal map.
+	calls        map[K]*call[V] // GetWithNew 正在执行的新建函数
+	hash         func(K) uint64 // 通过 NewWithHasher 指定的哈希函数，为 nil 时使用 fnv32
+}
+
+// 正在执行的新建函数，同一 key 的并发调用等待同一结果
+type call[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
 }
 
 // Creates a new 32 shards concurrent map.
@@ -37,6 +48,20 @@ func NewShards[K comparable, V any](shardcount int, data ...map[K]V) ConcurrentM
 	return m
 }
 
+// 生成使用指定哈希函数选择碎片的 map，shardcount 不大于 0 时为 SHARD_COUNT
+// 整数、字符串等类型的 key 可以使用 IntegerHasher StringHasher 等，避免默认哈希函数的类型转换开销
+func NewWithHasher[K comparable, V any](hash func(K) uint64, shardcount int, data ...map[K]V) ConcurrentMap[K, V] {
+	if shardcount <= 0 {
+		shardcount = SHARD_COUNT
+	}
+	m := make(ConcurrentMap[K, V], shardcount)
+	for i := 0; i < shardcount; i++ {
+		m[i] = &ConcurrentMapShared[K, V]{items: make(map[K]V), hash: hash}
+	}
+	m.PutAll(data...)
+	return m
+}
+
 // Creates a new single concurrent map.
 // 生成单个 支持并发的 map，适用于小数据量、低并发度的场景
 func NewSingle[K comparable, V any](data ...map[K]V) ConcurrentMap[K, V] {
@@ -46,11 +71,28 @@ func NewSingle[K comparable, V any](data ...map[K]V) ConcurrentMap[K, V] {
 
 // GetShard returns shard under given key
 func (m ConcurrentMap[K, V]) GetShard(key K) *ConcurrentMapShared[K, V] {
+	return m[m.shardIndex(key)]
+}
+
+func (m ConcurrentMap[K, V]) shardIndex(key K) int {
 	lenm := len(m)
 	if lenm == 1 {
-		return m[0]
+		return 0
+	}
+	if hash := m[0].hash; hash != nil {
+		return int(hash(key) % uint64(lenm))
+	}
+	return int(uint(fnv32(key)) % uint(lenm))
+}
+
+// 按碎片分组，每个碎片只需加锁一次
+func (m ConcurrentMap[K, V]) groupByShard(keys []K) [][]K {
+	groups := make([][]K, len(m))
+	for _, key := range keys {
+		i := m.shardIndex(key)
+		groups[i] = append(groups[i], key)
 	}
-	return m[uint(fnv32(key))%uint(lenm)]
+	return groups
 }
 
 func (m ConcurrentMap[K, V]) MSet(data map[K]V) {
@@ -102,27 +144,155 @@ func (m ConcurrentMap[K, V]) SetIfAbsent(key K, new_vlaue_func func() V) bool {
 }
 
 // 返回值 err 新建函数返回错误
+// 同一 key 并发调用时只执行一次新建函数，其它调用等待并返回相同结果，新建过程不阻塞其它 key 的访问
+// 新建过程中 key 被 Set 等操作写入时，不覆盖已写入的值，返回已写入的值
 func (m ConcurrentMap[K, V]) GetWithNew(key K, new_vlaue_func func() (V, error)) (v V, err error) {
 	// Get map shard.
 	shard := m.GetShard(key)
 	shard.RLock()
 	v, ok := shard.items[key]
 	shard.RUnlock()
-	if !ok {
+	if ok {
+		return
+	}
+	shard.Lock()
+	v, ok = shard.items[key]
+	if ok {
+		shard.Unlock()
+		return
+	}
+	if c, ok := shard.calls[key]; ok {
+		shard.Unlock()
+		<-c.done
+		return c.value, c.err
+	}
+	c := &call[V]{done: make(chan struct{})}
+	if shard.calls == nil {
+		shard.calls = map[K]*call[V]{}
+	}
+	shard.calls[key] = c
+	shard.Unlock()
+	normal := false
+	defer func() {
+		if !normal {
+			// 新建函数 panic，等待的调用返回错误
+			c.err = merrs.NewError("new value function of key %v panic", key)
+		}
 		shard.Lock()
-		defer shard.Unlock()
-		v, ok = shard.items[key]
-		if !ok {
-			v, err = new_vlaue_func()
-			if err != nil {
-				return
-			}
-			shard.items[key] = v
+		if exist, ok := shard.items[key]; ok {
+			c.value, c.err = exist, nil
+		} else if c.err == nil {
+			shard.items[key] = c.value
 		}
+		delete(shard.calls, key)
+		shard.Unlock()
+		close(c.done)
+		v, err = c.value, c.err
+	}()
+	c.value, c.err = new_vlaue_func()
+	normal = true
+	return
+}
+
+// 在碎片锁内根据原值计算新值，keep 为 false 时删除，返回新值及是否保留
+// fn 中不能访问同一 map
+//
+//	// 引用计数
+//	m.Compute(key, func(old int, exists bool) (int, bool) {
+//		return old - 1, old > 1
+//	})
+func (m ConcurrentMap[K, V]) Compute(key K, fn func(old V, exists bool) (newValue V, keep bool)) (V, bool) {
+	shard := m.GetShard(key)
+	shard.Lock()
+	defer shard.Unlock()
+	old, exists := shard.items[key]
+	v, keep := fn(old, exists)
+	if keep {
+		shard.items[key] = v
+	} else {
+		delete(shard.items, key)
+	}
+	return v, keep
+}
+
+// 存在时在碎片锁内计算新值，keep 为 false 时删除，不存在时返回 false 且不调用 fn
+func (m ConcurrentMap[K, V]) ComputeIfPresent(key K, fn func(old V) (newValue V, keep bool)) (v V, ok bool) {
+	shard := m.GetShard(key)
+	shard.Lock()
+	defer shard.Unlock()
+	old, exists := shard.items[key]
+	if !exists {
+		return
+	}
+	v, ok = fn(old)
+	if ok {
+		shard.items[key] = v
+	} else {
+		delete(shard.items, key)
 	}
 	return
 }
 
+// 当前值与 old 相等时替换为 new，equal 为 nil 时使用 reflect.DeepEqual 比较
+// key 不存在时不替换
+func (m ConcurrentMap[K, V]) CompareAndSwap(key K, old, new V, equal func(a, b V) bool) bool {
+	shard := m.GetShard(key)
+	shard.Lock()
+	defer shard.Unlock()
+	v, exists := shard.items[key]
+	if !exists {
+		return false
+	}
+	if equal == nil {
+		if !reflect.DeepEqual(v, old) {
+			return false
+		}
+	} else if !equal(v, old) {
+		return false
+	}
+	shard.items[key] = new
+	return true
+}
+
+// 批量获取，每个碎片只加锁一次，不存在的 key 不包括在返回结果中
+func (m ConcurrentMap[K, V]) MGet(keys ...K) map[K]V {
+	ret := make(map[K]V, len(keys))
+	for i, group := range m.groupByShard(keys) {
+		if len(group) == 0 {
+			continue
+		}
+		shard := m[i]
+		shard.RLock()
+		for _, key := range group {
+			if v, ok := shard.items[key]; ok {
+				ret[key] = v
+			}
+		}
+		shard.RUnlock()
+	}
+	return ret
+}
+
+// 批量删除，每个碎片只加锁一次，返回实际删除的数据
+func (m ConcurrentMap[K, V]) MRemove(keys ...K) map[K]V {
+	ret := make(map[K]V, len(keys))
+	for i, group := range m.groupByShard(keys) {
+		if len(group) == 0 {
+			continue
+		}
+		shard := m[i]
+		shard.Lock()
+		for _, key := range group {
+			if v, ok := shard.items[key]; ok {
+				ret[key] = v
+				delete(shard.items, key)
+			}
+		}
+		shard.Unlock()
+	}
+	return ret
+}
+
 // Get retrieves an element from map under given key.
 func (m ConcurrentMap[K, V]) GetIFPresent(key K) V {
 	// Get shard
@@ -233,6 +403,31 @@ func (m ConcurrentMap[K, V]) IterBuffered() <-chan Tuple[K, V] {
 	return ch
 }
 
+// 某一时刻的完整数据
+type Snapshot[K comparable, V any] []Tuple[K, V]
+
+// Snapshot 同时锁定所有碎片复制数据，返回一致的时间点快照
+// IterBuffered Items 逐个碎片读取，不同碎片的数据可能不是同一时刻的
+func (m ConcurrentMap[K, V]) Snapshot() Snapshot[K, V] {
+	for _, shard := range m {
+		shard.RLock()
+	}
+	n := 0
+	for _, shard := range m {
+		n += len(shard.items)
+	}
+	s := make(Snapshot[K, V], 0, n)
+	for _, shard := range m {
+		for key, val := range shard.items {
+			s = append(s, Tuple[K, V]{key, val})
+		}
+	}
+	for _, shard := range m {
+		shard.RUnlock()
+	}
+	return s
+}
+
 // Clear removes all items from map.
 func (m ConcurrentMap[K, V]) Clear() {
 	for item := range m.IterBuffered() {
@@ -283,12 +478,17 @@ func fanIn[K comparable, V any](chans []chan Tuple[K, V], out chan Tuple[K, V])
 }
 
 // Items returns all items as map[string]interface{}
+// 逐个碎片加锁复制，不同碎片的数据可能不是同一时刻的，需要一致的数据时使用 Snapshot
 func (m ConcurrentMap[K, V]) Items() map[K]V {
 	tmp := make(map[K]V)
 
 	// Insert items to temporary map.
-	for item := range m.IterBuffered() {
-		tmp[item.Key] = item.Val
+	for _, shard := range m {
+		shard.RLock()
+		for key, val := range shard.items {
+			tmp[key] = val
+		}
+		shard.RUnlock()
 	}
 
 	return tmp
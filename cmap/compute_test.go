@@ -0,0 +1,66 @@
+package cmap_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wecisecode/util/cmap"
+)
+
+func TestCompute(t *testing.T) {
+	m := cmap.New[string, int]()
+	// 并发计数
+	wg := sync.WaitGroup{}
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.Compute("counter", func(old int, exists bool) (int, bool) {
+				return old + 1, true
+			})
+		}()
+	}
+	wg.Wait()
+	v, _ := m.Get("counter")
+	assert.Equal(t, 100, v)
+
+	// 引用计数归零时删除
+	for i := 0; i < 99; i++ {
+		_, keep := m.Compute("counter", func(old int, exists bool) (int, bool) {
+			return old - 1, old > 1
+		})
+		assert.True(t, keep)
+	}
+	_, keep := m.Compute("counter", func(old int, exists bool) (int, bool) {
+		return old - 1, old > 1
+	})
+	assert.False(t, keep)
+	assert.False(t, m.Has("counter"))
+
+	_, ok := m.ComputeIfPresent("counter", func(old int) (int, bool) {
+		t.Fatal("should not be called")
+		return 0, true
+	})
+	assert.False(t, ok)
+	m.Set("x", 1)
+	v, ok = m.ComputeIfPresent("x", func(old int) (int, bool) { return old * 10, true })
+	assert.True(t, ok)
+	assert.Equal(t, 10, v)
+
+	assert.False(t, m.CompareAndSwap("y", 0, 1, nil))
+	assert.False(t, m.CompareAndSwap("x", 1, 2, nil))
+	assert.True(t, m.CompareAndSwap("x", 10, 2, nil))
+	assert.True(t, m.CompareAndSwap("x", 0, 4, func(a, b int) bool { return a%2 == b%2 }))
+	v, _ = m.Get("x")
+	assert.Equal(t, 4, v)
+}
+
+func TestMGetMRemove(t *testing.T) {
+	m := cmap.New[string, int]()
+	m.MSet(map[string]int{"a": 1, "b": 2, "c": 3, "d": 4})
+	assert.Equal(t, map[string]int{"a": 1, "c": 3}, m.MGet("a", "c", "x"))
+	assert.Equal(t, map[string]int{"b": 2, "d": 4}, m.MRemove("b", "d", "y"))
+	assert.Equal(t, 2, m.Count())
+	assert.Empty(t, m.MGet())
+}
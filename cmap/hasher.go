@@ -0,0 +1,34 @@
+package cmap
+
+import "hash/maphash"
+
+// 整数类型
+type Integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
+}
+
+// 整数 key 的哈希函数，对连续的整数也能均匀分布到各碎片
+func IntegerHasher[K Integer]() func(K) uint64 {
+	return func(key K) uint64 {
+		return mix64(uint64(key))
+	}
+}
+
+// 字符串 key 的哈希函数
+func StringHasher[K ~string]() func(K) uint64 {
+	seed := maphash.MakeSeed()
+	return func(key K) uint64 {
+		return maphash.String(seed, string(key))
+	}
+}
+
+// splitmix64
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,13 @@
+//go:build go1.24
+
+package cmap
+
+import "hash/maphash"
+
+// 任意可比较类型 key 的哈希函数，如结构体 key，不经过字符串转换
+func ComparableHasher[K comparable]() func(K) uint64 {
+	seed := maphash.MakeSeed()
+	return func(key K) uint64 {
+		return maphash.Comparable(seed, key)
+	}
+}
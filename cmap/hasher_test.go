@@ -0,0 +1,94 @@
+//go:build go1.24
+
+package cmap_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wecisecode/util/cmap"
+)
+
+type sessionKey struct {
+	Tenant uint32
+	ID     uint64
+}
+
+func TestHasher(t *testing.T) {
+	m := cmap.NewWithHasher[uint64, int](cmap.IntegerHasher[uint64](), 0)
+	for i := uint64(0); i < 10000; i++ {
+		m.Set(i, int(i))
+	}
+	assert.Equal(t, 10000, m.Count())
+	v, ok := m.Get(5000)
+	assert.True(t, ok)
+	assert.Equal(t, 5000, v)
+	allocs := testing.AllocsPerRun(100, func() {
+		m.Get(123456789)
+		m.Has(987654321)
+	})
+	assert.Equal(t, 0.0, allocs)
+
+	s := cmap.NewWithHasher[sessionKey, string](cmap.ComparableHasher[sessionKey](), 8)
+	s.Set(sessionKey{1, 2}, "a")
+	v2, ok := s.Get(sessionKey{1, 2})
+	assert.True(t, ok)
+	assert.Equal(t, "a", v2)
+	allocs = testing.AllocsPerRun(100, func() {
+		s.Get(sessionKey{3, 4})
+	})
+	assert.Equal(t, 0.0, allocs)
+
+	c := cmap.NewCache(&cmap.CacheOption[string, int]{Hasher: cmap.StringHasher[string]()})
+	c.Set("a", 1)
+	v3, _ := c.Get("a")
+	assert.Equal(t, 1, v3)
+}
+
+func BenchmarkGetUint64(b *testing.B) {
+	m := cmap.New[uint64, int]()
+	for i := uint64(0); i < 100000; i++ {
+		m.Set(i<<32, int(i))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Get(uint64(i%100000) << 32)
+	}
+}
+
+func BenchmarkGetUint64Hasher(b *testing.B) {
+	m := cmap.NewWithHasher[uint64, int](cmap.IntegerHasher[uint64](), 0)
+	for i := uint64(0); i < 100000; i++ {
+		m.Set(i<<32, int(i))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Get(uint64(i%100000) << 32)
+	}
+}
+
+func BenchmarkGetStruct(b *testing.B) {
+	m := cmap.New[sessionKey, int]()
+	for i := uint64(0); i < 100000; i++ {
+		m.Set(sessionKey{1, i}, int(i))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Get(sessionKey{1, uint64(i % 100000)})
+	}
+}
+
+func BenchmarkGetStructHasher(b *testing.B) {
+	m := cmap.NewWithHasher[sessionKey, int](cmap.ComparableHasher[sessionKey](), 0)
+	for i := uint64(0); i < 100000; i++ {
+		m.Set(sessionKey{1, i}, int(i))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Get(sessionKey{1, uint64(i % 100000)})
+	}
+}
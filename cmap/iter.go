@@ -0,0 +1,62 @@
+//go:build go1.23
+
+package cmap
+
+import "iter"
+
+// All 逐个碎片遍历，每个碎片的数据复制后释放锁再调用 yield，yield 中可以修改 map
+// 不使用 goroutine 及 channel，不同碎片的数据可能不是同一时刻的，需要一致的数据时使用 Snapshot
+//
+//	for k, v := range m.All() {
+//	}
+func (m ConcurrentMap[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		var buf []Tuple[K, V]
+		for _, shard := range m {
+			shard.RLock()
+			buf = buf[:0]
+			for key, val := range shard.items {
+				buf = append(buf, Tuple[K, V]{key, val})
+			}
+			shard.RUnlock()
+			for _, t := range buf {
+				if !yield(t.Key, t.Val) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// 遍历所有 key
+func (m ConcurrentMap[K, V]) AllKeys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for k := range m.All() {
+			if !yield(k) {
+				return
+			}
+		}
+	}
+}
+
+// 遍历所有 value
+func (m ConcurrentMap[K, V]) AllValues() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		for _, v := range m.All() {
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
+
+// 遍历快照数据
+func (s Snapshot[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for _, t := range s {
+			if !yield(t.Key, t.Val) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,92 @@
+//go:build go1.23
+
+package cmap_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wecisecode/util/cmap"
+)
+
+func TestIter(t *testing.T) {
+	m := cmap.New[int, int]()
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i*2)
+	}
+	count := 0
+	for k, v := range m.All() {
+		assert.Equal(t, k*2, v)
+		// 遍历过程中可以修改
+		m.Set(k, v+1)
+		count++
+	}
+	assert.Equal(t, 1000, count)
+
+	count = 0
+	for range m.AllKeys() {
+		count++
+		if count == 10 {
+			break
+		}
+	}
+	assert.Equal(t, 10, count)
+
+	s := m.Snapshot()
+	m.Clear()
+	assert.Equal(t, 1000, len(s))
+	for k, v := range s.All() {
+		assert.Equal(t, k*2+1, v)
+	}
+}
+
+func newBenchMap() cmap.ConcurrentMap[int, int] {
+	m := cmap.New[int, int]()
+	for i := 0; i < 100000; i++ {
+		m.Set(i, i)
+	}
+	return m
+}
+
+func BenchmarkIterBuffered(b *testing.B) {
+	m := newBenchMap()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for range m.IterBuffered() {
+		}
+	}
+}
+
+func BenchmarkItems(b *testing.B) {
+	m := newBenchMap()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Items()
+	}
+}
+
+func BenchmarkIterCb(b *testing.B) {
+	m := newBenchMap()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.IterCb(func(key int, v int) {})
+	}
+}
+
+func BenchmarkAll(b *testing.B) {
+	m := newBenchMap()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for range m.All() {
+		}
+	}
+}
+
+func BenchmarkSnapshot(b *testing.B) {
+	m := newBenchMap()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for range m.Snapshot().All() {
+		}
+	}
+}
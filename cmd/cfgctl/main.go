@@ -0,0 +1,252 @@
+// 配置信息查看工具，按应用相同的方式加载配置来源，用于排查配置项最终取值及其来源
+//
+//	cfgctl [-app name] [-v] show [-json] [-prefix p] [source ...]
+//	cfgctl [-app name] [-v] diff sourceA sourceB
+//	cfgctl [-app name] [-v] validate -schema file [-strict] [source ...]
+//	cfgctl [-app name] [-v] watch [-prefix p] [source ...]
+//
+// 未指定 source 时，加载当前目录下与应用同名的 .conf 文件和环境变量
+// 加密配置值 ENC(...) 原样输出，不做解密
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wecisecode/util/cast"
+	"github.com/wecisecode/util/cfg"
+	"github.com/wecisecode/util/logger"
+	"github.com/wecisecode/util/merrs"
+)
+
+var appname string
+var verbose bool
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintln(out, "usage: cfgctl [-app name] [-v] <command> [options] [source ...]")
+	fmt.Fprintln(out, "command:")
+	fmt.Fprintln(out, "  show      print effective config with source of each key")
+	fmt.Fprintln(out, "  diff      print difference of two sources")
+	fmt.Fprintln(out, "  validate  validate config against schema")
+	fmt.Fprintln(out, "  watch     print config changes live")
+	fmt.Fprintln(out, sourceUsage)
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.StringVar(&appname, "app", cfg.DefaultAppName, "application name, load <app>.conf when no source specified")
+	flag.BoolVar(&verbose, "v", false, "print config loading log")
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	var err error
+	args := flag.Args()[1:]
+	switch flag.Arg(0) {
+	case "show":
+		err = show(args)
+	case "diff":
+		err = diff(args)
+	case "validate":
+		err = validate(args)
+	case "watch":
+		err = watch(args)
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func loadConfig(specs ...string) (cfg.Configure, error) {
+	options, err := parseSources(appname, specs...)
+	if err != nil {
+		return nil, err
+	}
+	mcfg := cfg.MConfig(options...)
+	if verbose {
+		mcfg.WithLogger(logger.New(&logger.Option{ConsoleLevel: logger.DEBUG}))
+	}
+	return mcfg, nil
+}
+
+type keyInfo struct {
+	Value   string   `json:"value"`
+	Values  []string `json:"values,omitempty"`
+	Sources []string `json:"sources"`
+}
+
+// 扁平化后的配置项，值为未解密的原始值，多个来源时最后一个值为有效值
+func effective(mcfg cfg.Configure, prefix string) (keys []string, infos map[string]*keyInfo) {
+	infos = map[string]*keyInfo{}
+	srcs := cfg.Sources(mcfg)
+	for k, v := range mcfg.Map() {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		ki := &keyInfo{Sources: srcs[k]}
+		switch vs := v.(type) {
+		case []interface{}:
+			for _, u := range vs {
+				ki.Values = append(ki.Values, cast.ToString(u))
+			}
+		default:
+			ki.Values = []string{cast.ToString(v)}
+		}
+		if len(ki.Values) > 0 {
+			ki.Value = ki.Values[len(ki.Values)-1]
+		}
+		if len(ki.Values) < 2 {
+			ki.Values = nil
+		}
+		keys = append(keys, k)
+		infos[k] = ki
+	}
+	sort.Strings(keys)
+	return
+}
+
+func show(args []string) error {
+	fs := flag.NewFlagSet("show", flag.ExitOnError)
+	asjson := fs.Bool("json", false, "output as json")
+	prefix := fs.String("prefix", "", "only show keys with prefix")
+	fs.Parse(args)
+	mcfg, err := loadConfig(fs.Args()...)
+	if err != nil {
+		return err
+	}
+	keys, infos := effective(mcfg, *prefix)
+	if *asjson {
+		bs, err := json.MarshalIndent(infos, "", "    ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(bs))
+		return nil
+	}
+	for _, k := range keys {
+		ki := infos[k]
+		fmt.Printf("%s = %s\t# %s\n", k, ki.Value, strings.Join(ki.Sources, " < "))
+	}
+	return nil
+}
+
+func diffLines(akeys []string, ainfos map[string]*keyInfo, bkeys []string, binfos map[string]*keyInfo) (lines []string) {
+	keys := append(append([]string{}, akeys...), bkeys...)
+	sort.Strings(keys)
+	for i, k := range keys {
+		if i > 0 && keys[i-1] == k {
+			continue
+		}
+		a, b := ainfos[k], binfos[k]
+		switch {
+		case a == nil:
+			lines = append(lines, fmt.Sprintf("+ %s = %s", k, b.Value))
+		case b == nil:
+			lines = append(lines, fmt.Sprintf("- %s = %s", k, a.Value))
+		case a.Value != b.Value:
+			lines = append(lines, fmt.Sprintf("~ %s = %s -> %s", k, a.Value, b.Value))
+		}
+	}
+	return
+}
+
+func diff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	prefix := fs.String("prefix", "", "only diff keys with prefix")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		return fmt.Errorf("diff need two sources")
+	}
+	acfg, err := loadConfig(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	bcfg, err := loadConfig(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	akeys, ainfos := effective(acfg, *prefix)
+	bkeys, binfos := effective(bcfg, *prefix)
+	lines := diffLines(akeys, ainfos, bkeys, binfos)
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+	if len(lines) > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
+
+func validate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	schemafile := fs.String("schema", "", "schema file, json or yaml")
+	strict := fs.Bool("strict", false, "keys not defined in schema are errors")
+	fs.Parse(args)
+	if *schemafile == "" {
+		return fmt.Errorf("schema file not specified")
+	}
+	bs, err := os.ReadFile(*schemafile)
+	if err != nil {
+		return err
+	}
+	schema, err := cfg.ParseSchema(bs)
+	if err != nil {
+		return err
+	}
+	mcfg, err := loadConfig(fs.Args()...)
+	if err != nil {
+		return err
+	}
+	errs := schema.Validate(mcfg, *strict)
+	for _, e := range errs {
+		fmt.Println(merrs.MError(e).ErrorMsg)
+	}
+	if len(errs) > 0 {
+		os.Exit(1)
+	}
+	fmt.Println("ok")
+	return nil
+}
+
+func watch(args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	prefix := fs.String("prefix", "", "only watch keys with prefix")
+	fs.Parse(args)
+	mcfg, err := loadConfig(fs.Args()...)
+	if err != nil {
+		return err
+	}
+	var mutex sync.Mutex
+	var lastkeys []string
+	var lastinfos map[string]*keyInfo
+	mcfg.OnChange(func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		keys, infos := effective(mcfg, *prefix)
+		if lastinfos == nil {
+			for _, k := range keys {
+				fmt.Printf("%s = %s\t# %s\n", k, infos[k].Value, strings.Join(infos[k].Sources, " < "))
+			}
+		} else if lines := diffLines(lastkeys, lastinfos, keys, infos); len(lines) > 0 {
+			fmt.Println("#", time.Now().Format("2006-01-02 15:04:05.000"), "changed")
+			for _, line := range lines {
+				fmt.Println(line)
+			}
+		}
+		lastkeys, lastinfos = keys, infos
+	})
+	select {}
+}
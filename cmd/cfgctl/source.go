@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/wecisecode/util/cfg"
+)
+
+// 配置来源描述，多个来源以逗号分隔，按顺序合并，后面的优先
+const sourceUsage = `source:
+  app:<name>        <name>.conf in current directory, same as cfg.CwdAppConf
+  ini:<file>        ini file
+  json:<file>       json file
+  yaml:<file>       yaml file
+  logconf:<file>    log config file
+  etcd:<path>       ini config in etcd, same as etcd-ini:<path>
+  etcd-json:<path>  json config in etcd
+  etcd-yaml:<path>  yaml config in etcd
+  env               environment variables
+  <file>            file type by extension, default ini
+  multiple sources are separated by ',' and merged in order, the latter wins`
+
+func parseSource(spec string) (*cfg.CfgOption, error) {
+	if spec == "env" || spec == "envs" {
+		return cfg.CFGOPTION_ENVS, nil
+	}
+	typ, value := "", spec
+	if n := strings.Index(spec, ":"); n > 0 {
+		typ, value = spec[:n], spec[n+1:]
+	}
+	if value == "" {
+		return nil, fmt.Errorf("source %s value is empty", spec)
+	}
+	switch typ {
+	case "app":
+		return cfg.CwdAppConf(value), nil
+	case "ini":
+		return cfg.GetIniFileCfgOption(value), nil
+	case "json":
+		return cfg.GetJsonFileCfgOption(value), nil
+	case "yaml", "yml":
+		return cfg.GetYamlFileCfgOption(value), nil
+	case "logconf":
+		return cfg.GetLogConfCfgOption(value), nil
+	case "etcd", "etcd-ini":
+		return cfg.GetIniETCDCfgOption(value), nil
+	case "etcd-json":
+		return cfg.GetJsonETCDCfgOption(value), nil
+	case "etcd-yaml":
+		return cfg.GetYamlETCDCfgOption(value), nil
+	case "":
+		switch strings.ToLower(filepath.Ext(value)) {
+		case ".json":
+			return cfg.GetJsonFileCfgOption(value), nil
+		case ".yaml", ".yml":
+			return cfg.GetYamlFileCfgOption(value), nil
+		}
+		return cfg.GetIniFileCfgOption(value), nil
+	}
+	return nil, fmt.Errorf("unknown source type %s", typ)
+}
+
+// 解析配置来源列表，未指定时使用应用默认配置来源，即 CwdAppConf 和环境变量
+func parseSources(appname string, specs ...string) (options []*cfg.CfgOption, err error) {
+	for _, spec := range specs {
+		for _, s := range strings.Split(spec, ",") {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+			option, err := parseSource(s)
+			if err != nil {
+				return nil, err
+			}
+			options = append(options, option)
+		}
+	}
+	if len(options) == 0 {
+		if option := cfg.CwdAppConf(appname); option != nil {
+			options = append(options, option)
+		}
+		options = append(options, cfg.CFGOPTION_ENVS)
+	}
+	return
+}
@@ -0,0 +1,65 @@
+// 配置值加密工具
+//
+//	cfgencrypt [-keyid id] [-keyfile file | -keyenv name | -kmsdir dir] [-d] [value ...]
+//
+// 未指定 value 时从标准输入逐行读取，加密结果为 ENC(...) 形式，可直接写入 INI 文件或 ETCD
+// 默认从环境变量 MCONFIG_KEY 获取密钥
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/wecisecode/util/cfg"
+)
+
+func main() {
+	keyid := flag.String("keyid", "", "key id, encrypted value format is ENC(keyid:...)")
+	keyfile := flag.String("keyfile", "", "read key from file")
+	keyenv := flag.String("keyenv", cfg.DefaultKeyEnv, "read key from environment variable")
+	kmsdir := flag.String("kmsdir", "", "read key from local kms directory, keyid.key")
+	decrypt := flag.Bool("d", false, "decrypt ENC(...) values")
+	flag.Parse()
+
+	switch {
+	case *kmsdir != "":
+		cfg.SetKeyProvider(cfg.LocalKMSKeyProvider(*kmsdir))
+	case *keyfile != "":
+		cfg.SetKeyProvider(cfg.FileKeyProvider(*keyfile))
+	default:
+		cfg.SetKeyProvider(cfg.EnvKeyProvider(*keyenv))
+	}
+
+	proc := func(value string) bool {
+		var s string
+		var err error
+		if *decrypt {
+			s, err = cfg.DecryptValue(value)
+		} else {
+			s, err = cfg.EncryptValue(value, *keyid)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return false
+		}
+		fmt.Println(s)
+		return true
+	}
+
+	ok := true
+	if flag.NArg() > 0 {
+		for _, value := range flag.Args() {
+			ok = proc(value) && ok
+		}
+	} else {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			ok = proc(scanner.Text()) && ok
+		}
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
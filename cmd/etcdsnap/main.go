@@ -0,0 +1,149 @@
+// etcd 数据导出导入工具，用于环境迁移及配置备份
+//
+//	etcdsnap export [-format json|yaml] [-o file] prefix
+//	etcdsnap import [-prefix p] [-dry-run] [-prune] [-ttl] file
+//
+// 通过环境变量 ETCDPATH ETCDUSER ETCDPASS ETCDCACERT ETCDCERT ETCDKEY 等连接 etcd，参见 etcd.New
+// 需要解密 ETCDPASS 时通过 -key 指定 etcd.EncryptKey
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/wecisecode/util/etcd"
+)
+
+var timeout time.Duration
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintln(out, "usage: etcdsnap [-key encryptkey] [-timeout d] <command> [options] args")
+	fmt.Fprintln(out, "command:")
+	fmt.Fprintln(out, "  export    export prefix as json or yaml tree")
+	fmt.Fprintln(out, "  import    import json or yaml tree, print changes")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.StringVar(&etcd.EncryptKey, "key", etcd.EncryptKey, "key to decrypt ETCDPASS")
+	flag.DurationVar(&timeout, "timeout", time.Minute, "timeout of whole operation")
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	var err error
+	args := flag.Args()[1:]
+	switch flag.Arg(0) {
+	case "export":
+		err = export(args)
+	case "import":
+		err = doimport(args)
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func export(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "", "json or yaml, default by output file extension or json")
+	output := fs.String("o", "", "output file, default stdout")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: etcdsnap export [-format json|yaml] [-o file] prefix")
+	}
+	if *format == "" {
+		*format = strings.TrimPrefix(filepath.Ext(*output), ".")
+	}
+	cli, err := etcd.New()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	node, err := etcd.Export(ctx, cli, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	bs, err := etcd.MarshalNode(node, *format)
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		_, err = os.Stdout.Write(bs)
+		return err
+	}
+	return os.WriteFile(*output, bs, 0644)
+}
+
+func doimport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	opt := &etcd.ImportOption{}
+	fs.StringVar(&opt.Prefix, "prefix", "", "import to prefix instead of exported root key")
+	fs.BoolVar(&opt.DryRun, "dry-run", false, "print changes only")
+	fs.BoolVar(&opt.Prune, "prune", false, "delete keys not in import file")
+	fs.BoolVar(&opt.PreserveTTL, "ttl", false, "put keys with exported ttl")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: etcdsnap import [-prefix p] [-dry-run] [-prune] [-ttl] file")
+	}
+	var bs []byte
+	var err error
+	if fs.Arg(0) == "-" {
+		bs, err = io.ReadAll(os.Stdin)
+	} else {
+		bs, err = os.ReadFile(fs.Arg(0))
+	}
+	if err != nil {
+		return err
+	}
+	node, err := etcd.UnmarshalNode(bs)
+	if err != nil {
+		return err
+	}
+	cli, err := etcd.New()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	changes, err := etcd.Import(ctx, cli, node, opt)
+	for _, c := range changes {
+		ttl := ""
+		if c.TTL > 0 {
+			ttl = fmt.Sprintf(" (ttl %ds)", c.TTL)
+		}
+		switch {
+		case c.Action == etcd.ActionDelete:
+			fmt.Printf("- %s = %q\n", c.Key, c.OldValue)
+		case c.Exist:
+			fmt.Printf("~ %s = %q -> %q%s\n", c.Key, c.OldValue, c.Value, ttl)
+		default:
+			fmt.Printf("+ %s = %q%s\n", c.Key, c.Value, ttl)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if opt.DryRun {
+		fmt.Printf("%d changes, dry run, nothing changed\n", len(changes))
+	} else {
+		fmt.Printf("%d changes applied\n", len(changes))
+	}
+	return nil
+}
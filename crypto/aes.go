@@ -5,6 +5,7 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"encoding/base64"
+	"errors"
 )
 
 // https://studygolang.com/articles/15642?fr=sidebar
@@ -47,6 +48,41 @@ func AesDecrypt(cryted string, key string) string {
 	return string(orig)
 }
 
+// 与 AesEncrypt 相同，密钥长度不合法时返回错误而不是 panic
+func AesEncryptE(orig string, key string) (string, error) {
+	switch len(key) {
+	case 16, 24, 32:
+	default:
+		return "", errors.New("aes key length must be 16, 24 or 32")
+	}
+	return AesEncrypt(orig, key), nil
+}
+
+// 与 AesDecrypt 相同，密钥或密文不合法时返回错误而不是 panic
+func AesDecryptE(cryted string, key string) (string, error) {
+	crytedByte, err := base64.StdEncoding.DecodeString(cryted)
+	if err != nil {
+		return "", err
+	}
+	k := []byte(key)
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return "", err
+	}
+	blockSize := block.BlockSize()
+	if len(crytedByte) == 0 || len(crytedByte)%blockSize != 0 {
+		return "", errors.New("aes crypted data length is not a multiple of the block size")
+	}
+	blockMode := cipher.NewCBCDecrypter(block, k[:blockSize])
+	orig := make([]byte, len(crytedByte))
+	blockMode.CryptBlocks(orig, crytedByte)
+	unpadding := int(orig[len(orig)-1])
+	if unpadding == 0 || unpadding > blockSize || unpadding > len(orig) {
+		return "", errors.New("aes decrypt failed, invalid padding")
+	}
+	return string(orig[:len(orig)-unpadding]), nil
+}
+
 // 补码
 // AES加密数据块分组长度必须为128bit(byte[16])，密钥长度可以是128bit(byte[16])、192bit(byte[24])、256bit(byte[32])中的任意一个。
 func PKCS7Padding(ciphertext []byte, blocksize int) []byte {
@@ -0,0 +1,431 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wecisecode/util/merrs"
+	"github.com/wecisecode/util/mio"
+	"github.com/wecisecode/util/sortedmap"
+)
+
+// 缓存选项
+type CachedOption struct {
+	// 允许的最大数据过期时间，0 表示不限制
+	// 超过时从 etcd 读取并更新缓存，读取失败时返回缓存数据
+	MaxStaleness time.Duration
+	// 快照文件，非空时启动时从快照加载，数据变化后定期写入
+	SnapshotFile string
+	// 写入快照的最小间隔，默认 10 秒
+	SnapshotInterval time.Duration
+}
+
+// 带本地缓存的客户端，将 prefix 下的数据镜像到内存，通过 Watch 保持同步
+// prefix 下的 Get GetNode 从缓存读取，etcd 不可用时返回最后已知的数据，其它操作直接调用被包装的客户端
+// 写操作在收到 Watch 事件后才更新缓存
+//
+//	cli, err := etcd.NewCachedClient(etcd.Get(), "/matrix/etc", &etcd.CachedOption{SnapshotFile: "/opt/matrix/var/etcd.cache"})
+type CachedClient struct {
+	Client
+	prefix string
+	option CachedOption
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mutex    sync.RWMutex
+	data     *sortedmap.TreeMap // key -> *cachedKV
+	revision int64
+	synced   time.Time // 最后一次确认缓存与 etcd 一致的时间
+	dirty    bool
+}
+
+type cachedKV struct {
+	node   *Node
+	synced time.Time
+}
+
+type cachedSnapshot struct {
+	Prefix   string  `json:"prefix"`
+	Revision int64   `json:"revision"`
+	Nodes    []*Node `json:"nodes"`
+}
+
+// 创建缓存客户端，有快照时从快照加载后从快照的 revision 继续同步，否则从 etcd 加载
+func NewCachedClient(cli Client, prefix string, opt *CachedOption) (*CachedClient, error) {
+	c := &CachedClient{
+		Client: cli,
+		prefix: strings.TrimRight(prefix, Separator),
+		data:   sortedmap.NewTreeMap(),
+		done:   make(chan struct{}),
+	}
+	if c.prefix == "" {
+		c.prefix = Separator
+	}
+	if opt != nil {
+		c.option = *opt
+	}
+	if c.option.SnapshotInterval <= 0 {
+		c.option.SnapshotInterval = 10 * time.Second
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	var ch chan *Event
+	if c.option.SnapshotFile != "" && c.loadSnapshot() == nil && c.revision > 0 {
+		// 从快照的 revision 之后继续监听
+		ch = c.Client.WatchFrom(ctx, c.prefix, true, c.revision+1)
+	} else {
+		rg, ok := cli.(revisionGetter)
+		if !ok {
+			// 无法获取加载时的 revision，先开始监听再加载，重复的事件按 revision 忽略
+			ch = c.Client.WatchFrom(ctx, c.prefix, true, 0)
+		}
+		lctx, lcancel := context.WithTimeout(context.Background(), 30*time.Second)
+		var node *Node
+		var rev int64
+		var err error
+		if ok {
+			node, rev, err = rg.getNodeRevision(lctx, c.prefix)
+		} else {
+			node, err = cli.GetNodeCtx(lctx, c.prefix)
+		}
+		lcancel()
+		if err != nil && !IsNotFound(err) {
+			cancel()
+			return nil, err
+		}
+		c.mutex.Lock()
+		c.reset(node, rev)
+		c.mutex.Unlock()
+		if ok {
+			// 从加载时的 revision 之后继续监听，prefix 为空时也不会错过加载与开始监听之间的修改
+			ch = c.Client.WatchFrom(ctx, c.prefix, true, rev+1)
+		}
+	}
+	go c.watch(ctx, ch)
+	return c, nil
+}
+
+// 返回 key 及其子节点数据及读取时的 revision
+type revisionGetter interface {
+	getNodeRevision(ctx context.Context, key string) (node *Node, rev int64, err error)
+}
+
+func (c *CachedClient) inScope(key string) bool {
+	return c.prefix == Separator || key == c.prefix || strings.HasPrefix(key, c.prefix+Separator)
+}
+
+func (c *CachedClient) watch(ctx context.Context, ch chan *Event) {
+	defer close(c.done)
+	var ticker *time.Ticker
+	var tick <-chan time.Time
+	if c.option.SnapshotFile != "" {
+		ticker = time.NewTicker(c.option.SnapshotInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case evt, ok := <-ch:
+			if !ok {
+				return
+			}
+			c.mutex.Lock()
+			c.apply(evt)
+			c.mutex.Unlock()
+		case <-tick:
+			c.saveSnapshot(false)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// 以下方法调用前需持有 c.mutex
+
+func (c *CachedClient) apply(evt *Event) {
+	now := time.Now()
+	c.synced = now
+	if evt.Action == ActionResync {
+		c.reset(evt.Node, evt.Revision)
+		return
+	}
+	if !c.inScope(evt.Node.Key) {
+		return
+	}
+	if evt.Revision > c.revision {
+		c.revision = evt.Revision
+	}
+	if v, ok := c.data.Get(evt.Node.Key); ok && v.(*cachedKV).node.ModRevision >= evt.Revision && evt.Revision > 0 {
+		// 已加载的数据比事件新
+		return
+	}
+	switch evt.Action {
+	case ActionPut:
+		node := *evt.Node
+		c.data.Put(node.Key, &cachedKV{node: &node, synced: now})
+	case ActionDelete:
+		c.data.Delete(evt.Node.Key)
+	}
+	c.dirty = true
+}
+
+// 用 node 及其子节点替换全部缓存数据
+func (c *CachedClient) reset(node *Node, revision int64) {
+	now := time.Now()
+	c.data.Clear()
+	c.revision = revision
+	if node != nil {
+		c.putTree(node, now)
+	}
+	c.synced = now
+	c.dirty = true
+}
+
+func (c *CachedClient) putTree(node *Node, now time.Time) {
+	nodes := []*Node{node}
+	for i := 0; i < len(nodes); i++ {
+		n := nodes[i]
+		nodes = append(nodes, n.Nodes...)
+		if n.ModRevision == 0 || !c.inScope(n.Key) {
+			// 只有子节点的目录
+			continue
+		}
+		if n.ModRevision > c.revision {
+			c.revision = n.ModRevision
+		}
+		cn := *n
+		cn.Nodes, cn.Dir = nil, false
+		c.data.Put(cn.Key, &cachedKV{node: &cn, synced: now})
+	}
+}
+
+// key 及其子节点的缓存数据，按 key 排序
+func (c *CachedClient) subKeys(key string) (keys []string) {
+	if _, ok := c.data.Get(key); ok {
+		keys = append(keys, key)
+	}
+	prefixKey := key + Separator
+	if key == Separator {
+		prefixKey = Separator
+	}
+	c.data.FetchRange(prefixKey, nil, func(k, v interface{}) bool {
+		if !strings.HasPrefix(k.(string), prefixKey) {
+			return false
+		}
+		if k.(string) != key {
+			keys = append(keys, k.(string))
+		}
+		return true
+	}, false)
+	return
+}
+
+func (c *CachedClient) fresh(t time.Time) bool {
+	if c.option.MaxStaleness <= 0 {
+		return true
+	}
+	if c.synced.After(t) {
+		t = c.synced
+	}
+	return time.Since(t) <= c.option.MaxStaleness
+}
+
+func (c *CachedClient) Get(key string) (val string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	val, err = c.GetCtx(ctx, key)
+	if IsNotFound(err) {
+		return "", nil
+	}
+	return
+}
+
+func (c *CachedClient) GetCtx(ctx context.Context, key string) (val string, err error) {
+	if !c.inScope(key) {
+		return c.Client.GetCtx(ctx, key)
+	}
+	c.mutex.RLock()
+	v, ok := c.data.Get(key)
+	var kv *cachedKV
+	var fresh bool
+	if ok {
+		kv = v.(*cachedKV)
+		fresh = c.fresh(kv.synced)
+	} else {
+		fresh = c.fresh(time.Time{})
+	}
+	c.mutex.RUnlock()
+	if !fresh {
+		val, err = c.Client.GetCtx(ctx, key)
+		if err == nil || IsNotFound(err) {
+			c.mutex.Lock()
+			if err == nil {
+				if kv == nil || kv.node.Value != val {
+					// 读取结果没有 revision，在 Watch 事件到达前暂时使用
+					c.data.Put(key, &cachedKV{node: &Node{Key: key, Value: val}, synced: time.Now()})
+					c.dirty = true
+				} else {
+					kv.synced = time.Now()
+				}
+			} else if ok {
+				c.data.Delete(key)
+				c.dirty = true
+			}
+			c.mutex.Unlock()
+			return
+		}
+		// etcd 不可用，返回缓存数据
+	}
+	if !ok {
+		return "", ErrNotFound.New("key %s not found", key)
+	}
+	return kv.node.Value, nil
+}
+
+func (c *CachedClient) GetNode(key string) (node *Node, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	node, err = c.GetNodeCtx(ctx, key)
+	if IsNotFound(err) {
+		return &Node{Key: key}, nil
+	}
+	return
+}
+
+func (c *CachedClient) GetNodeCtx(ctx context.Context, key string) (node *Node, err error) {
+	if !c.inScope(key) {
+		return c.Client.GetNodeCtx(ctx, key)
+	}
+	c.mutex.RLock()
+	fresh := c.fresh(time.Time{})
+	c.mutex.RUnlock()
+	if !fresh {
+		node, err = c.Client.GetNodeCtx(ctx, key)
+		if err == nil || IsNotFound(err) {
+			c.mutex.Lock()
+			for _, k := range c.subKeys(key) {
+				c.data.Delete(k)
+			}
+			if node != nil {
+				c.putTree(node, time.Now())
+			}
+			if key == c.prefix {
+				c.synced = time.Now()
+			}
+			c.dirty = true
+			c.mutex.Unlock()
+			return
+		}
+		// etcd 不可用，返回缓存数据
+	}
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	top := &Node{Key: key}
+	keys := c.subKeys(key)
+	if len(keys) == 0 {
+		return nil, ErrNotFound.New("key %s not found", key)
+	}
+	prefixKey := key + Separator
+	if key == Separator {
+		prefixKey = Separator
+	}
+	nodes := map[string]*Node{key: top}
+	for _, k := range keys {
+		kv := c.data.GetValue(k).(*cachedKV)
+		if k == key {
+			*top = *kv.node
+			continue
+		}
+		parent := top
+		rel := strings.Split(k[len(prefixKey):], Separator)
+		for i := range rel {
+			nk := prefixKey + strings.Join(rel[:i+1], Separator)
+			n := nodes[nk]
+			if n == nil {
+				n = &Node{Key: nk}
+				nodes[nk] = n
+				parent.Nodes = append(parent.Nodes, n)
+				parent.Dir = true
+			}
+			if nk == k {
+				n.Value = kv.node.Value
+				n.TTL = kv.node.TTL
+				n.CreateRevision = kv.node.CreateRevision
+				n.ModRevision = kv.node.ModRevision
+			}
+			parent = n
+		}
+	}
+	return top, nil
+}
+
+// 缓存数据的 revision
+func (c *CachedClient) Revision() int64 {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.revision
+}
+
+// 停止同步，写入快照，并关闭被包装的客户端
+func (c *CachedClient) Close() error {
+	c.cancel()
+	<-c.done
+	c.saveSnapshot(true)
+	return c.Client.Close()
+}
+
+func (c *CachedClient) loadSnapshot() error {
+	// 快照文件不存在时 mio.ReadFile 读取上一个完整的快照文件
+	bs, err := mio.ReadFile(c.option.SnapshotFile)
+	if err != nil {
+		return err
+	}
+	if len(bs) == 0 {
+		return merrs.NewError("snapshot file %s not found", c.option.SnapshotFile)
+	}
+	snapshot := &cachedSnapshot{}
+	if err := json.Unmarshal(bs, snapshot); err != nil {
+		return merrs.NewError(err)
+	}
+	if snapshot.Prefix != c.prefix {
+		return merrs.NewError("snapshot prefix %s not match %s", snapshot.Prefix, c.prefix)
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, n := range snapshot.Nodes {
+		// 快照数据视为已过期
+		c.data.Put(n.Key, &cachedKV{node: n})
+	}
+	c.revision = snapshot.Revision
+	return nil
+}
+
+func (c *CachedClient) saveSnapshot(force bool) {
+	if c.option.SnapshotFile == "" {
+		return
+	}
+	c.mutex.Lock()
+	if !c.dirty && !force {
+		c.mutex.Unlock()
+		return
+	}
+	snapshot := &cachedSnapshot{Prefix: c.prefix, Revision: c.revision}
+	c.data.Fetch(func(k, v interface{}) bool {
+		snapshot.Nodes = append(snapshot.Nodes, v.(*cachedKV).node)
+		return true
+	})
+	c.dirty = false
+	c.mutex.Unlock()
+	bs, err := json.Marshal(snapshot)
+	if err == nil {
+		err = mio.WriteFile(c.option.SnapshotFile, bs, true)
+	}
+	if err != nil {
+		c.mutex.Lock()
+		c.dirty = true
+		c.mutex.Unlock()
+	}
+}
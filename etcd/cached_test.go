@@ -0,0 +1,134 @@
+package etcd_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wecisecode/util/etcd"
+)
+
+func TestCachedClient(t *testing.T) {
+	mem := etcd.NewMemClient()
+	assert.Nil(t, mem.Put("/app/a", "1"))
+	assert.Nil(t, mem.Put("/app/b/c", "2"))
+	assert.Nil(t, mem.Put("/other", "x"))
+
+	snapshot := filepath.Join(t.TempDir(), "etcd.cache")
+	cli, err := etcd.NewCachedClient(mem, "/app", &etcd.CachedOption{SnapshotFile: snapshot})
+	assert.Nil(t, err)
+
+	v, err := cli.Get("/app/a")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", v)
+	node, err := cli.GetNode("/app")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(node.Nodes))
+	assert.Equal(t, "2", node.Nodes[1].Nodes[0].Value)
+	v, _ = cli.Get("/other")
+	assert.Equal(t, "x", v)
+
+	assert.Nil(t, cli.Put("/app/a", "3"))
+	assert.Nil(t, cli.Delete("/app/b/c"))
+	assert.Eventually(t, func() bool {
+		v, _ := cli.Get("/app/a")
+		n, _ := cli.GetNode("/app")
+		return v == "3" && len(n.Nodes) == 1
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, mem.Revision(), cli.Revision())
+	assert.Nil(t, cli.Close())
+
+	// mem 已随 cli 关闭，etcd 不可用时从快照加载并返回最后已知的数据
+	cli, err = etcd.NewCachedClient(mem, "/app", &etcd.CachedOption{SnapshotFile: snapshot, MaxStaleness: time.Millisecond})
+	assert.Nil(t, err)
+	v, err = cli.Get("/app/a")
+	assert.Nil(t, err)
+	assert.Equal(t, "3", v)
+	_, err = cli.GetCtx(context.Background(), "/app/b/c")
+	assert.True(t, etcd.IsNotFound(err))
+	cli.Close()
+}
+
+func TestCachedClientResume(t *testing.T) {
+	mem := etcd.NewMemClient()
+	defer mem.Close()
+	assert.Nil(t, mem.Put("/app/a", "1"))
+
+	snapshot := filepath.Join(t.TempDir(), "etcd.cache")
+	cli, err := etcd.NewCachedClient(mem, "/app", &etcd.CachedOption{SnapshotFile: snapshot})
+	assert.Nil(t, err)
+	// 停止同步并写入快照，不关闭 mem
+	cli.Client = etcd.NewMemClient()
+	cli.Close()
+
+	assert.Nil(t, mem.Put("/app/b", "2"))
+	cli, err = etcd.NewCachedClient(mem, "/app", &etcd.CachedOption{SnapshotFile: snapshot})
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool {
+		v, _ := cli.Get("/app/b")
+		return v == "2"
+	}, time.Second, time.Millisecond)
+
+	// 历史被压缩后重新同步
+	cli.Client = etcd.NewMemClient()
+	cli.Close()
+	assert.Nil(t, mem.Delete("/app/a"))
+	mem.Compact(mem.Revision())
+	cli, err = etcd.NewCachedClient(mem, "/app", &etcd.CachedOption{SnapshotFile: snapshot})
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool {
+		_, err := cli.GetNodeCtx(context.Background(), "/app/a")
+		return etcd.IsNotFound(err)
+	}, time.Second, time.Millisecond)
+}
+
+func TestCachedClientLastSnapshot(t *testing.T) {
+	mem := etcd.NewMemClient()
+	defer mem.Close()
+	assert.Nil(t, mem.Put("/app/a", "1"))
+
+	snapshot := filepath.Join(t.TempDir(), "etcd.cache")
+	cli, err := etcd.NewCachedClient(mem, "/app", &etcd.CachedOption{SnapshotFile: snapshot})
+	assert.Nil(t, err)
+	rev := cli.Revision()
+	cli.Client = etcd.NewMemClient()
+	cli.Close()
+
+	// 写入快照时中断，只留下上一个完整的快照文件
+	assert.Nil(t, os.Rename(snapshot, filepath.Join(filepath.Dir(snapshot), "etcd.last.cache")))
+	cli, err = etcd.NewCachedClient(etcd.NewMemClient(), "/app", &etcd.CachedOption{SnapshotFile: snapshot})
+	assert.Nil(t, err)
+	defer cli.Close()
+	assert.Equal(t, rev, cli.Revision())
+}
+
+// 开始监听前写入数据
+type racyClient struct {
+	*etcd.MemClient
+	once bool
+}
+
+func (c *racyClient) WatchFrom(ctx context.Context, key string, recursive bool, rev int64) chan *etcd.Event {
+	if !c.once {
+		c.once = true
+		c.MemClient.Put("/app/a", "1")
+	}
+	return c.MemClient.WatchFrom(ctx, key, recursive, rev)
+}
+
+func TestCachedClientEmptyPrefix(t *testing.T) {
+	mem := etcd.NewMemClient()
+	defer mem.Close()
+	assert.Nil(t, mem.Put("/other", "x"))
+	cli, err := etcd.NewCachedClient(&racyClient{MemClient: mem}, "/app", nil)
+	assert.Nil(t, err)
+	defer cli.Close()
+	// 加载与开始监听之间的修改不丢失
+	assert.Eventually(t, func() bool {
+		v, _ := cli.Get("/app/a")
+		return v == "1"
+	}, time.Second, time.Millisecond)
+}
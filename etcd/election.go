@@ -0,0 +1,236 @@
+package etcd
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// 基于 Txn 和租约的 leader 选举，适用于任意 Client 实现
+// leader 将 nodeID 写入 electionKey 并绑定到通过 KeepAliveLease 持续续约的租约，
+// 租约失效或 electionKey 被其它节点取代时失去 leader 身份
+//
+//	e := etcd.NewElection(cli, "/election/app", 10)
+//	err := e.Campaign(ctx, nodeID)
+//	if err == nil {
+//		defer e.Resign()
+//		select {
+//		case <-e.Done(): // 失去 leader 身份
+//		case <-ctx.Done():
+//		}
+//	}
+type Election struct {
+	client Client
+	key    string
+	ttl    int64
+	mutex  sync.Mutex
+	nodeID string
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewElection(cli Client, electionKey string, ttl int64) *Election {
+	if ttl < 1 {
+		ttl = 10
+	}
+	return &Election{client: cli, key: electionKey, ttl: ttl}
+}
+
+// 以默认 ttl 参加选举，阻塞直到成为 leader 或 ctx 结束
+func Campaign(ctx context.Context, cli Client, electionKey, nodeID string) (*Election, error) {
+	e := NewElection(cli, electionKey, 0)
+	if err := e.Campaign(ctx, nodeID); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// 参加选举，阻塞直到成为 leader 或 ctx 结束
+func (e *Election) Campaign(ctx context.Context, nodeID string) error {
+	// 租约在当选后继续使用，生命周期由 Resign 控制
+	lctx, lcancel := context.WithCancel(context.Background())
+	var lease int64
+	var lost chan bool
+	for {
+		if lost == nil {
+			var err error
+			if lease, lost, err = e.client.KeepAliveLease(lctx, e.ttl); err != nil {
+				lost = nil
+			}
+		}
+		wctx, wcancel := context.WithCancel(ctx)
+		// 先开始监听，避免错过 leader 释放事件
+		ch := e.client.Watch(wctx, e.key, false)
+		succeeded := false
+		var rev int64
+		if lost != nil {
+			resp, err := e.client.Txn().
+				If(CmpNotExist(e.key)).
+				Then(OpPutLease(e.key, nodeID, lease)).
+				Else(OpGet(e.key)).
+				CommitCtx(ctx)
+			if err == nil && !resp.Succeeded && len(resp.Nodes) > 0 && resp.Nodes[0] != nil && resp.Nodes[0].Value == nodeID {
+				// 同一节点重新参加选举，直接接管，key 绑定到新租约
+				resp, err = e.client.Txn().
+					If(CmpModRevision(e.key, "=", resp.Nodes[0].ModRevision)).
+					Then(OpPutLease(e.key, nodeID, lease)).
+					CommitCtx(ctx)
+			}
+			succeeded = err == nil && resp.Succeeded
+			if succeeded {
+				rev = resp.Revision
+			}
+			if IsNotFound(err) {
+				// 租约已失效，重新创建
+				lcancel()
+				lctx, lcancel = context.WithCancel(context.Background())
+				lost = nil
+			}
+		}
+		if succeeded {
+			wcancel()
+			e.elected(nodeID, rev, lcancel, lost)
+			return nil
+		}
+		timer := time.NewTimer(time.Duration(e.ttl) * time.Second)
+	L:
+		for {
+			select {
+			case evt, ok := <-ch:
+				if !ok || eventValue(evt) == "" {
+					break L
+				}
+			case <-timer.C:
+				break L
+			case <-ctx.Done():
+				timer.Stop()
+				wcancel()
+				lcancel()
+				return ctx.Err()
+			}
+		}
+		timer.Stop()
+		wcancel()
+	}
+}
+
+// 当选后监听租约及 electionKey，租约失效或 key 被删除、被其它节点取代时失去 leader 身份
+// 从当选事务的下一个 revision 开始监听，不会错过当选后立即发生的变化
+func (e *Election) elected(nodeID string, rev int64, lcancel context.CancelFunc, lost chan bool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	e.mutex.Lock()
+	e.nodeID = nodeID
+	e.cancel = cancel
+	e.done = done
+	e.mutex.Unlock()
+	ch := e.client.WatchFrom(ctx, e.key, false, rev+1)
+	go func() {
+		defer close(done)
+		defer lcancel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-lost:
+				return
+			case evt, ok := <-ch:
+				if !ok || eventValue(evt) != nodeID {
+					return
+				}
+			}
+		}
+	}()
+}
+
+// 是否为 leader
+func (e *Election) IsLeader() bool {
+	e.mutex.Lock()
+	done := e.done
+	e.mutex.Unlock()
+	if done == nil {
+		return false
+	}
+	select {
+	case <-done:
+		return false
+	default:
+		return true
+	}
+}
+
+// 失去 leader 身份时关闭，未成为 leader 时返回 nil
+func (e *Election) Done() <-chan struct{} {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.done
+}
+
+// 放弃 leader 身份
+func (e *Election) Resign() error {
+	return e.ResignCtx(context.Background())
+}
+
+func (e *Election) ResignCtx(ctx context.Context) error {
+	e.mutex.Lock()
+	nodeID, cancel, done := e.nodeID, e.cancel, e.done
+	e.nodeID, e.cancel = "", nil
+	e.mutex.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	<-done
+	_, err := e.client.Txn().If(CmpValue(e.key, "=", nodeID)).Then(OpDelete(e.key)).CommitCtx(ctx)
+	return err
+}
+
+// 当前 leader 的 nodeID，没有 leader 时返回空字符串
+func (e *Election) Leader() (string, error) {
+	return e.client.Get(e.key)
+}
+
+// 监听 leader 变化，首先返回当前 leader，没有 leader 时为空字符串，ctx 结束时关闭通道
+func (e *Election) Observe(ctx context.Context) <-chan string {
+	ret := make(chan string, 1)
+	ch := e.client.Watch(ctx, e.key, false)
+	go func() {
+		defer close(ret)
+		last, err := e.Leader()
+		if err != nil {
+			return
+		}
+		select {
+		case ret <- last:
+		case <-ctx.Done():
+			return
+		}
+		for evt := range ch {
+			leader := eventValue(evt)
+			if leader == last {
+				continue
+			}
+			last = leader
+			select {
+			case ret <- leader:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ret
+}
+
+// 事件发生后 electionKey 的值，key 不存在时为空字符串
+func eventValue(evt *Event) string {
+	switch evt.Action {
+	case ActionPut:
+		return evt.Node.Value
+	case ActionResync:
+		// 历史被压缩，重新加载的节点 ModRevision 为 0 时 key 不存在
+		if evt.Node.ModRevision != 0 {
+			return evt.Node.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,216 @@
+package etcd_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wecisecode/util/etcd"
+)
+
+func TestElection(t *testing.T) {
+	cli := etcd.NewMemClient()
+	defer cli.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	e1 := etcd.NewElection(cli, "/election", 1)
+	e2 := etcd.NewElection(cli, "/election", 1)
+	observe := e1.Observe(ctx)
+	assert.Equal(t, "", <-observe)
+
+	assert.Nil(t, e1.Campaign(ctx, "n1"))
+	assert.True(t, e1.IsLeader())
+	assert.Equal(t, "n1", <-observe)
+
+	elected := make(chan error)
+	go func() {
+		elected <- e2.Campaign(ctx, "n2")
+	}()
+	// leader 续约期间 n2 不能当选
+	select {
+	case <-elected:
+		t.Fatal("n2 elected while n1 is leader")
+	case <-time.After(1500 * time.Millisecond):
+	}
+	leader, _ := e1.Leader()
+	assert.Equal(t, "n1", leader)
+
+	assert.Nil(t, e1.Resign())
+	assert.False(t, e1.IsLeader())
+	assert.Nil(t, <-elected)
+	assert.True(t, e2.IsLeader())
+	assert.Equal(t, "", <-observe)
+	assert.Equal(t, "n2", <-observe)
+
+	// 被其它节点取代时失去 leader 身份
+	assert.Nil(t, cli.Put("/election", "n3"))
+	select {
+	case <-e2.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("n2 not lost leadership")
+	}
+
+	cctx, ccancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer ccancel()
+	assert.Equal(t, context.DeadlineExceeded, e1.Campaign(cctx, "n1"))
+
+	// 同一节点重新参加选举，key 仍绑定租约
+	assert.Nil(t, cli.Delete("/election"))
+	e3 := etcd.NewElection(cli, "/election", 30)
+	assert.Nil(t, e3.Campaign(ctx, "n1"))
+	e4 := etcd.NewElection(cli, "/election", 30)
+	assert.Nil(t, e4.Campaign(ctx, "n1"))
+	node, err := cli.GetNode("/election")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(30), node.TTL)
+
+	// 租约失效时失去 leader 身份
+	assert.True(t, cli.ExpireLease("/election"))
+	select {
+	case <-e4.Done():
+	case <-time.After(time.Second):
+		t.Fatal("n1 not lost leadership after lease expired")
+	}
+}
+
+// 开始监听前删除 key，模拟当选事务与监听之间发生的变化
+type gapClient struct {
+	*etcd.MemClient
+	key string
+}
+
+func (c *gapClient) WatchFrom(ctx context.Context, key string, recursive bool, rev int64) chan *etcd.Event {
+	if key == c.key && rev > 0 {
+		c.MemClient.Delete(key)
+	}
+	return c.MemClient.WatchFrom(ctx, key, recursive, rev)
+}
+
+func TestElectionWatchGap(t *testing.T) {
+	cli := etcd.NewMemClient()
+	defer cli.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	e := etcd.NewElection(&gapClient{MemClient: cli, key: "/election"}, "/election", 30)
+	assert.Nil(t, e.Campaign(ctx, "n1"))
+	select {
+	case <-e.Done():
+	case <-time.After(time.Second):
+		t.Fatal("n1 not lost leadership after key deleted before watch")
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	cli := etcd.NewMemClient()
+	defer cli.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := etcd.NewRegistry(cli, "/services", 1)
+	assert.Nil(t, r.Register(ctx, "svc", &etcd.ServiceInstance{ID: "a", Addr: "127.0.0.1:1"}))
+	d, err := r.Discover(ctx, "svc")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(d.Instances()))
+
+	changed := make(chan []*etcd.ServiceInstance, 10)
+	d.OnChange(func(instances []*etcd.ServiceInstance) {
+		changed <- instances
+	})
+	rctx, rcancel := context.WithCancel(ctx)
+	assert.Nil(t, r.Register(rctx, "svc", &etcd.ServiceInstance{ID: "b", Addr: "127.0.0.1:2"}))
+	instances := <-changed
+	assert.Equal(t, 2, len(instances))
+	assert.Equal(t, "b", instances[1].ID)
+
+	// 续约期间实例保持注册状态，续约不产生写入事件
+	wctx, wcancel := context.WithCancel(ctx)
+	events := cli.Watch(wctx, "/services/svc", true)
+	time.Sleep(1500 * time.Millisecond)
+	wcancel()
+	for evt := range events {
+		t.Fatalf("unexpected event during keepalive: %v %s", evt.Action, evt.Node.Key)
+	}
+	assert.Equal(t, 2, len(d.Instances()))
+
+	// 租约失效后重新注册
+	assert.True(t, cli.ExpireLease("/services/svc/b"))
+	assert.Equal(t, 1, len(<-changed))
+	assert.Equal(t, 2, len(<-changed))
+
+	rcancel()
+	instances = <-changed
+	assert.Equal(t, 1, len(instances))
+	assert.Equal(t, "a", instances[0].ID)
+}
+
+// Watch 及 WatchFrom 返回测试控制的通道，用于发送 ActionResync 事件
+type resyncClient struct {
+	*etcd.MemClient
+	ch chan *etcd.Event
+}
+
+func (c *resyncClient) Watch(ctx context.Context, key string, recursive bool) chan *etcd.Event {
+	return c.ch
+}
+
+func (c *resyncClient) WatchFrom(ctx context.Context, key string, recursive bool, rev int64) chan *etcd.Event {
+	return c.ch
+}
+
+func TestElectionResync(t *testing.T) {
+	cli := etcd.NewMemClient()
+	defer cli.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rc := &resyncClient{MemClient: cli, ch: make(chan *etcd.Event, 1)}
+	e := etcd.NewElection(rc, "/election", 30)
+	assert.Nil(t, e.Campaign(ctx, "n1"))
+	node, _ := cli.GetNode("/election")
+	rc.ch <- &etcd.Event{Action: etcd.ActionResync, Node: node, WatchStatus: etcd.WatchStatusCompacted}
+	time.Sleep(100 * time.Millisecond)
+	assert.True(t, e.IsLeader())
+
+	// 重新加载时 key 已不存在
+	rc.ch <- &etcd.Event{Action: etcd.ActionResync, Node: &etcd.Node{Key: "/election"}, WatchStatus: etcd.WatchStatusCompacted}
+	select {
+	case <-e.Done():
+	case <-time.After(time.Second):
+		t.Fatal("n1 not lost leadership after resync without election key")
+	}
+}
+
+func TestDiscoveryResync(t *testing.T) {
+	cli := etcd.NewMemClient()
+	defer cli.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	assert.Nil(t, cli.Put("/services/svc", "not an instance"))
+	assert.Nil(t, cli.Put("/services/svc/a", `{"id":"a","addr":"127.0.0.1:1"}`))
+	rc := &resyncClient{MemClient: cli, ch: make(chan *etcd.Event, 1)}
+	d, err := etcd.NewRegistry(rc, "/services", 10).Discover(ctx, "svc")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(d.Instances()))
+	changed := make(chan []*etcd.ServiceInstance, 10)
+	d.OnChange(func(instances []*etcd.ServiceInstance) {
+		changed <- instances
+	})
+
+	// 压缩期间 a 被删除，b 被添加
+	assert.Nil(t, cli.Delete("/services/svc/a"))
+	assert.Nil(t, cli.Put("/services/svc/b", `{"id":"b","addr":"127.0.0.1:2"}`))
+	cli.Compact(cli.Revision())
+	evt := <-cli.WatchFrom(ctx, "/services/svc/", true, 1)
+	assert.Equal(t, etcd.ActionResync, evt.Action)
+	assert.Equal(t, "/services/svc/", evt.Node.Key)
+	assert.Equal(t, "", evt.Node.Value)
+	assert.Equal(t, 1, len(evt.Node.Nodes))
+	rc.ch <- evt
+	instances := <-changed
+	assert.Equal(t, 1, len(instances))
+	assert.Equal(t, "b", instances[0].ID)
+}
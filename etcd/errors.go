@@ -0,0 +1,89 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+
+	"github.com/wecisecode/util/merrs"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ETCD 操作错误类型，通过 IsNotFound IsTimeout IsAuthError IsConnectionError 判断
+var (
+	ErrETCD       = merrs.NewErrorClass("[ETCD]", nil)
+	ErrNotFound   = merrs.NewErrorClass("[ETCD.NotFound]", ErrETCD)
+	ErrTimeout    = merrs.NewErrorClass("[ETCD.Timeout]", ErrETCD)
+	ErrCanceled   = merrs.NewErrorClass("[ETCD.Canceled]", ErrETCD)
+	ErrAuth       = merrs.NewErrorClass("[ETCD.Auth]", ErrETCD)
+	ErrConnection = merrs.NewErrorClass("[ETCD.Connection]", ErrETCD)
+	ErrClosed     = merrs.NewErrorClass("[ETCD.Closed]", ErrConnection)
+)
+
+func IsNotFound(err error) bool {
+	return ErrNotFound.Contains(err)
+}
+
+func IsTimeout(err error) bool {
+	return ErrTimeout.Contains(err)
+}
+
+func IsCanceled(err error) bool {
+	return ErrCanceled.Contains(err)
+}
+
+func IsAuthError(err error) bool {
+	return ErrAuth.Contains(err)
+}
+
+// 连接断开或客户端已关闭
+func IsConnectionError(err error) bool {
+	return ErrConnection.Contains(err)
+}
+
+// 将 etcd 客户端及 context 错误转换为对应的 merrs 错误类型
+func convertError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*merrs.Error); ok {
+		return err
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrTimeout.New(err)
+	case errors.Is(err, context.Canceled):
+		return ErrCanceled.New(err)
+	case errors.Is(err, clientv3.ErrNoAvailableEndpoints):
+		return ErrConnection.New(err)
+	}
+	code := codes.Unknown
+	if ee, ok := rpctypes.Error(err).(rpctypes.EtcdError); ok {
+		code = ee.Code()
+	} else if s, ok := status.FromError(err); ok {
+		code = s.Code()
+	}
+	switch code {
+	case codes.DeadlineExceeded:
+		return ErrTimeout.New(err)
+	case codes.Canceled:
+		return ErrCanceled.New(err)
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return ErrAuth.New(err)
+	case codes.FailedPrecondition:
+		if rpctypes.Error(err) == rpctypes.ErrAuthNotEnabled {
+			return ErrAuth.New(err)
+		}
+	case codes.InvalidArgument:
+		if rpctypes.Error(err) == rpctypes.ErrUserEmpty {
+			return ErrAuth.New(err)
+		}
+	case codes.Unavailable:
+		return ErrConnection.New(err)
+	case codes.NotFound:
+		return ErrNotFound.New(err)
+	}
+	return ErrETCD.New(err)
+}
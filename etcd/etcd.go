@@ -2,11 +2,13 @@ package etcd
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/wecisecode/util/crypto"
 	"github.com/wecisecode/util/merrs"
@@ -16,6 +18,8 @@ var EncryptKey = ""
 
 const (
 	WatchStatusOK WatchStatus = "ok"
+	// 历史已被压缩，无法从指定 revision 继续监听，已重新加载
+	WatchStatusCompacted WatchStatus = "compacted"
 
 	//ActionSet ActionType = "set"
 	//ActionUpdate ActionType = "update"
@@ -23,6 +27,8 @@ const (
 
 	ActionPut    ActionType = "put"
 	ActionDelete ActionType = "delete"
+	// 重新同步，Node 为重新加载的 key 当前完整数据，之前的数据应全部丢弃
+	ActionResync ActionType = "resync"
 
 	Separator = "/"
 )
@@ -35,75 +41,158 @@ var (
 )
 
 type Client interface {
-	connect(endpoints []string, opts ...opt) error
+	connect(endpoints []string, opts ...Option) error
 	Put(key, val string) error
 	PutTTL(key, val string, sec int64) error
 	Get(key string) (val string, err error)
 	GetNode(key string) (node *Node, err error)
 	Delete(key string) error
+	// 当前值等于 expectValue 时设置为 newValue，返回是否设置成功
+	CompareAndSwap(key, expectValue, newValue string) (swapped bool, err error)
+	// 当前 ModRevision 等于 expectRevision 时设置为 newValue，expectRevision 为 0 表示 key 不存在时设置
+	CompareRevisionAndSwap(key string, expectRevision int64, newValue string) (swapped bool, err error)
+	// key 不存在时设置，返回是否设置成功
+	PutIfAbsent(key, val string) (ok bool, err error)
+	// 多操作事务
+	Txn() Txn
 	DeleteDir(key string) error
 	Watch(ctx context.Context, key string, recursive bool) (ech chan *Event)
+	// 从指定 revision 开始监听，rev 为 0 时从当前开始
+	// 连接断开后自动从最后收到的 revision 继续监听，历史被压缩时发送 ActionResync 事件后继续
+	WatchFrom(ctx context.Context, key string, recursive bool, rev int64) (ech chan *Event)
 	KeepAlive(ctx context.Context, sec int64) (stopCh chan bool, err error)
+	// 创建租约并持续续约，通过 OpPutLease 将 key 绑定到租约
+	// ctx 结束时撤销租约，租约失效（撤销、过期或连接断开）时关闭 stopCh
+	KeepAliveLease(ctx context.Context, sec int64) (lease int64, stopCh chan bool, err error)
 	Close() error
 
-	NewLocker(key string, ttl int64) (sync.Locker, error) // ttl: not less than 5
+	NewLocker(key string, ttl int64) (Locker, error) // ttl: not less than 5
+
+	// 支持 context 的操作，ctx 结束时返回 ErrTimeout 或 ErrCanceled 类型的错误
+	// 与不带 context 的操作不同，GetCtx GetNodeCtx 在 key 不存在时返回 ErrNotFound 类型的错误
+	PutCtx(ctx context.Context, key, val string) error
+	PutTTLCtx(ctx context.Context, key, val string, sec int64) error
+	GetCtx(ctx context.Context, key string) (val string, err error)
+	GetNodeCtx(ctx context.Context, key string) (node *Node, err error)
+	DeleteCtx(ctx context.Context, key string) error
+	DeleteDirCtx(ctx context.Context, key string) error
+	CompareAndSwapCtx(ctx context.Context, key, expectValue, newValue string) (swapped bool, err error)
+	CompareRevisionAndSwapCtx(ctx context.Context, key string, expectRevision int64, newValue string) (swapped bool, err error)
+	PutIfAbsentCtx(ctx context.Context, key, val string) (ok bool, err error)
+	NewLockerCtx(ctx context.Context, key string, ttl int64) (Locker, error)
+}
+
+// 分布式锁，Lock 阻塞直到获取锁，TryLock LockWithTimeout 可以取消或限时
+type Locker interface {
+	sync.Locker
+	// 在 ctx 结束前尝试获取锁，ctx 结束时返回 ErrTimeout 或 ErrCanceled 类型的错误
+	TryLock(ctx context.Context) error
+	LockWithTimeout(timeout time.Duration) error
 }
 
 type Node struct {
-	Key            string  `json:"key,omitempty"`
-	Value          string  `json:"value,omitempty"`
-	Dir            bool    `json:"dir"`
-	Nodes          []*Node `json:"nodes,omitempty"`
-	TTL            int64   `json:"ttl,omitempty"`
-	CreateRevision int64   `json:"createrevision,omitempty"`
-	ModRevision    int64   `json:"modrevision,omitempty"`
+	Key            string  `json:"key,omitempty" yaml:"key,omitempty"`
+	Value          string  `json:"value,omitempty" yaml:"value,omitempty"`
+	Dir            bool    `json:"dir" yaml:"dir,omitempty"`
+	Nodes          []*Node `json:"nodes,omitempty" yaml:"nodes,omitempty"`
+	TTL            int64   `json:"ttl,omitempty" yaml:"ttl,omitempty"`
+	CreateRevision int64   `json:"createrevision,omitempty" yaml:"createrevision,omitempty"`
+	ModRevision    int64   `json:"modrevision,omitempty" yaml:"modrevision,omitempty"`
 }
 
 type Event struct {
 	Action      ActionType
 	Node        *Node
 	WatchStatus WatchStatus
+	// 事件对应的 revision，ActionResync 事件为重新加载时的 revision
+	Revision int64
 }
 
 type WatchStatus string
 type ActionType string
 
+// ActionResync 事件重新加载的 key，递归监听以 Separator 结尾的前缀时加载其上级节点
+func resyncKey(key string, recursive bool) string {
+	if recursive && key != Separator && strings.HasSuffix(key, Separator) {
+		return strings.TrimSuffix(key, Separator)
+	}
+	return key
+}
+
+// 将重新加载的节点调整为监听的 key，node 为 nil 时表示 key 不存在
+// 非递归监听时不包括子节点，以 Separator 结尾的前缀不包括上级节点自身的值
+func resyncNode(node *Node, key string, recursive bool) *Node {
+	if node == nil {
+		return &Node{Key: key}
+	}
+	if !recursive {
+		node.Nodes, node.Dir = nil, false
+		return node
+	}
+	if node.Key != key {
+		return &Node{Key: key, Dir: len(node.Nodes) > 0, Nodes: node.Nodes}
+	}
+	return node
+}
+
 type option struct {
 	user string
 	pass string
 	auth bool
+	tls  *tls.Config
 }
 
-type opt func(*option)
+// 客户端连接选项
+type Option func(*option)
 
-func optAuthEnable(enable bool) opt {
+func optAuthEnable(enable bool) Option {
 	return func(o *option) {
 		o.auth = enable
 	}
 }
 
-func optUserPass(user, pass string) opt {
+func optUserPass(user, pass string) Option {
 	return func(o *option) {
 		o.user = user
 		o.pass = pass
 	}
 }
 
-func New() (Client, error) {
+// 使用 TLS 连接，设置客户端证书时为 mTLS，可以与用户名密码认证同时使用
+func WithTLS(config *tls.Config) Option {
+	return func(o *option) {
+		o.tls = config
+	}
+}
+
+// 通过环境变量创建客户端
+// ETCDPATH 地址，多个地址以逗号分隔
+// ETCDUSER ETCDPASS 用户名及通过 EncryptKey 加密的密码
+// ETCDCACERT ETCDCERT ETCDKEY ETCDSERVERNAME ETCDINSECURE TLS 配置，参见 TLSOptionFromEnv
+func New(opts ...Option) (Client, error) {
 	etcdPath := os.Getenv("ETCDPATH")
 	if etcdPath == "" {
 		return nil, errors.New("ETCDPATH not set")
 	}
 	etcdUser := os.Getenv("ETCDUSER")
 	etcdPass := os.Getenv("ETCDPASS")
-	return newClient(etcdPath, etcdUser, etcdPass)
+	if to := TLSOptionFromEnv(); to != nil {
+		config, err := to.Config()
+		if err != nil {
+			return nil, err
+		}
+		// 参数指定的选项优先
+		opts = append([]Option{WithTLS(config)}, opts...)
+	}
+	return newClient(etcdPath, etcdUser, etcdPass, opts...)
 }
 
-func NewClient(addrs, user, pass string) (Client, error) {
-	return newClient(addrs, user, pass)
+// user 为空时不使用用户名密码认证，pass 为通过 EncryptKey 加密的密码
+func NewClient(addrs, user, pass string, opts ...Option) (Client, error) {
+	return newClient(addrs, user, pass, opts...)
 }
 
-func newClient(addrs, user, pass string) (Client, error) {
+func newClient(addrs, user, pass string, extopts ...Option) (Client, error) {
 	var cli Client
 	switch ClientVersion {
 	case 2:
@@ -124,16 +213,21 @@ func newClient(addrs, user, pass string) (Client, error) {
 	}
 	endpoints = strings.Split(etcdPath, ",")
 
-	var opts []opt
+	var opts []Option
 	etcdUser := user
 	etcdPass := pass
 	if etcdUser != "" && etcdPass != "" {
 		if EncryptKey == "" {
 			return nil, merrs.New("need etcd.EncryptKey")
 		}
-		etcdPass = crypto.AesDecrypt(etcdPass, EncryptKey)
+		var err error
+		etcdPass, err = crypto.AesDecryptE(etcdPass, EncryptKey)
+		if err != nil {
+			return nil, ErrAuth.New("decrypt etcd password error", err)
+		}
 		opts = append(opts, optAuthEnable(true), optUserPass(etcdUser, etcdPass))
 	}
+	opts = append(opts, extopts...)
 	if err := cli.connect(endpoints, opts...); err != nil {
 		return nil, err
 	}
@@ -154,6 +248,14 @@ func Get() (Client, error) {
 	return singleCli, nil
 }
 
+// 获取通过 Set 设置或 Get 创建的客户端，不存在时返回 nil，不会新建客户端
+func Current() Client {
+	singleCliMu.Lock()
+	defer singleCliMu.Unlock()
+
+	return singleCli
+}
+
 func Set(c Client) {
 	singleCliMu.Lock()
 	defer singleCliMu.Unlock()
@@ -0,0 +1,179 @@
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/wecisecode/util/merrs"
+	"gopkg.in/yaml.v3"
+)
+
+// 导出 prefix 及其所有子节点，prefix 不存在时返回只有 Key 的空节点
+func Export(ctx context.Context, cli Client, prefix string) (*Node, error) {
+	node, err := cli.GetNodeCtx(ctx, prefix)
+	if IsNotFound(err) {
+		return &Node{Key: prefix}, nil
+	}
+	return node, err
+}
+
+// 将节点树编码为 json 或 yaml 格式
+func MarshalNode(node *Node, format string) ([]byte, error) {
+	switch strings.ToLower(format) {
+	case "", "json":
+		bs, err := json.MarshalIndent(node, "", "  ")
+		if err != nil {
+			return nil, merrs.NewError(err)
+		}
+		return append(bs, '\n'), nil
+	case "yaml", "yml":
+		buf := &bytes.Buffer{}
+		enc := yaml.NewEncoder(buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(node); err != nil {
+			return nil, merrs.NewError(err)
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, merrs.NewError("unsupported format %s", format)
+}
+
+// 解析 json 或 yaml 格式的节点树
+func UnmarshalNode(bs []byte) (*Node, error) {
+	node := &Node{}
+	// json 是 yaml 的子集
+	if err := yaml.Unmarshal(bs, node); err != nil {
+		return nil, merrs.NewError(err)
+	}
+	if node.Key == "" {
+		return nil, merrs.NewError("root node key is empty")
+	}
+	return node, nil
+}
+
+// 导入选项
+type ImportOption struct {
+	// 导入到指定的 prefix 下，为空时使用导出时的 key
+	Prefix string
+	// 只计算变化，不修改 etcd
+	DryRun bool
+	// 删除 prefix 下导入数据中不存在的 key
+	Prune bool
+	// 导出时带有 TTL 的 key 以相同的 TTL 导入
+	PreserveTTL bool
+}
+
+// 导入产生的变化
+type Change struct {
+	Action ActionType `json:"action"`
+	Key    string     `json:"key"`
+	// 导入前 key 是否存在及其值
+	Exist    bool   `json:"exist,omitempty"`
+	OldValue string `json:"oldvalue,omitempty"`
+	Value    string `json:"value,omitempty"`
+	TTL      int64  `json:"ttl,omitempty"`
+}
+
+// 导入节点树，返回按 key 排序的变化，值相同的 key 不做修改
+// 出错时返回已完成的变化
+func Import(ctx context.Context, cli Client, node *Node, opt *ImportOption) (changes []*Change, err error) {
+	if opt == nil {
+		opt = &ImportOption{}
+	}
+	root := node.Key
+	target := root
+	if opt.Prefix != "" {
+		target = opt.Prefix
+	}
+	imports := map[string]*Node{}
+	for k, n := range flattenNode(node) {
+		rel, ok := subKey(root, k)
+		if !ok {
+			return nil, merrs.NewError("key %s is not under root %s", k, root)
+		}
+		imports[joinKey(target, rel)] = n
+	}
+	current, err := Export(ctx, cli, target)
+	if err != nil {
+		return nil, err
+	}
+	currents := flattenNode(current)
+	for k, n := range imports {
+		c, exist := currents[k]
+		ttl := int64(0)
+		if opt.PreserveTTL {
+			ttl = n.TTL
+		}
+		if exist && c.Value == n.Value && (ttl == 0 || c.TTL > 0) {
+			continue
+		}
+		change := &Change{Action: ActionPut, Key: k, Exist: exist, Value: n.Value, TTL: ttl}
+		if exist {
+			change.OldValue = c.Value
+		}
+		changes = append(changes, change)
+	}
+	if opt.Prune {
+		for k, c := range currents {
+			if _, ok := imports[k]; !ok {
+				changes = append(changes, &Change{Action: ActionDelete, Key: k, Exist: true, OldValue: c.Value})
+			}
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	if opt.DryRun {
+		return changes, nil
+	}
+	for i, change := range changes {
+		switch {
+		case change.Action == ActionDelete:
+			err = cli.DeleteCtx(ctx, change.Key)
+		case change.TTL > 0:
+			err = cli.PutTTLCtx(ctx, change.Key, change.Value, change.TTL)
+		default:
+			err = cli.PutCtx(ctx, change.Key, change.Value)
+		}
+		if err != nil {
+			return changes[:i], err
+		}
+	}
+	return changes, nil
+}
+
+// key 相对于 root 的部分，key 等于 root 时为空，key 不在 root 下时返回 false
+func subKey(root, key string) (string, bool) {
+	if key == root {
+		return "", true
+	}
+	prefix := strings.TrimSuffix(root, Separator) + Separator
+	if !strings.HasPrefix(key, prefix) {
+		return "", false
+	}
+	return key[len(prefix):], true
+}
+
+func joinKey(root, rel string) string {
+	if rel == "" {
+		return root
+	}
+	return strings.TrimSuffix(root, Separator) + Separator + rel
+}
+
+// 节点树中实际存在的 key，只有子节点的目录不包括在内
+func flattenNode(node *Node) map[string]*Node {
+	m := map[string]*Node{}
+	nodes := []*Node{node}
+	for i := 0; i < len(nodes); i++ {
+		n := nodes[i]
+		nodes = append(nodes, n.Nodes...)
+		if n.ModRevision != 0 || n.Value != "" || !n.Dir && len(n.Nodes) == 0 && n != node {
+			m[n.Key] = n
+		}
+	}
+	return m
+}
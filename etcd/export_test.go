@@ -0,0 +1,82 @@
+package etcd_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wecisecode/util/etcd"
+)
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	src := etcd.NewMemClient()
+	defer src.Close()
+	assert.Nil(t, src.Put("/dev/app", "a"))
+	assert.Nil(t, src.Put("/dev/app/db/host", "127.0.0.1"))
+	assert.Nil(t, src.PutTTL("/dev/app/lease", "x", 60))
+
+	node, err := etcd.Export(ctx, src, "/dev/app")
+	assert.Nil(t, err)
+	for _, format := range []string{"json", "yaml"} {
+		bs, err := etcd.MarshalNode(node, format)
+		assert.Nil(t, err)
+		n, err := etcd.UnmarshalNode(bs)
+		assert.Nil(t, err)
+		assert.Equal(t, node, n)
+	}
+
+	dst := etcd.NewMemClient()
+	defer dst.Close()
+	assert.Nil(t, dst.Put("/prod/app/db/host", "10.0.0.1"))
+	assert.Nil(t, dst.Put("/prod/app/old", "o"))
+
+	opt := &etcd.ImportOption{Prefix: "/prod/app", DryRun: true, Prune: true, PreserveTTL: true}
+	changes, err := etcd.Import(ctx, dst, node, opt)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(changes))
+	assert.Equal(t, "/prod/app", changes[0].Key)
+	assert.False(t, changes[0].Exist)
+	assert.Equal(t, "10.0.0.1", changes[1].OldValue)
+	assert.Equal(t, "127.0.0.1", changes[1].Value)
+	assert.Equal(t, int64(60), changes[2].TTL)
+	assert.Equal(t, etcd.ActionDelete, changes[3].Action)
+	v, _ := dst.Get("/prod/app/db/host")
+	assert.Equal(t, "10.0.0.1", v)
+
+	opt.DryRun = false
+	changes, err = etcd.Import(ctx, dst, node, opt)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(changes))
+	v, _ = dst.Get("/prod/app/db/host")
+	assert.Equal(t, "127.0.0.1", v)
+	v, _ = dst.Get("/prod/app/old")
+	assert.Equal(t, "", v)
+	n, _ := dst.GetNode("/prod/app/lease")
+	assert.Equal(t, int64(60), n.TTL)
+
+	changes, err = etcd.Import(ctx, dst, node, opt)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(changes))
+}
+
+func TestImportKeyOutsideRoot(t *testing.T) {
+	ctx := context.Background()
+	dst := etcd.NewMemClient()
+	defer dst.Close()
+	for _, key := range []string{"/a", "/app/configx"} {
+		node := &etcd.Node{Key: "/app/config", Dir: true, Nodes: []*etcd.Node{{Key: key, Value: "v"}}}
+		_, err := etcd.Import(ctx, dst, node, &etcd.ImportOption{Prefix: "/prod"})
+		assert.NotNil(t, err)
+	}
+	v, _ := dst.Get("/prod")
+	assert.Equal(t, "", v)
+
+	// 根节点为 / 时导入到指定 prefix 下
+	node := &etcd.Node{Key: "/", Dir: true, Nodes: []*etcd.Node{{Key: "/a", Value: "v"}}}
+	changes, err := etcd.Import(ctx, dst, node, &etcd.ImportOption{Prefix: "/prod"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(changes))
+	v, _ = dst.Get("/prod/a")
+	assert.Equal(t, "v", v)
+}
@@ -0,0 +1,807 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 进程内存中模拟的 etcd 客户端，用于单元测试
+// 与 v3 客户端语义一致：全局递增的 revision，TTL 租约到期自动删除并产生删除事件，
+// 递归 Watch 按 key 前缀匹配，DeleteDir 删除 key 及 key/ 下的所有子节点，NewLocker 互斥锁
+//
+//	etcd.Set(etcd.NewMemClient())
+type MemClient struct {
+	mutex    sync.Mutex
+	closed   bool
+	revision int64
+	leaseid  int64
+	kvs      map[string]*memKV
+	leases   map[int64]*memLease
+	watchers map[*memWatcher]struct{}
+	lockers  map[string]chan struct{}
+	// 事件历史，用于 WatchFrom，通过 Compact 清理，超出 2*historyWindow 个 revision 时自动压缩到最近 historyWindow 个
+	history         []*Event
+	historyWindow   int64
+	compactRevision int64
+}
+
+// 默认保留的事件历史 revision 数
+const DefaultMemHistoryWindow = 10000
+
+type memKV struct {
+	value          string
+	lease          int64
+	createRevision int64
+	modRevision    int64
+}
+
+type memLease struct {
+	id     int64
+	ttl    int64
+	expire time.Time
+	timer  *time.Timer
+	keys   map[string]struct{}
+	// 租约失效时关闭
+	done chan struct{}
+}
+
+type memWatcher struct {
+	key       string
+	recursive bool
+	ch        chan *Event
+	mutex     sync.Mutex
+	pending   []*Event
+	notify    chan struct{}
+}
+
+var _ Client = &MemClient{}
+
+func NewMemClient() *MemClient {
+	return &MemClient{
+		kvs:      map[string]*memKV{},
+		leases:   map[int64]*memLease{},
+		watchers: map[*memWatcher]struct{}{},
+		lockers:  map[string]chan struct{}{},
+
+		historyWindow: DefaultMemHistoryWindow,
+	}
+}
+
+// 设置至少保留的事件历史 revision 数，超出两倍时自动压缩，小于等于 0 时不自动压缩
+func (c *MemClient) SetHistoryWindow(revisions int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.historyWindow = revisions
+	c.autoCompact()
+}
+
+func (c *MemClient) connect(endpoints []string, opts ...Option) error {
+	return nil
+}
+
+// 压缩 rev 之前的事件历史，之后 WatchFrom 小于 rev 的 revision 时将收到 ActionResync 事件
+func (c *MemClient) Compact(rev int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.compact(rev)
+}
+
+// 调用前需持有 c.mutex
+func (c *MemClient) compact(rev int64) {
+	if rev > c.revision {
+		rev = c.revision
+	}
+	if rev <= c.compactRevision {
+		return
+	}
+	c.compactRevision = rev
+	i := sort.Search(len(c.history), func(i int) bool {
+		return c.history[i].Revision >= rev
+	})
+	c.history = append([]*Event(nil), c.history[i:]...)
+}
+
+// 当前 revision
+func (c *MemClient) Revision() int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.revision
+}
+
+func (c *MemClient) checkClosed() error {
+	if c.closed {
+		return ErrClosed.New("etcd client closed")
+	}
+	return nil
+}
+
+// 与 etcd 客户端一致，ctx 已结束时不执行操作
+func checkContext(ctx context.Context) error {
+	return convertError(ctx.Err())
+}
+
+func (c *MemClient) Put(key, val string) error {
+	return c.PutCtx(context.Background(), key, val)
+}
+
+func (c *MemClient) PutCtx(ctx context.Context, key, val string) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.checkClosed(); err != nil {
+		return err
+	}
+	c.revision++
+	c.put(key, val, 0)
+	return nil
+}
+
+func (c *MemClient) PutTTL(key, val string, sec int64) error {
+	return c.PutTTLCtx(context.Background(), key, val, sec)
+}
+
+func (c *MemClient) PutTTLCtx(ctx context.Context, key, val string, sec int64) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.checkClosed(); err != nil {
+		return err
+	}
+	lease := c.grant(sec)
+	c.revision++
+	c.put(key, val, lease.id)
+	return nil
+}
+
+func (c *MemClient) Get(key string) (val string, err error) {
+	val, err = c.GetCtx(context.Background(), key)
+	if IsNotFound(err) {
+		return "", nil
+	}
+	return
+}
+
+func (c *MemClient) GetCtx(ctx context.Context, key string) (val string, err error) {
+	if err := checkContext(ctx); err != nil {
+		return "", err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.checkClosed(); err != nil {
+		return "", err
+	}
+	if kv, ok := c.kvs[key]; ok {
+		return kv.value, nil
+	}
+	return "", ErrNotFound.New("key %s not found", key)
+}
+
+func (c *MemClient) GetNode(key string) (node *Node, err error) {
+	node, err = c.GetNodeCtx(context.Background(), key)
+	if IsNotFound(err) {
+		return &Node{Key: key}, nil
+	}
+	return
+}
+
+func (c *MemClient) GetNodeCtx(ctx context.Context, key string) (node *Node, err error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.checkClosed(); err != nil {
+		return nil, err
+	}
+	node, ok := c.getNode(key)
+	if !ok {
+		return nil, ErrNotFound.New("key %s not found", key)
+	}
+	return node, nil
+}
+
+func (c *MemClient) getNodeRevision(ctx context.Context, key string) (node *Node, rev int64, err error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, 0, err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.checkClosed(); err != nil {
+		return nil, 0, err
+	}
+	node, ok := c.getNode(key)
+	if !ok {
+		return nil, c.revision, ErrNotFound.New("key %s not found", key)
+	}
+	return node, c.revision, nil
+}
+
+func (c *MemClient) fillNode(node *Node, kv *memKV) {
+	node.Value = kv.value
+	node.CreateRevision = kv.createRevision
+	node.ModRevision = kv.modRevision
+	if kv.lease != 0 {
+		node.TTL = c.getTTL(kv.lease)
+	}
+}
+
+// 调用前需持有 c.mutex，key 及其子节点都不存在时返回 false
+func (c *MemClient) getNode(key string) (*Node, bool) {
+	top := &Node{Key: key}
+	kv, exists := c.kvs[key]
+	if exists {
+		c.fillNode(top, kv)
+	}
+	prefixKey := key + Separator
+	if key == Separator {
+		prefixKey = Separator
+	}
+	keys := make([]string, 0)
+	for k := range c.kvs {
+		if k != Separator && strings.HasPrefix(k, prefixKey) {
+			keys = append(keys, k)
+		}
+	}
+	if !exists && len(keys) == 0 {
+		return top, false
+	}
+	sort.Strings(keys)
+	nodes := map[string]*Node{key: top}
+	for _, k := range keys {
+		parent := top
+		rel := strings.Split(k[len(prefixKey):], Separator)
+		for i := range rel {
+			nk := prefixKey + strings.Join(rel[:i+1], Separator)
+			n := nodes[nk]
+			if n == nil {
+				n = &Node{Key: nk}
+				nodes[nk] = n
+				parent.Nodes = append(parent.Nodes, n)
+				parent.Dir = true
+			}
+			if nk == k {
+				c.fillNode(n, c.kvs[k])
+			}
+			parent = n
+		}
+	}
+	return top, true
+}
+
+func (c *MemClient) Delete(key string) error {
+	return c.DeleteCtx(context.Background(), key)
+}
+
+func (c *MemClient) DeleteCtx(ctx context.Context, key string) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.checkClosed(); err != nil {
+		return err
+	}
+	if _, ok := c.kvs[key]; ok {
+		c.revision++
+		c.delete(key)
+	}
+	return nil
+}
+
+func (c *MemClient) DeleteDir(key string) error {
+	return c.DeleteDirCtx(context.Background(), key)
+}
+
+func (c *MemClient) DeleteDirCtx(ctx context.Context, key string) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.checkClosed(); err != nil {
+		return err
+	}
+	if keys := c.dirKeys(key); len(keys) > 0 {
+		c.revision++
+		for _, k := range keys {
+			c.delete(k)
+		}
+	}
+	return nil
+}
+
+func (c *MemClient) CompareAndSwap(key, expectValue, newValue string) (bool, error) {
+	return compareAndSwap(context.Background(), c, key, expectValue, newValue)
+}
+
+func (c *MemClient) CompareAndSwapCtx(ctx context.Context, key, expectValue, newValue string) (bool, error) {
+	return compareAndSwap(ctx, c, key, expectValue, newValue)
+}
+
+func (c *MemClient) CompareRevisionAndSwap(key string, expectRevision int64, newValue string) (bool, error) {
+	return compareRevisionAndSwap(context.Background(), c, key, expectRevision, newValue)
+}
+
+func (c *MemClient) CompareRevisionAndSwapCtx(ctx context.Context, key string, expectRevision int64, newValue string) (bool, error) {
+	return compareRevisionAndSwap(ctx, c, key, expectRevision, newValue)
+}
+
+func (c *MemClient) PutIfAbsent(key, val string) (bool, error) {
+	return putIfAbsent(context.Background(), c, key, val)
+}
+
+func (c *MemClient) PutIfAbsentCtx(ctx context.Context, key, val string) (bool, error) {
+	return putIfAbsent(ctx, c, key, val)
+}
+
+type memTxn struct {
+	txnOps
+	client *MemClient
+}
+
+func (c *MemClient) Txn() Txn {
+	return &memTxn{client: c}
+}
+
+func (t *memTxn) If(cmps ...Cmp) Txn {
+	t.txnOps.If(cmps...)
+	return t
+}
+
+func (t *memTxn) Then(ops ...Op) Txn {
+	t.txnOps.Then(ops...)
+	return t
+}
+
+func (t *memTxn) Else(ops ...Op) Txn {
+	t.txnOps.Else(ops...)
+	return t
+}
+
+func (t *memTxn) Commit() (*TxnResponse, error) {
+	return t.CommitCtx(context.Background())
+}
+
+func (t *memTxn) CommitCtx(ctx context.Context) (*TxnResponse, error) {
+	c := t.client
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.checkClosed(); err != nil {
+		return nil, err
+	}
+	resp := &TxnResponse{Succeeded: true}
+	for _, cmp := range t.cmps {
+		if !c.compare(cmp) {
+			resp.Succeeded = false
+			break
+		}
+	}
+	ops := t.thenOps
+	if !resp.Succeeded {
+		ops = t.elseOps
+	}
+	for _, op := range ops {
+		if op.Type == OpTypePut && op.Lease != 0 && c.leases[op.Lease] == nil {
+			return nil, ErrNotFound.New("lease %d not found", op.Lease)
+		}
+	}
+	// 事务中的所有修改使用同一个 revision，与 etcd 一致，没有修改时 revision 不变
+	for _, op := range ops {
+		if c.changes(op) {
+			c.revision++
+			break
+		}
+	}
+	for _, op := range ops {
+		switch op.Type {
+		case OpTypeGet:
+			var node *Node
+			if kv, ok := c.kvs[op.Key]; ok {
+				node = &Node{Key: op.Key}
+				c.fillNode(node, kv)
+			}
+			resp.Nodes = append(resp.Nodes, node)
+		case OpTypePut:
+			leaseid := op.Lease
+			if op.TTL > 0 {
+				leaseid = c.grant(op.TTL).id
+			}
+			c.put(op.Key, op.Value, leaseid)
+		case OpTypeDelete:
+			if op.Prefix {
+				for _, k := range c.dirKeys(op.Key) {
+					c.delete(k)
+				}
+			} else {
+				c.delete(op.Key)
+			}
+		}
+	}
+	resp.Revision = c.revision
+	return resp, nil
+}
+
+func (c *MemClient) Watch(ctx context.Context, key string, recursive bool) (ech chan *Event) {
+	return c.WatchFrom(ctx, key, recursive, 0)
+}
+
+func (c *MemClient) WatchFrom(ctx context.Context, key string, recursive bool, rev int64) (ech chan *Event) {
+	w := &memWatcher{
+		key:       key,
+		recursive: recursive,
+		ch:        make(chan *Event, 5),
+		notify:    make(chan struct{}, 1),
+	}
+	c.mutex.Lock()
+	closed := c.closed
+	if !closed {
+		c.watchers[w] = struct{}{}
+		if rev > 0 && rev < c.compactRevision {
+			node, ok := c.getNode(resyncKey(key, recursive))
+			if !ok {
+				node = nil
+			}
+			node = resyncNode(node, key, recursive)
+			w.send(&Event{Action: ActionResync, Node: node, WatchStatus: WatchStatusCompacted, Revision: c.revision})
+		} else if rev > 0 {
+			for _, evt := range c.history {
+				if evt.Revision >= rev && w.match(evt) {
+					w.send(evt)
+				}
+			}
+		}
+	}
+	c.mutex.Unlock()
+	if closed {
+		close(w.ch)
+		return w.ch
+	}
+	go func() {
+		defer func() {
+			c.mutex.Lock()
+			delete(c.watchers, w)
+			c.mutex.Unlock()
+			close(w.ch)
+		}()
+		for {
+			w.mutex.Lock()
+			evts := w.pending
+			w.pending = nil
+			w.mutex.Unlock()
+			for _, evt := range evts {
+				if evt == nil {
+					return
+				}
+				select {
+				case w.ch <- evt:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case <-w.notify:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return w.ch
+}
+
+func (c *MemClient) KeepAlive(ctx context.Context, sec int64) (stopCh chan bool, err error) {
+	_, stopCh, err = c.KeepAliveLease(ctx, sec)
+	return
+}
+
+func (c *MemClient) KeepAliveLease(ctx context.Context, sec int64) (leaseid int64, stopCh chan bool, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.checkClosed(); err != nil {
+		return 0, nil, err
+	}
+	lease := c.grant(sec)
+	c.keepalive(lease)
+	stopCh = make(chan bool)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.mutex.Lock()
+			c.revoke(lease.id)
+			c.mutex.Unlock()
+		case <-lease.done:
+		}
+		close(stopCh)
+	}()
+	return lease.id, stopCh, nil
+}
+
+// 撤销 key 绑定的租约，租约上的所有 key 被删除，用于模拟租约丢失，key 未绑定租约时返回 false
+func (c *MemClient) ExpireLease(key string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	kv := c.kvs[key]
+	if kv == nil || c.leases[kv.lease] == nil {
+		return false
+	}
+	c.revoke(kv.lease)
+	return true
+}
+
+// 关闭客户端，所有 Watch 通道关闭，租约随之失效
+func (c *MemClient) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	for _, lease := range c.leases {
+		lease.timer.Stop()
+		close(lease.done)
+	}
+	c.leases = map[int64]*memLease{}
+	for w := range c.watchers {
+		w.send(nil)
+	}
+	return nil
+}
+
+func (c *MemClient) NewLocker(key string, ttl int64) (Locker, error) {
+	return c.NewLockerCtx(context.Background(), key, ttl)
+}
+
+func (c *MemClient) NewLockerCtx(ctx context.Context, key string, ttl int64) (Locker, error) {
+	if ttl < 1 {
+		ttl = 60
+	}
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.checkClosed(); err != nil {
+		return nil, err
+	}
+	lk := c.lockers[key]
+	if lk == nil {
+		lk = make(chan struct{}, 1)
+		c.lockers[key] = lk
+	}
+	return &memLocker{client: c, key: key, ttl: ttl, lk: lk}, nil
+}
+
+type memLocker struct {
+	client *MemClient
+	key    string
+	ttl    int64
+	lk     chan struct{}
+	lease  int64
+}
+
+func (locker *memLocker) Lock() {
+	locker.lk <- struct{}{}
+	locker.locked()
+}
+
+func (locker *memLocker) TryLock(ctx context.Context) error {
+	select {
+	case locker.lk <- struct{}{}:
+		locker.locked()
+		return nil
+	case <-ctx.Done():
+		return convertError(ctx.Err())
+	}
+}
+
+func (locker *memLocker) LockWithTimeout(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return locker.TryLock(ctx)
+}
+
+func (locker *memLocker) locked() {
+	c := locker.client
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	// 与 concurrency.Mutex 一致，持有锁期间存在 key/leaseid 节点
+	lease := c.grant(locker.ttl)
+	c.keepalive(lease)
+	locker.lease = lease.id
+	c.revision++
+	c.put(fmt.Sprintf("%s/%x", locker.key, lease.id), "", lease.id)
+}
+
+func (locker *memLocker) Unlock() {
+	c := locker.client
+	c.mutex.Lock()
+	c.revoke(locker.lease)
+	locker.lease = 0
+	c.mutex.Unlock()
+	<-locker.lk
+}
+
+// 以下方法调用前需持有 c.mutex
+
+func (c *MemClient) compare(cmp Cmp) bool {
+	kv := c.kvs[cmp.Key]
+	switch cmp.Target {
+	case CmpTargetValue:
+		// 与 etcd 一致，key 不存在时值比较不成立
+		return kv != nil && compareString(cmp.Result, kv.value, cmp.Value)
+	case CmpTargetCreateRevision:
+		rev := int64(0)
+		if kv != nil {
+			rev = kv.createRevision
+		}
+		return compareInt(cmp.Result, rev, cmp.Revision)
+	case CmpTargetModRevision:
+		rev := int64(0)
+		if kv != nil {
+			rev = kv.modRevision
+		}
+		return compareInt(cmp.Result, rev, cmp.Revision)
+	}
+	return false
+}
+
+// op 是否会修改数据
+func (c *MemClient) changes(op Op) bool {
+	switch op.Type {
+	case OpTypePut:
+		return true
+	case OpTypeDelete:
+		if op.Prefix {
+			return len(c.dirKeys(op.Key)) > 0
+		}
+		return c.kvs[op.Key] != nil
+	}
+	return false
+}
+
+// key 及 key/ 下的所有子节点，按 key 排序
+func (c *MemClient) dirKeys(key string) []string {
+	keys := []string{}
+	for k := range c.kvs {
+		if k == key || strings.HasPrefix(k, key+Separator) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (c *MemClient) put(key, val string, leaseid int64) {
+	kv := c.kvs[key]
+	if kv == nil {
+		kv = &memKV{createRevision: c.revision}
+		c.kvs[key] = kv
+	} else if kv.lease != 0 && kv.lease != leaseid {
+		if lease := c.leases[kv.lease]; lease != nil {
+			delete(lease.keys, key)
+		}
+	}
+	kv.value = val
+	kv.lease = leaseid
+	kv.modRevision = c.revision
+	if lease := c.leases[leaseid]; lease != nil {
+		lease.keys[key] = struct{}{}
+	}
+	node := &Node{Key: key, Value: val, CreateRevision: kv.createRevision, ModRevision: kv.modRevision}
+	if leaseid != 0 {
+		node.TTL = c.getTTL(leaseid)
+	}
+	c.notify(&Event{Action: ActionPut, Node: node, WatchStatus: WatchStatusOK, Revision: c.revision})
+}
+
+func (c *MemClient) delete(key string) {
+	kv := c.kvs[key]
+	if kv == nil {
+		return
+	}
+	delete(c.kvs, key)
+	if lease := c.leases[kv.lease]; lease != nil {
+		delete(lease.keys, key)
+	}
+	c.notify(&Event{Action: ActionDelete, Node: &Node{Key: key, ModRevision: c.revision}, WatchStatus: WatchStatusOK, Revision: c.revision})
+}
+
+func (c *MemClient) notify(evt *Event) {
+	c.history = append(c.history, evt)
+	c.autoCompact()
+	for w := range c.watchers {
+		if w.match(evt) {
+			w.send(evt)
+		}
+	}
+}
+
+func (c *MemClient) autoCompact() {
+	if c.historyWindow > 0 && c.revision-c.compactRevision > 2*c.historyWindow {
+		c.compact(c.revision - c.historyWindow)
+	}
+}
+
+func (w *memWatcher) match(evt *Event) bool {
+	return w.key == evt.Node.Key || w.recursive && strings.HasPrefix(evt.Node.Key, w.key)
+}
+
+func (w *memWatcher) send(evt *Event) {
+	w.mutex.Lock()
+	w.pending = append(w.pending, evt)
+	w.mutex.Unlock()
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (c *MemClient) grant(sec int64) *memLease {
+	c.leaseid++
+	lease := &memLease{
+		id:     c.leaseid,
+		ttl:    sec,
+		expire: time.Now().Add(time.Duration(sec) * time.Second),
+		keys:   map[string]struct{}{},
+		done:   make(chan struct{}),
+	}
+	id := lease.id
+	lease.timer = time.AfterFunc(time.Duration(sec)*time.Second, func() {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		if !c.closed {
+			c.revoke(id)
+		}
+	})
+	c.leases[lease.id] = lease
+	return lease
+}
+
+// 持续续约，租约不会到期
+func (c *MemClient) keepalive(lease *memLease) {
+	lease.timer.Stop()
+	lease.expire = time.Time{}
+}
+
+func (c *MemClient) revoke(leaseid int64) {
+	lease := c.leases[leaseid]
+	if lease == nil {
+		return
+	}
+	lease.timer.Stop()
+	close(lease.done)
+	delete(c.leases, leaseid)
+	if len(lease.keys) > 0 {
+		keys := make([]string, 0, len(lease.keys))
+		for k := range lease.keys {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		c.revision++
+		for _, k := range keys {
+			c.delete(k)
+		}
+	}
+}
+
+func (c *MemClient) getTTL(leaseid int64) int64 {
+	lease := c.leases[leaseid]
+	if lease == nil {
+		return 0
+	}
+	if lease.expire.IsZero() {
+		return lease.ttl
+	}
+	return int64(math.Ceil(time.Until(lease.expire).Seconds()))
+}
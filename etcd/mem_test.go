@@ -0,0 +1,224 @@
+package etcd_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wecisecode/util/etcd"
+)
+
+func TestMemClient(t *testing.T) {
+	cli := etcd.NewMemClient()
+	defer cli.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := cli.Watch(ctx, "/a", true)
+
+	assert.Nil(t, cli.Put("/a/b", "1"))
+	assert.Nil(t, cli.Put("/a/c/d", "2"))
+	assert.Nil(t, cli.Put("/a/b", "3"))
+	assert.Equal(t, int64(3), cli.Revision())
+
+	v, err := cli.Get("/a/b")
+	assert.Nil(t, err)
+	assert.Equal(t, "3", v)
+
+	node, err := cli.GetNode("/a")
+	assert.Nil(t, err)
+	assert.True(t, node.Dir)
+	assert.Equal(t, 2, len(node.Nodes))
+	assert.Equal(t, "/a/b", node.Nodes[0].Key)
+	assert.Equal(t, int64(1), node.Nodes[0].CreateRevision)
+	assert.Equal(t, int64(3), node.Nodes[0].ModRevision)
+	assert.Equal(t, "/a/c/d", node.Nodes[1].Nodes[0].Key)
+	assert.Equal(t, "2", node.Nodes[1].Nodes[0].Value)
+
+	for _, value := range []string{"1", "2", "3"} {
+		evt := <-ch
+		assert.Equal(t, etcd.ActionPut, evt.Action)
+		assert.Equal(t, value, evt.Node.Value)
+	}
+
+	assert.Nil(t, cli.DeleteDir("/a/c"))
+	evt := <-ch
+	assert.Equal(t, etcd.ActionDelete, evt.Action)
+	assert.Equal(t, "/a/c/d", evt.Node.Key)
+
+	assert.Nil(t, cli.PutTTL("/a/ttl", "x", 1))
+	node, _ = cli.GetNode("/a/ttl")
+	assert.Equal(t, int64(1), node.TTL)
+	assert.Equal(t, etcd.ActionPut, (<-ch).Action)
+	evt = <-ch
+	assert.Equal(t, etcd.ActionDelete, evt.Action)
+	assert.Equal(t, "/a/ttl", evt.Node.Key)
+
+	cancel()
+	_, ok := <-ch
+	assert.False(t, ok)
+}
+
+func TestMemClientLocker(t *testing.T) {
+	cli := etcd.NewMemClient()
+	defer cli.Close()
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	count, running := 0, 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lk, err := cli.NewLocker("/lock", 5)
+			assert.Nil(t, err)
+			lk.Lock()
+			mutex.Lock()
+			running++
+			assert.Equal(t, 1, running)
+			mutex.Unlock()
+			time.Sleep(time.Millisecond)
+			mutex.Lock()
+			running--
+			count++
+			mutex.Unlock()
+			lk.Unlock()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 10, count)
+	node, _ := cli.GetNode("/lock")
+	assert.Equal(t, 0, len(node.Nodes))
+}
+
+func TestMemClientTxn(t *testing.T) {
+	cli := etcd.NewMemClient()
+	defer cli.Close()
+
+	ok, err := cli.PutIfAbsent("/k", "1")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, _ = cli.PutIfAbsent("/k", "2")
+	assert.False(t, ok)
+
+	ok, _ = cli.CompareAndSwap("/k", "0", "2")
+	assert.False(t, ok)
+	ok, _ = cli.CompareAndSwap("/k", "1", "2")
+	assert.True(t, ok)
+
+	node, _ := cli.GetNode("/k")
+	ok, _ = cli.CompareRevisionAndSwap("/k", node.ModRevision-1, "3")
+	assert.False(t, ok)
+	ok, _ = cli.CompareRevisionAndSwap("/k", node.ModRevision, "3")
+	assert.True(t, ok)
+
+	rev := cli.Revision()
+	resp, err := cli.Txn().
+		If(etcd.CmpValue("/k", "=", "3"), etcd.CmpNotExist("/x")).
+		Then(etcd.OpPut("/x", "x"), etcd.OpPut("/y", "y"), etcd.OpDelete("/k"), etcd.OpGet("/x")).
+		Else(etcd.OpGet("/k")).
+		Commit()
+	assert.Nil(t, err)
+	assert.True(t, resp.Succeeded)
+	assert.Equal(t, rev+1, resp.Revision)
+	assert.Equal(t, "x", resp.Nodes[0].Value)
+	assert.Equal(t, resp.Revision, resp.Nodes[0].ModRevision)
+
+	resp, _ = cli.Txn().If(etcd.CmpNotExist("/x")).Then(etcd.OpPut("/x", "z")).Else(etcd.OpGet("/x"), etcd.OpGet("/k")).Commit()
+	assert.False(t, resp.Succeeded)
+	assert.Equal(t, "x", resp.Nodes[0].Value)
+	assert.Nil(t, resp.Nodes[1])
+
+	// 没有修改的事务及删除不存在的 key 不改变 revision
+	rev = cli.Revision()
+	resp, _ = cli.Txn().If(etcd.CmpNotExist("/x")).Then(etcd.OpPut("/x", "z")).Commit()
+	assert.False(t, resp.Succeeded)
+	assert.Equal(t, rev, resp.Revision)
+	resp, _ = cli.Txn().Then(etcd.OpDelete("/none"), etcd.OpDeleteDir("/none")).Commit()
+	assert.Equal(t, rev, resp.Revision)
+	assert.Nil(t, cli.Delete("/none"))
+	assert.Equal(t, rev, cli.Revision())
+}
+
+func TestMemClientHistoryWindow(t *testing.T) {
+	cli := etcd.NewMemClient()
+	defer cli.Close()
+	cli.SetHistoryWindow(10)
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, cli.Put("/h", "v"))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	evt := <-cli.WatchFrom(ctx, "/h", false, 95)
+	assert.Equal(t, etcd.ActionPut, evt.Action)
+	assert.Equal(t, int64(95), evt.Revision)
+	evt = <-cli.WatchFrom(ctx, "/h", false, 50)
+	assert.Equal(t, etcd.ActionResync, evt.Action)
+}
+
+func TestMemClientContext(t *testing.T) {
+	cli := etcd.NewMemClient()
+
+	_, err := cli.GetCtx(context.Background(), "/none")
+	assert.True(t, etcd.IsNotFound(err))
+	_, err = cli.GetNodeCtx(context.Background(), "/none")
+	assert.True(t, etcd.IsNotFound(err))
+	v, err := cli.Get("/none")
+	assert.Nil(t, err)
+	assert.Equal(t, "", v)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = cli.PutCtx(ctx, "/k", "v")
+	assert.True(t, etcd.IsCanceled(err))
+
+	lk1, _ := cli.NewLocker("/lock", 5)
+	lk2, _ := cli.NewLocker("/lock", 5)
+	assert.Nil(t, lk1.LockWithTimeout(time.Second))
+	err = lk2.LockWithTimeout(10 * time.Millisecond)
+	assert.True(t, etcd.IsTimeout(err))
+	lk1.Unlock()
+	assert.Nil(t, lk2.LockWithTimeout(time.Second))
+	lk2.Unlock()
+
+	cli.Close()
+	err = cli.Put("/k", "v")
+	assert.True(t, etcd.IsConnectionError(err))
+}
+
+func TestMemClientWatchFrom(t *testing.T) {
+	cli := etcd.NewMemClient()
+	defer cli.Close()
+
+	assert.Nil(t, cli.Put("/w/a", "1"))
+	assert.Nil(t, cli.Put("/w/b", "2"))
+	assert.Nil(t, cli.Delete("/w/a"))
+	assert.Nil(t, cli.Put("/x", "x"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := cli.WatchFrom(ctx, "/w", true, 2)
+	evt := <-ch
+	assert.Equal(t, etcd.ActionPut, evt.Action)
+	assert.Equal(t, "/w/b", evt.Node.Key)
+	assert.Equal(t, int64(2), evt.Revision)
+	evt = <-ch
+	assert.Equal(t, etcd.ActionDelete, evt.Action)
+	assert.Equal(t, int64(3), evt.Node.ModRevision)
+	assert.Nil(t, cli.Put("/w/c", "3"))
+	evt = <-ch
+	assert.Equal(t, int64(5), evt.Revision)
+
+	cli.Compact(4)
+	ch = cli.WatchFrom(ctx, "/w", true, 2)
+	evt = <-ch
+	assert.Equal(t, etcd.ActionResync, evt.Action)
+	assert.Equal(t, etcd.WatchStatusCompacted, evt.WatchStatus)
+	assert.Equal(t, int64(5), evt.Revision)
+	assert.Equal(t, 2, len(evt.Node.Nodes))
+	assert.Nil(t, cli.Put("/w/d", "4"))
+	evt = <-ch
+	assert.Equal(t, "/w/d", evt.Node.Key)
+}
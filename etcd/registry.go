@@ -0,0 +1,255 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 服务实例信息，以 JSON 格式保存在 prefix/service/id
+type ServiceInstance struct {
+	ID   string            `json:"id"`
+	Addr string            `json:"addr"`
+	Meta map[string]string `json:"meta,omitempty"`
+}
+
+// 服务注册与发现，实例 key 绑定到通过 KeepAliveLease 持续续约的租约，租约失效后重新注册
+//
+//	r := etcd.NewRegistry(cli, "/services", 10)
+//	r.Register(ctx, "omdb", &etcd.ServiceInstance{ID: "node1", Addr: "10.0.0.1:11001"})
+//	d, err := r.Discover(ctx, "omdb")
+//	instances := d.Instances()
+type Registry struct {
+	client Client
+	prefix string
+	ttl    int64
+}
+
+func NewRegistry(cli Client, prefix string, ttl int64) *Registry {
+	if ttl < 1 {
+		ttl = 10
+	}
+	return &Registry{client: cli, prefix: strings.TrimRight(prefix, Separator), ttl: ttl}
+}
+
+func (r *Registry) serviceKey(service string) string {
+	return r.prefix + Separator + service
+}
+
+func (r *Registry) instanceKey(service, id string) string {
+	return r.serviceKey(service) + Separator + id
+}
+
+// 创建租约并写入实例信息，返回租约失效通道
+func (r *Registry) register(ctx context.Context, key, value string) (chan bool, error) {
+	lease, lost, err := r.client.KeepAliveLease(ctx, r.ttl)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.client.Txn().Then(OpPutLease(key, value, lease)).CommitCtx(ctx); err != nil {
+		return nil, err
+	}
+	return lost, nil
+}
+
+// 注册服务实例并持续续约，ctx 结束时注销
+func (r *Registry) Register(ctx context.Context, service string, inst *ServiceInstance) error {
+	bs, err := json.Marshal(inst)
+	if err != nil {
+		return err
+	}
+	key, value := r.instanceKey(service, inst.ID), string(bs)
+	lctx, lcancel := context.WithCancel(ctx)
+	lost, err := r.register(lctx, key, value)
+	if err != nil {
+		lcancel()
+		return err
+	}
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+			case <-lost:
+			}
+			lcancel()
+			if ctx.Err() != nil {
+				r.client.Txn().If(CmpValue(key, "=", value)).Then(OpDelete(key)).Commit()
+				return
+			}
+			if lost, lcancel = r.reregister(ctx, key, value); lost == nil {
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// 租约失效后重新注册，失败时每 ttl/3 重试，ctx 结束时返回 nil
+func (r *Registry) reregister(ctx context.Context, key, value string) (chan bool, context.CancelFunc) {
+	ticker := time.NewTicker(time.Duration(r.ttl) * time.Second / 3)
+	defer ticker.Stop()
+	for ctx.Err() == nil {
+		lctx, lcancel := context.WithCancel(ctx)
+		if lost, err := r.register(lctx, key, value); err == nil {
+			return lost, lcancel
+		}
+		lcancel()
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+	return nil, nil
+}
+
+// 注销服务实例，通过 Register 注册的实例应结束其 ctx 注销，否则会在租约失效后重新注册
+func (r *Registry) Deregister(service, id string) error {
+	return r.client.Delete(r.instanceKey(service, id))
+}
+
+// 服务实例缓存，通过 Watch 实时更新
+type Discovery struct {
+	mutex     sync.RWMutex
+	instances map[string]*ServiceInstance
+	handlers  []func([]*ServiceInstance)
+}
+
+// 发现服务实例，返回的 Discovery 在 ctx 结束前持续更新
+func (r *Registry) Discover(ctx context.Context, service string) (*Discovery, error) {
+	d := &Discovery{instances: map[string]*ServiceInstance{}}
+	prefix := r.serviceKey(service) + Separator
+	ch := r.client.Watch(ctx, prefix, true)
+	node, err := r.client.GetNode(r.serviceKey(service))
+	if err != nil {
+		return nil, err
+	}
+	d.reset(prefix, node)
+	go func() {
+		for evt := range ch {
+			if evt.Action == ActionResync {
+				// 历史被压缩，以重新加载的数据为准
+				if d.reset(prefix, evt.Node) {
+					d.changed()
+				}
+				continue
+			}
+			id := evt.Node.Key[len(prefix):]
+			if strings.Contains(id, Separator) {
+				continue
+			}
+			changed := false
+			switch evt.Action {
+			case ActionPut:
+				changed = d.put(id, evt.Node.Value)
+			case ActionDelete:
+				changed = d.delete(id)
+			}
+			if changed {
+				d.changed()
+			}
+		}
+	}()
+	return d, nil
+}
+
+func parseInstance(id string, value string) *ServiceInstance {
+	inst := &ServiceInstance{}
+	if err := json.Unmarshal([]byte(value), inst); err != nil {
+		return nil
+	}
+	if inst.ID == "" {
+		inst.ID = id
+	}
+	return inst
+}
+
+func sameInstance(a, b *ServiceInstance) bool {
+	abs, _ := json.Marshal(a)
+	bbs, _ := json.Marshal(b)
+	return string(abs) == string(bbs)
+}
+
+func (d *Discovery) put(id string, value string) bool {
+	inst := parseInstance(id, value)
+	if inst == nil {
+		return false
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if old, ok := d.instances[id]; ok && sameInstance(old, inst) {
+		// 续约，实例信息未变化
+		return false
+	}
+	d.instances[id] = inst
+	return true
+}
+
+// 用 node 的直接子节点替换全部实例，返回实例是否变化
+func (d *Discovery) reset(prefix string, node *Node) bool {
+	instances := map[string]*ServiceInstance{}
+	if node != nil {
+		for _, n := range node.Nodes {
+			if n.Dir || !strings.HasPrefix(n.Key, prefix) {
+				continue
+			}
+			id := n.Key[len(prefix):]
+			if inst := parseInstance(id, n.Value); inst != nil {
+				instances[id] = inst
+			}
+		}
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	changed := len(instances) != len(d.instances)
+	for id, inst := range instances {
+		if old, ok := d.instances[id]; !ok || !sameInstance(old, inst) {
+			changed = true
+		}
+	}
+	d.instances = instances
+	return changed
+}
+
+func (d *Discovery) delete(id string) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if _, ok := d.instances[id]; !ok {
+		return false
+	}
+	delete(d.instances, id)
+	return true
+}
+
+func (d *Discovery) changed() {
+	d.mutex.RLock()
+	handlers := d.handlers
+	d.mutex.RUnlock()
+	instances := d.Instances()
+	for _, h := range handlers {
+		h(instances)
+	}
+}
+
+// 当前服务实例列表，按 ID 排序
+func (d *Discovery) Instances() []*ServiceInstance {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	instances := make([]*ServiceInstance, 0, len(d.instances))
+	for _, inst := range d.instances {
+		instances = append(instances, inst)
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].ID < instances[j].ID
+	})
+	return instances
+}
+
+// 服务实例变化时调用
+func (d *Discovery) OnChange(h func([]*ServiceInstance)) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.handlers = append(d.handlers, h)
+}
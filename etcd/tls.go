@@ -0,0 +1,174 @@
+package etcd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/wecisecode/util/merrs"
+)
+
+// TLS 配置，CertFile KeyFile 为客户端证书，用于 mTLS
+// 证书文件变化后，新建立的连接自动使用新的证书
+type TLSOption struct {
+	CAFile   string
+	CertFile string
+	KeyFile  string
+	// SNI 及校验服务端证书的主机名，默认为连接地址的主机名，都为空时拒绝连接
+	ServerName         string
+	InsecureSkipVerify bool
+	// 检查证书文件是否变化的最小间隔，默认 10 秒
+	ReloadInterval time.Duration
+}
+
+// 从环境变量 ETCDCACERT ETCDCERT ETCDKEY ETCDSERVERNAME ETCDINSECURE 读取 TLS 配置，都未设置时返回 nil
+func TLSOptionFromEnv() *TLSOption {
+	o := &TLSOption{
+		CAFile:     os.Getenv("ETCDCACERT"),
+		CertFile:   os.Getenv("ETCDCERT"),
+		KeyFile:    os.Getenv("ETCDKEY"),
+		ServerName: os.Getenv("ETCDSERVERNAME"),
+	}
+	o.InsecureSkipVerify, _ = strconv.ParseBool(os.Getenv("ETCDINSECURE"))
+	if o.CAFile == "" && o.CertFile == "" && o.KeyFile == "" && o.ServerName == "" && !o.InsecureSkipVerify {
+		return nil
+	}
+	return o
+}
+
+// 生成 tls.Config，CA 及客户端证书在握手时按需重新加载
+func (o *TLSOption) Config() (*tls.Config, error) {
+	if (o.CertFile == "") != (o.KeyFile == "") {
+		return nil, merrs.NewError("etcd tls cert file and key file must be set together")
+	}
+	r := &tlsReloader{option: *o}
+	if r.option.ReloadInterval <= 0 {
+		r.option.ReloadInterval = 10 * time.Second
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		ServerName: o.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if o.CertFile != "" {
+		config.GetClientCertificate = r.getClientCertificate
+	}
+	// 由 VerifyConnection 使用当前的 CA 校验服务端证书
+	config.InsecureSkipVerify = true
+	if !o.InsecureSkipVerify {
+		config.VerifyConnection = r.verifyConnection
+	}
+	return config, nil
+}
+
+type tlsReloader struct {
+	option   TLSOption
+	mutex    sync.Mutex
+	checked  time.Time
+	modTimes [3]time.Time
+	cert     *tls.Certificate
+	roots    *x509.CertPool
+}
+
+func (r *tlsReloader) files() [3]string {
+	return [3]string{r.option.CAFile, r.option.CertFile, r.option.KeyFile}
+}
+
+// 证书文件变化时重新加载，加载失败时继续使用原有证书
+func (r *tlsReloader) check() {
+	r.mutex.Lock()
+	if time.Since(r.checked) < r.option.ReloadInterval {
+		r.mutex.Unlock()
+		return
+	}
+	r.checked = time.Now()
+	changed := false
+	for i, fn := range r.files() {
+		if fn == "" {
+			continue
+		}
+		if fi, err := os.Stat(fn); err == nil && !fi.ModTime().Equal(r.modTimes[i]) {
+			changed = true
+		}
+	}
+	r.mutex.Unlock()
+	if changed {
+		_ = r.reload()
+	}
+}
+
+func (r *tlsReloader) reload() error {
+	var modTimes [3]time.Time
+	for i, fn := range r.files() {
+		if fn == "" {
+			continue
+		}
+		fi, err := os.Stat(fn)
+		if err != nil {
+			return merrs.NewError(err)
+		}
+		modTimes[i] = fi.ModTime()
+	}
+	var roots *x509.CertPool
+	if r.option.CAFile != "" {
+		bs, err := os.ReadFile(r.option.CAFile)
+		if err != nil {
+			return merrs.NewError(err)
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(bs) {
+			return merrs.NewError("etcd tls ca file %s has no valid certificate", r.option.CAFile)
+		}
+	}
+	var cert *tls.Certificate
+	if r.option.CertFile != "" {
+		c, err := tls.LoadX509KeyPair(r.option.CertFile, r.option.KeyFile)
+		if err != nil {
+			return merrs.NewError(err)
+		}
+		cert = &c
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.modTimes = modTimes
+	r.roots = roots
+	r.cert = cert
+	r.checked = time.Now()
+	return nil
+}
+
+func (r *tlsReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.check()
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.cert, nil
+}
+
+func (r *tlsReloader) verifyConnection(cs tls.ConnectionState) error {
+	r.check()
+	r.mutex.Lock()
+	roots := r.roots
+	r.mutex.Unlock()
+	if len(cs.PeerCertificates) == 0 {
+		return merrs.NewError("etcd tls server has no certificate")
+	}
+	// 未校验主机名时证书可以被任意持有同一 CA 签发证书的服务端冒用
+	if cs.ServerName == "" {
+		return merrs.NewError("etcd tls server name is empty, set TLSOption.ServerName")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		DNSName:       cs.ServerName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
@@ -0,0 +1,134 @@
+package etcd_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wecisecode/util/etcd"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCert(t *testing.T, cn string, parent *testCert, isCA bool) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		DNSNames:              []string{cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signkey := tmpl, key
+	if parent != nil {
+		signer, signkey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signkey)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+func (c *testCert) write(t *testing.T, certfile, keyfile string) {
+	assert.Nil(t, os.WriteFile(certfile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0600))
+	if keyfile != "" {
+		bs, err := x509.MarshalECPrivateKey(c.key)
+		assert.Nil(t, err)
+		assert.Nil(t, os.WriteFile(keyfile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: bs}), 0600))
+	}
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+func TestTLSOption(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil, true)
+	server := newTestCert(t, "etcd.local", ca, false)
+	client1 := newTestCert(t, "client1", ca, false)
+	client2 := newTestCert(t, "client2", ca, false)
+	cafile, certfile, keyfile := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	ca.write(t, cafile, "")
+	client1.write(t, certfile, keyfile)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{server.tlsCertificate()},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	})
+	assert.Nil(t, err)
+	defer ln.Close()
+	peers := make(chan string, 3)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			tc := conn.(*tls.Conn)
+			if tc.Handshake() == nil {
+				peers <- tc.ConnectionState().PeerCertificates[0].Subject.CommonName
+			}
+			tc.Close()
+		}
+	}()
+
+	dial := func(o *etcd.TLSOption) error {
+		config, err := o.Config()
+		if err != nil {
+			return err
+		}
+		conn, err := tls.Dial("tcp", ln.Addr().String(), config)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	o := &etcd.TLSOption{CAFile: cafile, CertFile: certfile, KeyFile: keyfile, ServerName: "etcd.local", ReloadInterval: time.Millisecond}
+	assert.Nil(t, dial(o))
+	assert.Equal(t, "client1", <-peers)
+	// 服务端证书与 SNI 不匹配
+	assert.NotNil(t, dial(&etcd.TLSOption{CAFile: cafile, CertFile: certfile, KeyFile: keyfile, ServerName: "other"}))
+
+	// 证书热更新
+	config, err := o.Config()
+	assert.Nil(t, err)
+	client2.write(t, certfile, keyfile)
+	future := time.Now().Add(time.Second)
+	assert.Nil(t, os.Chtimes(certfile, future, future))
+	time.Sleep(5 * time.Millisecond)
+	conn, err := tls.Dial("tcp", ln.Addr().String(), config)
+	assert.Nil(t, err)
+	conn.Close()
+	assert.Equal(t, "client2", <-peers)
+
+	// 没有服务端名称时拒绝连接
+	cs := tls.ConnectionState{PeerCertificates: []*x509.Certificate{server.cert}}
+	assert.NotNil(t, config.VerifyConnection(cs))
+	cs.ServerName = "etcd.local"
+	assert.Nil(t, config.VerifyConnection(cs))
+}
@@ -0,0 +1,181 @@
+package etcd
+
+import "context"
+
+// 事务，对应 etcd v3 事务，If 条件全部满足时执行 Then 操作，否则执行 Else 操作
+//
+//	resp, err := cli.Txn().
+//		If(etcd.CmpModRevision("/a", "=", rev)).
+//		Then(etcd.OpPut("/a", "1"), etcd.OpDelete("/b")).
+//		Else(etcd.OpGet("/a")).
+//		Commit()
+type Txn interface {
+	If(cmps ...Cmp) Txn
+	Then(ops ...Op) Txn
+	Else(ops ...Op) Txn
+	Commit() (*TxnResponse, error)
+	CommitCtx(ctx context.Context) (*TxnResponse, error)
+}
+
+type CmpTarget int
+
+const (
+	CmpTargetValue CmpTarget = iota
+	CmpTargetCreateRevision
+	CmpTargetModRevision
+)
+
+// 事务条件，Result 为 "=" "!=" ">" "<"
+type Cmp struct {
+	Key      string
+	Target   CmpTarget
+	Result   string
+	Value    string
+	Revision int64
+}
+
+// 比较 key 的值
+func CmpValue(key, result, value string) Cmp {
+	return Cmp{Key: key, Target: CmpTargetValue, Result: result, Value: value}
+}
+
+// 比较 key 的创建版本，CreateRevision 为 0 表示 key 不存在
+func CmpCreateRevision(key, result string, rev int64) Cmp {
+	return Cmp{Key: key, Target: CmpTargetCreateRevision, Result: result, Revision: rev}
+}
+
+// 比较 key 的修改版本
+func CmpModRevision(key, result string, rev int64) Cmp {
+	return Cmp{Key: key, Target: CmpTargetModRevision, Result: result, Revision: rev}
+}
+
+// key 不存在
+func CmpNotExist(key string) Cmp {
+	return CmpCreateRevision(key, "=", 0)
+}
+
+type OpType int
+
+const (
+	OpTypeGet OpType = iota
+	OpTypePut
+	OpTypeDelete
+)
+
+// 事务操作
+type Op struct {
+	Type   OpType
+	Key    string
+	Value  string
+	TTL    int64
+	Lease  int64
+	Prefix bool
+}
+
+func OpGet(key string) Op {
+	return Op{Type: OpTypeGet, Key: key}
+}
+
+func OpPut(key, val string) Op {
+	return Op{Type: OpTypePut, Key: key, Value: val}
+}
+
+func OpPutTTL(key, val string, sec int64) Op {
+	return Op{Type: OpTypePut, Key: key, Value: val, TTL: sec}
+}
+
+// 使用已有租约写入，租约由 KeepAliveLease 创建，租约不存在时事务返回 ErrNotFound 类型的错误
+func OpPutLease(key, val string, lease int64) Op {
+	return Op{Type: OpTypePut, Key: key, Value: val, Lease: lease}
+}
+
+func OpDelete(key string) Op {
+	return Op{Type: OpTypeDelete, Key: key}
+}
+
+// 与 DeleteDir 相同，删除 key 及 key/ 下的所有子节点
+func OpDeleteDir(key string) Op {
+	return Op{Type: OpTypeDelete, Key: key, Prefix: true}
+}
+
+// 事务执行结果
+// Nodes 为执行的 OpGet 操作结果，与 OpGet 顺序对应，key 不存在时为 nil
+type TxnResponse struct {
+	Succeeded bool
+	Revision  int64
+	Nodes     []*Node
+}
+
+type txnOps struct {
+	cmps    []Cmp
+	thenOps []Op
+	elseOps []Op
+}
+
+func (t *txnOps) If(cmps ...Cmp) {
+	t.cmps = append(t.cmps, cmps...)
+}
+
+func (t *txnOps) Then(ops ...Op) {
+	t.thenOps = append(t.thenOps, ops...)
+}
+
+func (t *txnOps) Else(ops ...Op) {
+	t.elseOps = append(t.elseOps, ops...)
+}
+
+func compareInt(result string, a, b int64) bool {
+	switch result {
+	case "=", "==":
+		return a == b
+	case "!=":
+		return a != b
+	case ">":
+		return a > b
+	case "<":
+		return a < b
+	}
+	return false
+}
+
+func compareString(result string, a, b string) bool {
+	switch result {
+	case "=", "==":
+		return a == b
+	case "!=":
+		return a != b
+	case ">":
+		return a > b
+	case "<":
+		return a < b
+	}
+	return false
+}
+
+func compareAndSwap(ctx context.Context, cli Client, key, expectValue, newValue string) (bool, error) {
+	resp, err := cli.Txn().If(CmpValue(key, "=", expectValue)).Then(OpPut(key, newValue)).CommitCtx(ctx)
+	if err != nil {
+		return false, err
+	}
+	return resp.Succeeded, nil
+}
+
+func compareRevisionAndSwap(ctx context.Context, cli Client, key string, expectRevision int64, newValue string) (bool, error) {
+	cmp := CmpModRevision(key, "=", expectRevision)
+	if expectRevision == 0 {
+		cmp = CmpNotExist(key)
+	}
+	resp, err := cli.Txn().If(cmp).Then(OpPut(key, newValue)).CommitCtx(ctx)
+	if err != nil {
+		return false, err
+	}
+	return resp.Succeeded, nil
+}
+
+func putIfAbsent(ctx context.Context, cli Client, key, val string) (bool, error) {
+	resp, err := cli.Txn().If(CmpNotExist(key)).Then(OpPut(key, val)).CommitCtx(ctx)
+	if err != nil {
+		return false, err
+	}
+	return resp.Succeeded, nil
+}
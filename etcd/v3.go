@@ -7,7 +7,6 @@ import (
 	"go.etcd.io/etcd/client/v3/concurrency"
 	"os"
 	"strings"
-	"sync"
 	"time"
 )
 
@@ -16,23 +15,33 @@ type wclientv3 struct {
 }
 
 type wclientv3Locker struct {
-	sess   *concurrency.Session
-	key    string
-	ttl    int64
-	lk sync.Locker
+	sess  *concurrency.Session
+	key   string
+	ttl   int64
+	mutex *concurrency.Mutex
 }
 
 func (locker *wclientv3Locker) Lock() {
 	defer func() {
 		recover()
 	}()
-	locker.lk.Lock()
+	_ = locker.TryLock(locker.sess.Client().Ctx())
+}
+
+func (locker *wclientv3Locker) TryLock(ctx context.Context) error {
+	return convertError(locker.mutex.Lock(ctx))
+}
+
+func (locker *wclientv3Locker) LockWithTimeout(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return locker.TryLock(ctx)
 }
 
 func (locker *wclientv3Locker) Unlock() {
 	ch := make(chan bool)
 	go func() {
-		timeout := time.After(time.Second*time.Duration(locker.ttl))
+		timeout := time.After(time.Second * time.Duration(locker.ttl))
 		select {
 		case <-locker.sess.Done():
 		case <-timeout:
@@ -45,13 +54,13 @@ func (locker *wclientv3Locker) Unlock() {
 		defer func() {
 			recover()
 		}()
-		locker.lk.Unlock()
+		_ = locker.mutex.Unlock(locker.sess.Client().Ctx())
 		_ = locker.sess.Close()
 	}()
 	<-ch
 }
 
-func (c *wclientv3) connect(endpoints []string, opts ...opt) error {
+func (c *wclientv3) connect(endpoints []string, opts ...Option) error {
 	config := clientv3.Config{
 		Endpoints:   endpoints,
 		DialTimeout: 5 * time.Second,
@@ -64,6 +73,9 @@ func (c *wclientv3) connect(endpoints []string, opts ...opt) error {
 		config.Username = op.user
 		config.Password = op.pass
 	}
+	if op.tls != nil {
+		config.TLS = op.tls
+	}
 
 	cli, err := clientv3.New(config)
 	if err != nil {
@@ -76,35 +88,71 @@ func (c *wclientv3) connect(endpoints []string, opts ...opt) error {
 func (c *wclientv3) Put(key, val string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
 	defer cancel()
+	return c.PutCtx(ctx, key, val)
+}
+
+func (c *wclientv3) PutCtx(ctx context.Context, key, val string) error {
 	_, err := c.client.Put(ctx, key, val)
-	return err
+	return convertError(err)
 }
 
 func (c *wclientv3) PutTTL(key, val string, sec int64) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
 	defer cancel()
+	return c.PutTTLCtx(ctx, key, val, sec)
+}
+
+func (c *wclientv3) PutTTLCtx(ctx context.Context, key, val string, sec int64) error {
 	leaseResp, err := c.client.Grant(ctx, sec)
 	if err != nil {
-		return err
+		return convertError(err)
 	}
 	_, err = c.client.Put(ctx, key, val, clientv3.WithLease(leaseResp.ID))
-	return err
+	return convertError(err)
 }
 
 func (c *wclientv3) Get(key string) (val string, err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
 	defer cancel()
+	val, err = c.GetCtx(ctx, key)
+	if IsNotFound(err) {
+		return "", nil
+	}
+	return
+}
+
+func (c *wclientv3) GetCtx(ctx context.Context, key string) (val string, err error) {
 	resp, err := c.client.Get(ctx, key)
 	if err != nil {
-		return "", err
+		return "", convertError(err)
 	}
 	for _, v := range resp.Kvs {
 		return string(v.Value), nil
 	}
-	return "", nil
+	return "", ErrNotFound.New("key %s not found", key)
 }
 
 func (c *wclientv3) GetNode(key string) (node *Node, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	node, err = c.GetNodeCtx(ctx, key)
+	if IsNotFound(err) {
+		return &Node{Key: key}, nil
+	}
+	return
+}
+
+func (c *wclientv3) GetNodeCtx(ctx context.Context, key string) (node *Node, err error) {
+	node, _, err = c.getNode(ctx, key)
+	return
+}
+
+func (c *wclientv3) getNodeRevision(ctx context.Context, key string) (node *Node, rev int64, err error) {
+	return c.getNode(ctx, key)
+}
+
+// 返回 key 及其子节点在同一 revision 下的数据
+func (c *wclientv3) getNode(ctx context.Context, key string) (node *Node, rev int64, err error) {
 	var (
 		topNode *Node
 		/*
@@ -116,12 +164,11 @@ func (c *wclientv3) GetNode(key string) (node *Node, err error) {
 		prefixKey string
 	)
 	// parent
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
-	defer cancel()
 	r, err := c.client.Get(ctx, key)
 	if err != nil {
-		return nil, err
+		return nil, 0, convertError(err)
 	}
+	rev = r.Header.Revision
 	if key == Separator {
 		min = 1
 		prefixKey = Separator
@@ -141,9 +188,12 @@ func (c *wclientv3) GetNode(key string) (node *Node, err error) {
 	}
 
 	//child
-	resp, err := c.client.Get(ctx, prefixKey, clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+	resp, err := c.client.Get(ctx, prefixKey, clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend), clientv3.WithRev(rev))
 	if err != nil {
-		return nil, err
+		return nil, 0, convertError(err)
+	}
+	if r.Count == 0 && len(resp.Kvs) == 0 {
+		return nil, rev, ErrNotFound.New("key %s not found", key)
 	}
 
 	for _, v := range resp.Kvs {
@@ -214,14 +264,18 @@ func (c *wclientv3) GetNode(key string) (node *Node, err error) {
 		}
 	}
 	topNode = all[min][0]
-	return topNode, nil
+	return topNode, rev, nil
 }
 
 func (c *wclientv3) Delete(key string) (err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
 	defer cancel()
+	return c.DeleteCtx(ctx, key)
+}
+
+func (c *wclientv3) DeleteCtx(ctx context.Context, key string) (err error) {
 	if _, err := c.client.Delete(ctx, key); err != nil {
-		return err
+		return convertError(err)
 	}
 	return nil
 }
@@ -229,35 +283,81 @@ func (c *wclientv3) Delete(key string) (err error) {
 func (c *wclientv3) DeleteDir(key string) (err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
+	return c.DeleteDirCtx(ctx, key)
+}
+
+func (c *wclientv3) DeleteDirCtx(ctx context.Context, key string) (err error) {
 	if _, err = c.client.Delete(ctx, key+Separator, clientv3.WithPrefix()); err != nil {
-		return err
+		return convertError(err)
 	}
 	if _, err := c.client.Delete(ctx, key); err != nil {
-		return err
+		return convertError(err)
 	}
 	return nil
 }
 
 func (c *wclientv3) Watch(ctx context.Context, key string, recursive bool) (ech chan *Event) {
+	return c.WatchFrom(ctx, key, recursive, 0)
+}
+
+func (c *wclientv3) WatchFrom(ctx context.Context, key string, recursive bool, rev int64) (ech chan *Event) {
 	ech = make(chan *Event, 5)
 	go func() {
+		defer close(ech)
 		// https://github.com/etcd-io/etcd/issues/8980
 		// https://github.com/sensu/sensu-go/issues/3012
 		leaderCtx := clientv3.WithRequireLeader(ctx)
-		var watchChan clientv3.WatchChan
-		if recursive {
-			watchChan = c.client.Watch(leaderCtx, key, clientv3.WithPrefix())
-		} else {
-			watchChan = c.client.Watch(leaderCtx, key)
+		// 最后收到的 revision，重新监听时从下一个 revision 开始
+		lastRev := int64(0)
+		if rev > 0 {
+			lastRev = rev - 1
 		}
-
-		watchCtx, watchCancel := context.WithCancel(ctx)
-		defer watchCancel()
-	L:
+		watch := func() clientv3.WatchChan {
+			opts := []clientv3.OpOption{clientv3.WithCreatedNotify()}
+			if recursive {
+				opts = append(opts, clientv3.WithPrefix())
+			}
+			if lastRev > 0 {
+				opts = append(opts, clientv3.WithRev(lastRev+1))
+			}
+			return c.client.Watch(leaderCtx, key, opts...)
+		}
+		send := func(evt *Event) bool {
+			select {
+			case ech <- evt:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		watchChan := watch()
 		for {
 			select {
 			case wresp, ok := <-watchChan:
-				if ok {
+				if ok && wresp.CompactRevision != 0 {
+					// 历史已被压缩，重新加载全部数据后从加载时的 revision 继续监听
+					node, nrev, err := c.getNode(ctx, resyncKey(key, recursive))
+					if IsNotFound(err) {
+						node, err = nil, nil
+					}
+					if err != nil {
+						_, _ = fmt.Fprintf(os.Stderr, "etcd '%s' resync error: %v", key, err)
+						time.Sleep(time.Second)
+						continue
+					}
+					node = resyncNode(node, key, recursive)
+					if !send(&Event{Action: ActionResync, Node: node, WatchStatus: WatchStatusCompacted, Revision: nrev}) {
+						return
+					}
+					lastRev = nrev
+					watchChan = watch()
+					continue
+				}
+				if ok && wresp.Err() == nil {
+					if wresp.Created && lastRev == 0 {
+						// 开始监听时的 revision，断开后从此处继续
+						lastRev = wresp.Header.Revision
+					}
 					for _, ev := range wresp.Events {
 						node := &Node{Key: string(ev.Kv.Key), Value: string(ev.Kv.Value), Dir: false}
 						var actionType ActionType
@@ -271,33 +371,35 @@ func (c *wclientv3) Watch(ctx context.Context, key string, recursive bool) (ech
 							node.ModRevision = ev.Kv.ModRevision
 						case "DELETE":
 							actionType = ActionDelete
+							node.ModRevision = ev.Kv.ModRevision
 						}
-						evt := &Event{Action: actionType, Node: node, WatchStatus: WatchStatusOK}
-						ech <- evt
-					}
-				} else {
-					time.Sleep(time.Second)
-					_, _ = fmt.Fprintf(os.Stderr, "etcd '%s' watching channel was closed", key)
-					clusterOk := true
-					for _, ed := range c.client.Endpoints() {
-						cx, cancel := context.WithTimeout(context.Background(), time.Second*3)
-						if _, err := c.client.Status(cx, ed); err != nil {
-							_, _ = fmt.Fprintf(os.Stderr, "etcd endpoint '%s' check error: %v", key, err)
-							clusterOk = false
+						evt := &Event{Action: actionType, Node: node, WatchStatus: WatchStatusOK, Revision: ev.Kv.ModRevision}
+						if !send(evt) {
+							return
 						}
-						cancel()
+						lastRev = ev.Kv.ModRevision
 					}
-					if clusterOk {
-						if recursive {
-							watchChan = c.client.Watch(leaderCtx, key, clientv3.WithPrefix())
-						} else {
-							watchChan = c.client.Watch(leaderCtx, key)
-						}
+					continue
+				}
+				if ctx.Err() != nil {
+					return
+				}
+				time.Sleep(time.Second)
+				_, _ = fmt.Fprintf(os.Stderr, "etcd '%s' watching channel was closed", key)
+				clusterOk := true
+				for _, ed := range c.client.Endpoints() {
+					cx, cancel := context.WithTimeout(ctx, time.Second*3)
+					if _, err := c.client.Status(cx, ed); err != nil {
+						_, _ = fmt.Fprintf(os.Stderr, "etcd endpoint '%s' check error: %v", key, err)
+						clusterOk = false
 					}
+					cancel()
 				}
-			case <-watchCtx.Done():
-				close(ech)
-				break L
+				if clusterOk {
+					watchChan = watch()
+				}
+			case <-ctx.Done():
+				return
 			}
 		}
 	}()
@@ -306,42 +408,77 @@ func (c *wclientv3) Watch(ctx context.Context, key string, recursive bool) (ech
 }
 
 func (c *wclientv3) KeepAlive(ctx context.Context, sec int64) (stopCh chan bool, err error) {
+	_, stopCh, err = c.KeepAliveLease(ctx, sec)
+	return
+}
+
+func (c *wclientv3) KeepAliveLease(ctx context.Context, sec int64) (lease int64, stopCh chan bool, err error) {
 	stopCh = make(chan bool)
 	leaseResp, err := c.client.Grant(ctx, sec)
 	if err != nil {
-		return nil, err
+		return 0, nil, convertError(err)
 	}
 	ch, err := c.client.KeepAlive(ctx, leaseResp.ID)
 	if err != nil {
-		return nil, err
+		return 0, nil, convertError(err)
 	}
 	go func() {
 		for range ch {
 
+		}
+		if ctx.Err() != nil {
+			rctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			c.client.Revoke(rctx, leaseResp.ID)
+			cancel()
 		}
 		close(stopCh)
 	}()
-	return stopCh, nil
+	return int64(leaseResp.ID), stopCh, nil
 }
 
 func (c *wclientv3) Close() error {
 	return c.client.Close()
 }
 
-func (c *wclientv3) NewLocker(key string, ttl int64) (sync.Locker, error) {
+func (c *wclientv3) NewLocker(key string, ttl int64) (Locker, error) {
+	return c.NewLockerCtx(context.Background(), key, ttl)
+}
+
+// ctx 仅用于限制创建会话的时间，不影响锁会话的生命周期
+func (c *wclientv3) NewLockerCtx(ctx context.Context, key string, ttl int64) (Locker, error) {
 	if ttl < 1 {
 		ttl = 60
 	}
-	sess, err := concurrency.NewSession(c.client, concurrency.WithTTL(int(ttl)))
-	if err != nil {
-		return nil, err
+	type result struct {
+		sess *concurrency.Session
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		sess, err := concurrency.NewSession(c.client, concurrency.WithTTL(int(ttl)))
+		ch <- result{sess, err}
+	}()
+	var sess *concurrency.Session
+	select {
+	case r := <-ch:
+		if r.err != nil {
+			return nil, convertError(r.err)
+		}
+		sess = r.sess
+	case <-ctx.Done():
+		go func() {
+			if r := <-ch; r.sess != nil {
+				r.sess.Close()
+			}
+		}()
+		return nil, convertError(ctx.Err())
 	}
 
 	lk := &wclientv3Locker{
-		sess: sess,
-		key:  key,
-		ttl:  ttl,
-		lk:   concurrency.NewLocker(sess, key),
+		sess:  sess,
+		key:   key,
+		ttl:   ttl,
+		mutex: concurrency.NewMutex(sess, key),
 	}
 
 	return lk, nil
@@ -359,3 +496,152 @@ func (c *wclientv3) getTTL(lease int64) int64 {
 	}
 	return resp.TTL
 }
+
+func (c *wclientv3) CompareAndSwap(key, expectValue, newValue string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	return compareAndSwap(ctx, c, key, expectValue, newValue)
+}
+
+func (c *wclientv3) CompareAndSwapCtx(ctx context.Context, key, expectValue, newValue string) (bool, error) {
+	return compareAndSwap(ctx, c, key, expectValue, newValue)
+}
+
+func (c *wclientv3) CompareRevisionAndSwap(key string, expectRevision int64, newValue string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	return compareRevisionAndSwap(ctx, c, key, expectRevision, newValue)
+}
+
+func (c *wclientv3) CompareRevisionAndSwapCtx(ctx context.Context, key string, expectRevision int64, newValue string) (bool, error) {
+	return compareRevisionAndSwap(ctx, c, key, expectRevision, newValue)
+}
+
+func (c *wclientv3) PutIfAbsent(key, val string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	return putIfAbsent(ctx, c, key, val)
+}
+
+func (c *wclientv3) PutIfAbsentCtx(ctx context.Context, key, val string) (bool, error) {
+	return putIfAbsent(ctx, c, key, val)
+}
+
+type wclientv3Txn struct {
+	txnOps
+	client *wclientv3
+}
+
+func (c *wclientv3) Txn() Txn {
+	return &wclientv3Txn{client: c}
+}
+
+func (t *wclientv3Txn) If(cmps ...Cmp) Txn {
+	t.txnOps.If(cmps...)
+	return t
+}
+
+func (t *wclientv3Txn) Then(ops ...Op) Txn {
+	t.txnOps.Then(ops...)
+	return t
+}
+
+func (t *wclientv3Txn) Else(ops ...Op) Txn {
+	t.txnOps.Else(ops...)
+	return t
+}
+
+func (t *wclientv3Txn) Commit() (*TxnResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	return t.CommitCtx(ctx)
+}
+
+func (t *wclientv3Txn) CommitCtx(ctx context.Context) (*TxnResponse, error) {
+	cmps := make([]clientv3.Cmp, 0, len(t.cmps))
+	for _, cmp := range t.cmps {
+		switch cmp.Target {
+		case CmpTargetValue:
+			cmps = append(cmps, clientv3.Compare(clientv3.Value(cmp.Key), cmp.Result, cmp.Value))
+		case CmpTargetCreateRevision:
+			cmps = append(cmps, clientv3.Compare(clientv3.CreateRevision(cmp.Key), cmp.Result, cmp.Revision))
+		case CmpTargetModRevision:
+			cmps = append(cmps, clientv3.Compare(clientv3.ModRevision(cmp.Key), cmp.Result, cmp.Revision))
+		}
+	}
+	// 带 TTL 的 OpPut 在提交前授予租约，未执行的分支授予的租约需撤销
+	thenOps, thenLeases, err := t.client.txnOps(ctx, t.thenOps)
+	if err != nil {
+		return nil, err
+	}
+	elseOps, elseLeases, err := t.client.txnOps(ctx, t.elseOps)
+	if err != nil {
+		t.client.revokeLeases(thenLeases)
+		return nil, err
+	}
+	resp, err := t.client.client.Txn(ctx).If(cmps...).Then(thenOps...).Else(elseOps...).Commit()
+	if err != nil {
+		// 出错时事务可能已执行，撤销租约会删除已写入的 key，租约在 TTL 到期后自动失效
+		return nil, convertError(err)
+	}
+	if resp.Succeeded {
+		t.client.revokeLeases(elseLeases)
+	} else {
+		t.client.revokeLeases(thenLeases)
+	}
+	tr := &TxnResponse{Succeeded: resp.Succeeded, Revision: resp.Header.Revision}
+	for _, r := range resp.Responses {
+		if rr := r.GetResponseRange(); rr != nil {
+			var node *Node
+			for _, kv := range rr.Kvs {
+				node = &Node{Key: string(kv.Key), Value: string(kv.Value), CreateRevision: kv.CreateRevision, ModRevision: kv.ModRevision}
+				if kv.Lease != 0 {
+					node.TTL = t.client.getTTL(kv.Lease)
+				}
+			}
+			tr.Nodes = append(tr.Nodes, node)
+		}
+	}
+	return tr, nil
+}
+
+// 返回转换后的操作及为其授予的租约，出错时已授予的租约被撤销
+func (c *wclientv3) txnOps(ctx context.Context, ops []Op) (vops []clientv3.Op, leases []clientv3.LeaseID, err error) {
+	for _, op := range ops {
+		switch op.Type {
+		case OpTypeGet:
+			vops = append(vops, clientv3.OpGet(op.Key))
+		case OpTypePut:
+			if op.TTL > 0 {
+				leaseResp, err := c.client.Grant(ctx, op.TTL)
+				if err != nil {
+					c.revokeLeases(leases)
+					return nil, nil, convertError(err)
+				}
+				leases = append(leases, leaseResp.ID)
+				vops = append(vops, clientv3.OpPut(op.Key, op.Value, clientv3.WithLease(leaseResp.ID)))
+			} else if op.Lease != 0 {
+				vops = append(vops, clientv3.OpPut(op.Key, op.Value, clientv3.WithLease(clientv3.LeaseID(op.Lease))))
+			} else {
+				vops = append(vops, clientv3.OpPut(op.Key, op.Value))
+			}
+		case OpTypeDelete:
+			if op.Prefix {
+				vops = append(vops, clientv3.OpDelete(op.Key+Separator, clientv3.WithPrefix()))
+			}
+			vops = append(vops, clientv3.OpDelete(op.Key))
+		}
+	}
+	return
+}
+
+func (c *wclientv3) revokeLeases(leases []clientv3.LeaseID) {
+	if len(leases) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, id := range leases {
+		c.client.Revoke(ctx, id)
+	}
+}
@@ -20,7 +20,7 @@ type Option struct {
 var tidx = int32(0)
 var timeoutidx = map[int32]int64{}
 var timeoutxid = map[int64]int32{}
-var timeoutqueue = sortedmap.NewTreapMap()
+var timeoutqueue = sortedmap.NewTreapMapOf[int64, func()]()
 var mutex sync.Mutex
 var timer *time.Timer
 
@@ -56,11 +56,10 @@ func checkTimeoutQueue() bool {
 			return false
 		} else {
 			firstitem := timeoutqueue.FirstItem()
-			tfirst := firstitem.Key.(int64)
+			tfirst := firstitem.Key
 			tnow := time.Now().UnixNano()
 			if tfirst <= tnow {
-				ff := firstitem.Value.(func())
-				go ff()
+				go firstitem.Value()
 				tidx := timeoutxid[tfirst]
 				timeoutqueue.Delete(tfirst)
 				delete(timeoutxid, tfirst)
@@ -103,7 +102,7 @@ func SetTimeout(td time.Duration, f func()) int32 {
 			}
 		}()
 	}
-	tfirst := timeoutqueue.FirstItem().Key.(int64)
+	tfirst := timeoutqueue.FirstItem().Key
 	if tnano == tfirst {
 		timer.Reset(time.Duration(tfirst - tnow))
 	}
@@ -1,280 +1,40 @@
-// Copyright (C) 2017 ScyllaDB
-// Use of this source code is governed by a ALv2-style
-// license that can be found at https://github.com/scylladb/go-set/LICENSE.
-
 package b64set
 
-import (
-	"fmt"
-	"strings"
-)
-
-var (
-	// helpful to not write everywhere struct{}{}
-	keyExists   = struct{}{}
-	nonExistent [64]byte
-)
-
-const maxInt = int(^uint(0) >> 1)
+import "github.com/wecisecode/util/set"
 
-// Set is the main set structure that holds all the data
-// and methods used to working with the set.
-type Set struct {
-	M map[[64]byte]struct{}
-}
+// Set 为元素类型是 [64]byte 的 set.Set，保留以兼容原有代码
+type Set = set.Set[[64]byte]
 
 // New creates and initializes a new Set.
 func New(ts ...[64]byte) *Set {
-	s := NewWithSize(len(ts))
-	s.Add(ts...)
-	return s
+	return set.New(ts...)
 }
 
 // NewWithSize creates a new Set and gives make map a size hint.
 func NewWithSize(size int) *Set {
-	return &Set{make(map[[64]byte]struct{}, size)}
-}
-
-// Add includes the specified items (one or more) to the Set. The underlying
-// Set s is modified. If passed nothing it silently returns.
-func (s *Set) Add(items ...[64]byte) {
-	for _, item := range items {
-		s.M[item] = keyExists
-	}
-}
-
-// Remove deletes the specified items from the Set. The underlying Set s is
-// modified. If passed nothing it silently returns.
-func (s *Set) Remove(items ...[64]byte) {
-	for _, item := range items {
-		delete(s.M, item)
-	}
-}
-
-// Pop deletes and returns an item from the Set. The underlying Set s is
-// modified. If Set is empty, the zero value is returned.
-func (s *Set) Pop() [64]byte {
-	for item := range s.M {
-		delete(s.M, item)
-		return item
-	}
-	return nonExistent
-}
-
-// Pop2 tries to delete and return an item from the Set. The underlying Set s
-// is modified. The second value is a bool that is true if the item existed in
-// the set, and false if not. If Set is empty, the zero value and false are
-// returned.
-func (s *Set) Pop2() ([64]byte, bool) {
-	for item := range s.M {
-		delete(s.M, item)
-		return item, true
-	}
-	return nonExistent, false
-}
-
-// Has looks for the existence of items passed. It returns false if nothing is
-// passed. For multiple items it returns true only if all of  the items exist.
-func (s *Set) Has(items ...[64]byte) bool {
-	has := false
-	for _, item := range items {
-		if _, has = s.M[item]; !has {
-			break
-		}
-	}
-	return has
-}
-
-// HasAny looks for the existence of any of the items passed.
-// It returns false if nothing is passed.
-// For multiple items it returns true if any of the items exist.
-func (s *Set) HasAny(items ...[64]byte) bool {
-	has := false
-	for _, item := range items {
-		if _, has = s.M[item]; has {
-			break
-		}
-	}
-	return has
-}
-
-// Size returns the number of items in a Set.
-func (s *Set) Size() int {
-	return len(s.M)
-}
-
-// Clear removes all items from the Set.
-func (s *Set) Clear() {
-	s.M = make(map[[64]byte]struct{})
-}
-
-// IsEmpty reports whether the Set is empty.
-func (s *Set) IsEmpty() bool {
-	return s.Size() == 0
-}
-
-// IsEqual test whether s and t are the same in size and have the same items.
-func (s *Set) IsEqual(t *Set) bool {
-	// return false if they are no the same size
-	if s.Size() != t.Size() {
-		return false
-	}
-
-	equal := true
-	t.Each(func(item [64]byte) bool {
-		_, equal = s.M[item]
-		return equal // if false, Each() will end
-	})
-
-	return equal
-}
-
-// IsSubset tests whether t is a subset of s.
-func (s *Set) IsSubset(t *Set) bool {
-	if s.Size() < t.Size() {
-		return false
-	}
-
-	subset := true
-
-	t.Each(func(item [64]byte) bool {
-		_, subset = s.M[item]
-		return subset
-	})
-
-	return subset
-}
-
-// IsSuperset tests whether t is a superset of s.
-func (s *Set) IsSuperset(t *Set) bool {
-	return t.IsSubset(s)
-}
-
-// Each traverses the items in the Set, calling the provided function for each
-// Set member. Traversal will continue until all items in the Set have been
-// visited, or if the closure returns false.
-func (s *Set) Each(f func(item [64]byte) bool) {
-	for item := range s.M {
-		if !f(item) {
-			break
-		}
-	}
-}
-
-// Copy returns a new Set with a copy of s.
-func (s *Set) Copy() *Set {
-	u := NewWithSize(s.Size())
-	for item := range s.M {
-		u.M[item] = keyExists
-	}
-	return u
-}
-
-// String returns a string representation of s
-func (s *Set) String() string {
-	v := make([]string, 0, s.Size())
-	for item := range s.M {
-		v = append(v, fmt.Sprintf("%v", item))
-	}
-	return fmt.Sprintf("[%s]", strings.Join(v, ", "))
-}
-
-// List returns a slice of all items. There is also StringSlice() and
-// IntSlice() methods for returning slices of type string or int.
-func (s *Set) List() [][64]byte {
-	v := make([][64]byte, 0, s.Size())
-	for item := range s.M {
-		v = append(v, item)
-	}
-	return v
-}
-
-// Merge is like Union, however it modifies the current Set it's applied on
-// with the given t Set.
-func (s *Set) Merge(t *Set) {
-	for item := range t.M {
-		s.M[item] = keyExists
-	}
-}
-
-// Separate removes the Set items containing in t from Set s. Please aware that
-// it's not the opposite of Merge.
-func (s *Set) Separate(t *Set) {
-	for item := range t.M {
-		delete(s.M, item)
-	}
+	return set.NewWithSize[[64]byte](size)
 }
 
 // Union is the merger of multiple sets. It returns a new set with all the
 // elements present in all the sets that are passed.
 func Union(sets ...*Set) *Set {
-	maxPos := -1
-	maxSize := 0
-	for i, set := range sets {
-		if l := set.Size(); l > maxSize {
-			maxSize = l
-			maxPos = i
-		}
-	}
-	if maxSize == 0 {
-		return New()
-	}
-
-	u := sets[maxPos].Copy()
-	for i, set := range sets {
-		if i == maxPos {
-			continue
-		}
-		for item := range set.M {
-			u.M[item] = keyExists
-		}
-	}
-	return u
+	return set.Union(sets...)
 }
 
 // Difference returns a new set which contains items which are in in the first
 // set but not in the others.
 func Difference(set1 *Set, sets ...*Set) *Set {
-	s := set1.Copy()
-	for _, set := range sets {
-		s.Separate(set)
-	}
-	return s
+	return set.Difference(set1, sets...)
 }
 
 // Intersection returns a new set which contains items that only exist in all
 // given sets.
 func Intersection(sets ...*Set) *Set {
-	minPos := -1
-	minSize := maxInt
-	for i, set := range sets {
-		if l := set.Size(); l < minSize {
-			minSize = l
-			minPos = i
-		}
-	}
-	if minSize == maxInt || minSize == 0 {
-		return New()
-	}
-
-	t := sets[minPos].Copy()
-	for i, set := range sets {
-		if i == minPos {
-			continue
-		}
-		for item := range t.M {
-			if _, has := set.M[item]; !has {
-				delete(t.M, item)
-			}
-		}
-	}
-	return t
+	return set.Intersection(sets...)
 }
 
 // SymmetricDifference returns a new set which s is the difference of items
 // which are in one of either, but not in both.
 func SymmetricDifference(s *Set, t *Set) *Set {
-	u := Difference(s, t)
-	v := Difference(t, s)
-	return Union(u, v)
+	return set.SymmetricDifference(s, t)
 }
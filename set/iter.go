@@ -0,0 +1,44 @@
+//go:build go1.23
+
+package set
+
+import "iter"
+
+// All 遍历所有元素，顺序不确定，遍历过程中可以删除元素
+//
+//	for item := range s.All() {
+//	}
+func (s *Set[T]) All() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for item := range s.M {
+			if !yield(item) {
+				return
+			}
+		}
+	}
+}
+
+// 添加 seq 中的所有元素
+func (s *Set[T]) AddSeq(seq iter.Seq[T]) {
+	for item := range seq {
+		s.M[item] = keyExists
+	}
+}
+
+// 由 seq 中的元素创建 Set
+func Collect[T comparable](seq iter.Seq[T]) *Set[T] {
+	s := New[T]()
+	s.AddSeq(seq)
+	return s
+}
+
+// All 遍历调用时的所有元素，遍历过程中可以修改 Set
+func (s *SyncSet[T]) All() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for _, item := range s.List() {
+			if !yield(item) {
+				return
+			}
+		}
+	}
+}
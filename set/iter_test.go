@@ -0,0 +1,26 @@
+//go:build go1.23
+
+package set_test
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wecisecode/util/set"
+)
+
+func TestSetIter(t *testing.T) {
+	s := set.Collect(slices.Values([]int{1, 2, 2, 3}))
+	assert.Equal(t, 3, s.Size())
+	// 遍历时删除
+	for item := range s.All() {
+		if item != 2 {
+			s.Remove(item)
+		}
+	}
+	assert.Equal(t, []int{2}, s.List())
+	s.AddSeq(maps.Keys(map[int]bool{5: true}))
+	assert.Equal(t, []int{2, 5}, slices.Sorted(s.All()))
+}
@@ -0,0 +1,335 @@
+// Copyright (C) 2017 ScyllaDB
+// Use of this source code is governed by a ALv2-style
+// license that can be found at https://github.com/scylladb/go-set/LICENSE.
+
+package set
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// helpful to not write everywhere struct{}{}
+var keyExists = struct{}{}
+
+const maxInt = int(^uint(0) >> 1)
+
+// Set is the main set structure that holds all the data
+// and methods used to working with the set.
+type Set[T comparable] struct {
+	M map[T]struct{}
+}
+
+// New creates and initializes a new Set.
+func New[T comparable](ts ...T) *Set[T] {
+	s := NewWithSize[T](len(ts))
+	s.Add(ts...)
+	return s
+}
+
+// NewWithSize creates a new Set and gives make map a size hint.
+func NewWithSize[T comparable](size int) *Set[T] {
+	return &Set[T]{make(map[T]struct{}, size)}
+}
+
+// Add includes the specified items (one or more) to the Set. The underlying
+// Set s is modified. If passed nothing it silently returns.
+func (s *Set[T]) Add(items ...T) {
+	for _, item := range items {
+		s.M[item] = keyExists
+	}
+}
+
+// Remove deletes the specified items from the Set. The underlying Set s is
+// modified. If passed nothing it silently returns.
+func (s *Set[T]) Remove(items ...T) {
+	for _, item := range items {
+		delete(s.M, item)
+	}
+}
+
+// Pop deletes and returns an item from the Set. The underlying Set s is
+// modified. If Set is empty, the zero value is returned.
+func (s *Set[T]) Pop() T {
+	for item := range s.M {
+		delete(s.M, item)
+		return item
+	}
+	var zero T
+	return zero
+}
+
+// Pop2 tries to delete and return an item from the Set. The underlying Set s
+// is modified. The second value is a bool that is true if the item existed in
+// the set, and false if not. If Set is empty, the zero value and false are
+// returned.
+func (s *Set[T]) Pop2() (T, bool) {
+	for item := range s.M {
+		delete(s.M, item)
+		return item, true
+	}
+	var zero T
+	return zero, false
+}
+
+// Has looks for the existence of items passed. It returns false if nothing is
+// passed. For multiple items it returns true only if all of  the items exist.
+func (s *Set[T]) Has(items ...T) bool {
+	has := false
+	for _, item := range items {
+		if _, has = s.M[item]; !has {
+			break
+		}
+	}
+	return has
+}
+
+// HasAny looks for the existence of any of the items passed.
+// It returns false if nothing is passed.
+// For multiple items it returns true if any of the items exist.
+func (s *Set[T]) HasAny(items ...T) bool {
+	has := false
+	for _, item := range items {
+		if _, has = s.M[item]; has {
+			break
+		}
+	}
+	return has
+}
+
+// Size returns the number of items in a Set.
+func (s *Set[T]) Size() int {
+	return len(s.M)
+}
+
+// Clear removes all items from the Set.
+func (s *Set[T]) Clear() {
+	s.M = make(map[T]struct{})
+}
+
+// IsEmpty reports whether the Set is empty.
+func (s *Set[T]) IsEmpty() bool {
+	return s.Size() == 0
+}
+
+// IsEqual test whether s and t are the same in size and have the same items.
+func (s *Set[T]) IsEqual(t *Set[T]) bool {
+	// return false if they are no the same size
+	if s.Size() != t.Size() {
+		return false
+	}
+
+	equal := true
+	t.Each(func(item T) bool {
+		_, equal = s.M[item]
+		return equal // if false, Each() will end
+	})
+
+	return equal
+}
+
+// IsSubset tests whether t is a subset of s.
+func (s *Set[T]) IsSubset(t *Set[T]) bool {
+	if s.Size() < t.Size() {
+		return false
+	}
+
+	subset := true
+
+	t.Each(func(item T) bool {
+		_, subset = s.M[item]
+		return subset
+	})
+
+	return subset
+}
+
+// IsSuperset tests whether t is a superset of s.
+func (s *Set[T]) IsSuperset(t *Set[T]) bool {
+	return t.IsSubset(s)
+}
+
+// Each traverses the items in the Set, calling the provided function for each
+// Set member. Traversal will continue until all items in the Set have been
+// visited, or if the closure returns false.
+func (s *Set[T]) Each(f func(item T) bool) {
+	for item := range s.M {
+		if !f(item) {
+			break
+		}
+	}
+}
+
+// Copy returns a new Set with a copy of s.
+func (s *Set[T]) Copy() *Set[T] {
+	u := NewWithSize[T](s.Size())
+	for item := range s.M {
+		u.M[item] = keyExists
+	}
+	return u
+}
+
+// String returns a string representation of s
+func (s *Set[T]) String() string {
+	v := make([]string, 0, s.Size())
+	for item := range s.M {
+		v = append(v, fmt.Sprintf("%v", item))
+	}
+	return fmt.Sprintf("[%s]", strings.Join(v, ", "))
+}
+
+// List returns a slice of all items in no particular order, use SortedList
+// for ordered types.
+func (s *Set[T]) List() []T {
+	v := make([]T, 0, s.Size())
+	for item := range s.M {
+		v = append(v, item)
+	}
+	return v
+}
+
+// SortedList returns a slice of all items in ascending order.
+func SortedList[T cmp.Ordered](s *Set[T]) []T {
+	v := s.List()
+	slices.Sort(v)
+	return v
+}
+
+// SortedListFunc returns a slice of all items sorted by compare.
+func SortedListFunc[T comparable](s *Set[T], compare func(a, b T) int) []T {
+	v := s.List()
+	slices.SortFunc(v, compare)
+	return v
+}
+
+// 编码为 json 数组
+func (s *Set[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.List())
+}
+
+// 从 json 数组解码，添加到已有的元素中
+func (s *Set[T]) UnmarshalJSON(bs []byte) error {
+	v := []T{}
+	if err := json.Unmarshal(bs, &v); err != nil {
+		return err
+	}
+	s.addAll(v)
+	return nil
+}
+
+// 编码为 msgpack 数组
+func (s *Set[T]) MarshalMsgpack() ([]byte, error) {
+	return msgpack.Marshal(s.List())
+}
+
+// 从 msgpack 数组解码，添加到已有的元素中
+func (s *Set[T]) UnmarshalMsgpack(bs []byte) error {
+	v := []T{}
+	if err := msgpack.Unmarshal(bs, &v); err != nil {
+		return err
+	}
+	s.addAll(v)
+	return nil
+}
+
+func (s *Set[T]) addAll(items []T) {
+	if s.M == nil {
+		s.M = make(map[T]struct{}, len(items))
+	}
+	s.Add(items...)
+}
+
+// Merge is like Union, however it modifies the current Set it's applied on
+// with the given t Set.
+func (s *Set[T]) Merge(t *Set[T]) {
+	for item := range t.M {
+		s.M[item] = keyExists
+	}
+}
+
+// Separate removes the Set items containing in t from Set s. Please aware that
+// it's not the opposite of Merge.
+func (s *Set[T]) Separate(t *Set[T]) {
+	for item := range t.M {
+		delete(s.M, item)
+	}
+}
+
+// Union is the merger of multiple sets. It returns a new set with all the
+// elements present in all the sets that are passed.
+func Union[T comparable](sets ...*Set[T]) *Set[T] {
+	maxPos := -1
+	maxSize := 0
+	for i, set := range sets {
+		if l := set.Size(); l > maxSize {
+			maxSize = l
+			maxPos = i
+		}
+	}
+	if maxSize == 0 {
+		return New[T]()
+	}
+
+	u := sets[maxPos].Copy()
+	for i, set := range sets {
+		if i == maxPos {
+			continue
+		}
+		for item := range set.M {
+			u.M[item] = keyExists
+		}
+	}
+	return u
+}
+
+// Difference returns a new set which contains items which are in in the first
+// set but not in the others.
+func Difference[T comparable](set1 *Set[T], sets ...*Set[T]) *Set[T] {
+	s := set1.Copy()
+	for _, set := range sets {
+		s.Separate(set)
+	}
+	return s
+}
+
+// Intersection returns a new set which contains items that only exist in all
+// given sets.
+func Intersection[T comparable](sets ...*Set[T]) *Set[T] {
+	minPos := -1
+	minSize := maxInt
+	for i, set := range sets {
+		if l := set.Size(); l < minSize {
+			minSize = l
+			minPos = i
+		}
+	}
+	if minSize == maxInt || minSize == 0 {
+		return New[T]()
+	}
+
+	t := sets[minPos].Copy()
+	for i, set := range sets {
+		if i == minPos {
+			continue
+		}
+		for item := range t.M {
+			if _, has := set.M[item]; !has {
+				delete(t.M, item)
+			}
+		}
+	}
+	return t
+}
+
+// SymmetricDifference returns a new set which s is the difference of items
+// which are in one of either, but not in both.
+func SymmetricDifference[T comparable](s *Set[T], t *Set[T]) *Set[T] {
+	u := Difference(s, t)
+	v := Difference(t, s)
+	return Union(u, v)
+}
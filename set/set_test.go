@@ -0,0 +1,82 @@
+package set_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/wecisecode/util/set"
+	"github.com/wecisecode/util/set/b8set"
+	"github.com/wecisecode/util/set/strset"
+)
+
+func TestSet(t *testing.T) {
+	s := set.New(3, 1, 2)
+	assert.True(t, s.Has(1, 2))
+	assert.False(t, s.Has(1, 4))
+	assert.True(t, s.HasAny(4, 1))
+	assert.False(t, s.Has())
+	assert.Equal(t, []int{1, 2, 3}, set.SortedList(s))
+
+	u := set.New(3, 4)
+	assert.Equal(t, []int{1, 2, 3, 4}, set.SortedList(set.Union(s, u)))
+	assert.Equal(t, []int{1, 2}, set.SortedList(set.Difference(s, u)))
+	assert.Equal(t, []int{3}, set.SortedList(set.Intersection(s, u)))
+	assert.Equal(t, []int{1, 2, 4}, set.SortedList(set.SymmetricDifference(s, u)))
+	assert.Equal(t, 0, set.Intersection(s, set.New[int]()).Size())
+	assert.True(t, s.IsSubset(set.New(1, 3)))
+	assert.False(t, s.IsSubset(u))
+	assert.True(t, set.New(1).IsSuperset(s))
+	assert.True(t, s.IsEqual(s.Copy()))
+
+	sum := 0
+	s.Each(func(item int) bool {
+		sum += item
+		return true
+	})
+	assert.Equal(t, 6, sum)
+	for !s.IsEmpty() {
+		_, ok := s.Pop2()
+		assert.True(t, ok)
+	}
+	item, ok := s.Pop2()
+	assert.False(t, ok)
+	assert.Equal(t, 0, item)
+	assert.Equal(t, "", set.New[string]().Pop())
+}
+
+func TestSetEncoding(t *testing.T) {
+	s := set.New("b", "a")
+	bs, err := json.Marshal(s)
+	assert.Nil(t, err)
+	d := &set.Set[string]{}
+	assert.Nil(t, json.Unmarshal(bs, d))
+	assert.True(t, s.IsEqual(d))
+	assert.NotNil(t, json.Unmarshal([]byte(`[1]`), d))
+
+	// 作为结构的字段
+	type config struct {
+		Tags *set.Set[int] `json:"tags" msgpack:"tags"`
+	}
+	bs, err = msgpack.Marshal(&config{Tags: set.New(1, 2)})
+	assert.Nil(t, err)
+	c := &config{}
+	assert.Nil(t, msgpack.Unmarshal(bs, c))
+	assert.Equal(t, []int{1, 2}, set.SortedList(c.Tags))
+}
+
+// 原有的类型包是 set.Set 的别名
+func TestTypedSet(t *testing.T) {
+	var s *set.Set[string] = strset.New("b", "a")
+	s.Merge(strset.New("c"))
+	assert.Equal(t, []string{"a", "b", "c"}, set.SortedList(s))
+	assert.Equal(t, 2, strset.Difference(s, strset.New("c")).Size())
+
+	b := b8set.New([8]byte{2}, [8]byte{1})
+	list := set.SortedListFunc(b, func(x, y [8]byte) int {
+		return strings.Compare(string(x[:]), string(y[:]))
+	})
+	assert.Equal(t, [][8]byte{{1}, {2}}, list)
+}
@@ -0,0 +1,15 @@
+//go:build go1.23
+
+package sortedset
+
+import "iter"
+
+// All 按升序遍历开始时的所有元素，遍历过程中可以修改 Set
+func (s *Set[T]) All() iter.Seq[T] {
+	return s.Each
+}
+
+// Backward 按降序遍历开始时的所有元素，遍历过程中可以修改 Set
+func (s *Set[T]) Backward() iter.Seq[T] {
+	return s.EachReverse
+}
@@ -0,0 +1,30 @@
+//go:build go1.23
+
+package sortedset_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wecisecode/util/set/sortedset"
+)
+
+func TestSortedSetAll(t *testing.T) {
+	s := sortedset.New(3, 1, 2)
+	v := []int{}
+	for item := range s.All() {
+		s.Remove(item)
+		v = append(v, item)
+	}
+	assert.Equal(t, []int{1, 2, 3}, v)
+	assert.True(t, s.IsEmpty())
+	s.Add(1, 2, 3)
+	v = v[:0]
+	for item := range s.Backward() {
+		v = append(v, item)
+		if item == 2 {
+			break
+		}
+	}
+	assert.Equal(t, []int{3, 2}, v)
+}
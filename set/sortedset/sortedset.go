@@ -0,0 +1,210 @@
+package sortedset
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/wecisecode/util/sortedmap"
+)
+
+// 有序 Set，基于 sortedmap.TreapMapOf，并发安全
+// 支持范围查询 最小最大值 排名，遍历时使用开始时的快照，遍历过程中可以修改 Set
+type Set[T any] struct {
+	m *sortedmap.TreapMapOf[T, struct{}]
+}
+
+// 使用 cmp.Compare 比较元素
+func New[T cmp.Ordered](ts ...T) *Set[T] {
+	return NewFunc(cmp.Compare[T], ts...)
+}
+
+// 使用指定的比较函数，a < b 返回负数，a == b 返回 0，a > b 返回正数
+func NewFunc[T any](compare func(a, b T) int, ts ...T) *Set[T] {
+	s := &Set[T]{m: sortedmap.NewTreapMapFunc[T, struct{}](compare)}
+	s.Add(ts...)
+	return s
+}
+
+func (s *Set[T]) Add(items ...T) {
+	for _, item := range items {
+		s.m.Put(item, struct{}{})
+	}
+}
+
+// item 不存在时添加并返回 true，已存在时返回 false
+func (s *Set[T]) TryAdd(item T) bool {
+	return s.m.Put(item, struct{}{})
+}
+
+func (s *Set[T]) Remove(items ...T) {
+	for _, item := range items {
+		s.m.Delete(item)
+	}
+}
+
+// item 存在时删除并返回 true，不存在时返回 false
+func (s *Set[T]) TryRemove(item T) bool {
+	return s.m.Delete(item)
+}
+
+// 所有元素都存在时返回 true，没有参数时返回 false
+func (s *Set[T]) Has(items ...T) bool {
+	for _, item := range items {
+		if !s.m.Has(item) {
+			return false
+		}
+	}
+	return len(items) > 0
+}
+
+// 任一元素存在时返回 true
+func (s *Set[T]) HasAny(items ...T) bool {
+	for _, item := range items {
+		if s.m.Has(item) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Set[T]) Size() int {
+	return s.m.Len()
+}
+
+func (s *Set[T]) IsEmpty() bool {
+	return s.Size() == 0
+}
+
+func (s *Set[T]) Clear() {
+	s.m.Clear()
+}
+
+// 共享不可变的 treap，复制代价为 O(1)
+func (s *Set[T]) Copy() *Set[T] {
+	return &Set[T]{m: s.m.Copy()}
+}
+
+// 升序的所有元素
+func (s *Set[T]) List() []T {
+	return s.m.Keys()
+}
+
+// 按升序遍历，f 返回 false 时结束
+func (s *Set[T]) Each(f func(item T) bool) {
+	s.m.Fetch(func(key T, value struct{}) bool {
+		return f(key)
+	})
+}
+
+// 按降序遍历，f 返回 false 时结束
+func (s *Set[T]) EachReverse(f func(item T) bool) {
+	s.m.FetchReverse(func(key T, value struct{}) bool {
+		return f(key)
+	})
+}
+
+// 遍历 from 到 to 之间的元素，包括 from 和 to，from 或 to 为 nil 时不限制
+func (s *Set[T]) Range(from, to *T, f func(item T) bool, reverse bool) {
+	s.m.FetchRange(from, to, func(key T, value struct{}) bool {
+		return f(key)
+	}, reverse)
+}
+
+// from 到 to 之间的元素，包括 from 和 to，from 或 to 为 nil 时不限制
+func (s *Set[T]) RangeList(from, to *T) []T {
+	v := []T{}
+	s.Range(from, to, func(item T) bool {
+		v = append(v, item)
+		return true
+	}, false)
+	return v
+}
+
+// 删除 from 到 to 之间的元素，包括 from 和 to，from 或 to 为 nil 时不限制，返回删除的个数
+func (s *Set[T]) RemoveRange(from, to *T) int {
+	return s.m.DeleteRange(from, to)
+}
+
+func key[T any](e *sortedmap.Entry[T, struct{}]) (T, bool) {
+	if e == nil {
+		var zero T
+		return zero, false
+	}
+	return e.Key, true
+}
+
+// 最小的元素，为空时返回 false
+func (s *Set[T]) Min() (T, bool) {
+	return key(s.m.FirstItem())
+}
+
+// 最大的元素，为空时返回 false
+func (s *Set[T]) Max() (T, bool) {
+	return key(s.m.LastItem())
+}
+
+// 删除并返回最小的元素，为空时返回 false
+func (s *Set[T]) PopMin() (T, bool) {
+	return key(s.m.PopFirst())
+}
+
+// 删除并返回最大的元素，为空时返回 false
+func (s *Set[T]) PopMax() (T, bool) {
+	return key(s.m.PopLast())
+}
+
+// 小于等于 item 的最大元素，不存在时返回 false
+func (s *Set[T]) Floor(item T) (T, bool) {
+	return key(s.m.Floor(item))
+}
+
+// 大于等于 item 的最小元素，不存在时返回 false
+func (s *Set[T]) Ceiling(item T) (T, bool) {
+	return key(s.m.Ceiling(item))
+}
+
+// 小于 item 的最大元素，不存在时返回 false
+func (s *Set[T]) Lower(item T) (T, bool) {
+	return key(s.m.Lower(item))
+}
+
+// 大于 item 的最小元素，不存在时返回 false
+func (s *Set[T]) Higher(item T) (T, bool) {
+	return key(s.m.Higher(item))
+}
+
+// 小于 item 的元素个数
+func (s *Set[T]) Rank(item T) int {
+	return s.m.Rank(item)
+}
+
+// 按顺序的第 i 个元素，从 0 开始，超出范围时返回 false
+func (s *Set[T]) Select(i int) (T, bool) {
+	return key(s.m.Select(i))
+}
+
+func (s *Set[T]) String() string {
+	v := []string{}
+	s.Each(func(item T) bool {
+		v = append(v, fmt.Sprintf("%v", item))
+		return true
+	})
+	return fmt.Sprintf("[%s]", strings.Join(v, ", "))
+}
+
+// 编码为升序的 json 数组
+func (s *Set[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.List())
+}
+
+// 从 json 数组解码，添加到已有的元素中，s 需要通过 New 或 NewFunc 创建
+func (s *Set[T]) UnmarshalJSON(bs []byte) error {
+	v := []T{}
+	if err := json.Unmarshal(bs, &v); err != nil {
+		return err
+	}
+	s.Add(v...)
+	return nil
+}
@@ -0,0 +1,82 @@
+package sortedset_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wecisecode/util/set/sortedset"
+)
+
+func TestSortedSet(t *testing.T) {
+	s := sortedset.New(5, 1, 3, 9, 7)
+	assert.Equal(t, []int{1, 3, 5, 7, 9}, s.List())
+	assert.Equal(t, "[1, 3, 5, 7, 9]", s.String())
+	assert.False(t, s.TryAdd(3))
+	assert.True(t, s.Has(1, 9))
+	assert.False(t, s.Has())
+
+	v, ok := s.Min()
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+	v, _ = s.Max()
+	assert.Equal(t, 9, v)
+	v, _ = s.Floor(6)
+	assert.Equal(t, 5, v)
+	v, _ = s.Ceiling(6)
+	assert.Equal(t, 7, v)
+	v, _ = s.Lower(5)
+	assert.Equal(t, 3, v)
+	v, _ = s.Higher(5)
+	assert.Equal(t, 7, v)
+	_, ok = s.Higher(9)
+	assert.False(t, ok)
+
+	assert.Equal(t, 2, s.Rank(5))
+	assert.Equal(t, 3, s.Rank(6))
+	v, _ = s.Select(3)
+	assert.Equal(t, 7, v)
+	_, ok = s.Select(5)
+	assert.False(t, ok)
+
+	from, to := 3, 7
+	assert.Equal(t, []int{3, 5, 7}, s.RangeList(&from, &to))
+	assert.Equal(t, []int{7, 9}, s.RangeList(&to, nil))
+
+	c := s.Copy()
+	assert.Equal(t, 3, s.RemoveRange(&from, &to))
+	assert.Equal(t, []int{1, 9}, s.List())
+	assert.Equal(t, 5, c.Size())
+
+	v, _ = c.PopMin()
+	assert.Equal(t, 1, v)
+	v, _ = c.PopMax()
+	assert.Equal(t, 9, v)
+	rv := []int{}
+	c.EachReverse(func(item int) bool {
+		rv = append(rv, item)
+		return true
+	})
+	assert.Equal(t, []int{7, 5, 3}, rv)
+
+	s.Clear()
+	_, ok = s.Min()
+	assert.False(t, ok)
+	assert.True(t, s.IsEmpty())
+}
+
+func TestSortedSetFunc(t *testing.T) {
+	s := sortedset.NewFunc(func(a, b string) int {
+		return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+	}, "b", "A", "c")
+	assert.Equal(t, []string{"A", "b", "c"}, s.List())
+	assert.True(t, s.Has("a"))
+
+	bs, err := json.Marshal(s)
+	assert.Nil(t, err)
+	assert.Equal(t, `["A","b","c"]`, string(bs))
+	u := sortedset.New[string]()
+	assert.Nil(t, json.Unmarshal(bs, u))
+	assert.Equal(t, []string{"A", "b", "c"}, u.List())
+}
@@ -0,0 +1,146 @@
+package set
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// 并发安全的 Set，通过读写锁保护，零值可以直接使用
+type SyncSet[T comparable] struct {
+	mutex sync.RWMutex
+	set   Set[T]
+}
+
+func NewSync[T comparable](ts ...T) *SyncSet[T] {
+	return &SyncSet[T]{set: *New(ts...)}
+}
+
+func (s *SyncSet[T]) Add(items ...T) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.init()
+	s.set.Add(items...)
+}
+
+func (s *SyncSet[T]) init() {
+	if s.set.M == nil {
+		s.set.M = make(map[T]struct{})
+	}
+}
+
+// item 不存在时添加并返回 true，已存在时返回 false，可用于去重
+func (s *SyncSet[T]) TryAdd(item T) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.set.M[item]; ok {
+		return false
+	}
+	s.init()
+	s.set.M[item] = keyExists
+	return true
+}
+
+func (s *SyncSet[T]) Remove(items ...T) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.set.Remove(items...)
+}
+
+// item 存在时删除并返回 true，不存在时返回 false
+func (s *SyncSet[T]) TryRemove(item T) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.set.M[item]; !ok {
+		return false
+	}
+	delete(s.set.M, item)
+	return true
+}
+
+func (s *SyncSet[T]) Pop() T {
+	item, _ := s.Pop2()
+	return item
+}
+
+func (s *SyncSet[T]) Pop2() (T, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.set.Pop2()
+}
+
+func (s *SyncSet[T]) Has(items ...T) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.set.Has(items...)
+}
+
+func (s *SyncSet[T]) HasAny(items ...T) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.set.HasAny(items...)
+}
+
+func (s *SyncSet[T]) Size() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.set.Size()
+}
+
+func (s *SyncSet[T]) IsEmpty() bool {
+	return s.Size() == 0
+}
+
+func (s *SyncSet[T]) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.set.Clear()
+}
+
+// 遍历调用时的所有元素，f 中可以修改 Set
+func (s *SyncSet[T]) Each(f func(item T) bool) {
+	for _, item := range s.List() {
+		if !f(item) {
+			break
+		}
+	}
+}
+
+func (s *SyncSet[T]) List() []T {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.set.List()
+}
+
+// 当前所有元素的复制
+func (s *SyncSet[T]) Snapshot() *Set[T] {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.set.Copy()
+}
+
+// 合并 t 中的所有元素
+func (s *SyncSet[T]) Merge(t *Set[T]) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.init()
+	s.set.Merge(t)
+}
+
+func (s *SyncSet[T]) String() string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.set.String()
+}
+
+func (s *SyncSet[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.List())
+}
+
+func (s *SyncSet[T]) UnmarshalJSON(bs []byte) error {
+	v := []T{}
+	if err := json.Unmarshal(bs, &v); err != nil {
+		return err
+	}
+	s.Add(v...)
+	return nil
+}
@@ -0,0 +1,59 @@
+package set_test
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wecisecode/util/set"
+)
+
+func TestSyncSet(t *testing.T) {
+	s := &set.SyncSet[int]{}
+	assert.True(t, s.IsEmpty())
+	assert.True(t, s.TryAdd(1))
+	assert.False(t, s.TryAdd(1))
+	s.Add(2, 3)
+	assert.True(t, s.Has(1, 2, 3))
+	assert.True(t, s.HasAny(4, 3))
+	assert.True(t, s.TryRemove(3))
+	assert.False(t, s.TryRemove(3))
+	assert.Equal(t, []int{1, 2}, set.SortedList(s.Snapshot()))
+
+	s.Merge(set.New(5))
+	bs, err := json.Marshal(s)
+	assert.Nil(t, err)
+	u := set.NewSync[int]()
+	assert.Nil(t, json.Unmarshal(bs, u))
+	assert.Equal(t, []int{1, 2, 5}, set.SortedList(u.Snapshot()))
+
+	// 遍历中修改
+	s.Each(func(item int) bool {
+		s.Remove(item)
+		return true
+	})
+	assert.True(t, s.IsEmpty())
+}
+
+func TestSyncSetConcurrent(t *testing.T) {
+	s := set.NewSync[int]()
+	var added int64
+	wg := sync.WaitGroup{}
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				if s.TryAdd(i) {
+					atomic.AddInt64(&added, 1)
+				}
+				s.Has(i)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(1000), added)
+	assert.Equal(t, 1000, s.Size())
+}
@@ -33,3 +33,26 @@ type SortedMap interface {
 	MarshalJSON() ([]byte, error)
 	String() string
 }
+
+// 按 key 排序的 SortedMap，支持就近查找及顺序统计
+type NavigableMap interface {
+	SortedMap
+	// 小于等于 key 的最大项，不存在时返回 nil
+	Floor(key interface{}) *MapItem
+	// 大于等于 key 的最小项，不存在时返回 nil
+	Ceiling(key interface{}) *MapItem
+	// 小于 key 的最大项，不存在时返回 nil
+	Lower(key interface{}) *MapItem
+	// 大于 key 的最小项，不存在时返回 nil
+	Higher(key interface{}) *MapItem
+	// 小于 key 的项数
+	Rank(key interface{}) int
+	// 按顺序的第 i 项，从 0 开始，超出范围时返回 nil
+	Select(i int) *MapItem
+	// 删除并返回第一项，为空时返回 nil
+	PopFirst() *MapItem
+	// 删除并返回最后一项，为空时返回 nil
+	PopLast() *MapItem
+	// 删除 from 到 to 之间的项，包括 from 和 to，from 或 to 为 nil 时不限制，返回删除的项数
+	DeleteRange(from interface{}, to interface{}) int
+}
@@ -0,0 +1,595 @@
+package sortedmap
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/wecisecode/util/cast"
+	"github.com/wecisecode/util/merrs"
+)
+
+type PatchOp string
+
+const (
+	PatchAdd     PatchOp = "add"
+	PatchRemove  PatchOp = "remove"
+	PatchReplace PatchOp = "replace"
+)
+
+// 补丁中的一项修改，Path 为 GetPath 格式的路径
+type PatchItem struct {
+	Op    PatchOp     `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+	// 删除或替换前的值，用于审核及回滚
+	OldValue interface{} `json:"oldvalue,omitempty"`
+}
+
+// 嵌套 map 的修改，可以通过 Apply 应用，通过 Reverse 回滚
+type Patch []*PatchItem
+
+// 三路合并的冲突，双方修改了同一路径或互为上下级的路径且结果不同
+type Conflict struct {
+	Path   string      `json:"path"`
+	Base   interface{} `json:"base,omitempty"`
+	Ours   interface{} `json:"ours,omitempty"`
+	Theirs interface{} `json:"theirs,omitempty"`
+}
+
+// 比较 a b 得到从 a 修改为 b 的补丁，map 中增删的 key 为 add remove，值不同为 replace
+// 长度相同的数组逐个元素比较，长度不同时整个数组 replace
+func Diff(a, b SortedMap) Patch {
+	return diffValue(Patch{}, "", a, b)
+}
+
+func diffValue(patch Patch, path string, a, b interface{}) Patch {
+	if va, ok := a.([]interface{}); ok {
+		if vb, ok := b.([]interface{}); ok && len(va) == len(vb) {
+			for i := range va {
+				patch = diffValue(patch, joinPathIndex(path, i), va[i], vb[i])
+			}
+			return patch
+		}
+	} else if _, ok := pathMapLen(a); ok {
+		if _, ok := pathMapLen(b); ok {
+			pathMapEach(a, func(key string, va interface{}) bool {
+				p := joinPathKey(path, key)
+				if vb, ok := pathMapGet(b, key); ok {
+					patch = diffValue(patch, p, va, vb)
+				} else {
+					patch = append(patch, &PatchItem{Op: PatchRemove, Path: p, OldValue: DeepCopyValue(va, false)})
+				}
+				return true
+			})
+			pathMapEach(b, func(key string, vb interface{}) bool {
+				if _, ok := pathMapGet(a, key); !ok {
+					patch = append(patch, &PatchItem{Op: PatchAdd, Path: joinPathKey(path, key), Value: DeepCopyValue(vb, false)})
+				}
+				return true
+			})
+			return patch
+		}
+	}
+	if !valueEqual(a, b) {
+		patch = append(patch, &PatchItem{Op: PatchReplace, Path: path, Value: DeepCopyValue(b, false), OldValue: DeepCopyValue(a, false)})
+	}
+	return patch
+}
+
+func pathMapLen(v interface{}) (int, bool) {
+	switch m := v.(type) {
+	case Map:
+		return m.Len(), true
+	case map[string]interface{}:
+		return len(m), true
+	case map[interface{}]interface{}:
+		return len(m), true
+	}
+	return 0, false
+}
+
+// 嵌套的 map 及数组逐项比较，不同类型的整数及浮点数按数值比较
+func valueEqual(a, b interface{}) bool {
+	if va, ok := a.([]interface{}); ok {
+		vb, ok := b.([]interface{})
+		if !ok || len(va) != len(vb) {
+			return false
+		}
+		for i := range va {
+			if !valueEqual(va[i], vb[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	if la, ok := pathMapLen(a); ok {
+		lb, ok := pathMapLen(b)
+		if !ok || la != lb {
+			return false
+		}
+		equal := true
+		pathMapEach(a, func(key string, va interface{}) bool {
+			vb, ok := pathMapGet(b, key)
+			equal = ok && valueEqual(va, vb)
+			return equal
+		})
+		return equal
+	}
+	return reflect.DeepEqual(a, b) || numberEqual(a, b)
+}
+
+func numberEqual(a, b interface{}) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	kind := func(v reflect.Value) byte {
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return 'i'
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return 'u'
+		case reflect.Float32, reflect.Float64:
+			return 'f'
+		}
+		return 0
+	}
+	ka, kb := kind(va), kind(vb)
+	if ka == 0 || kb == 0 {
+		return false
+	}
+	if ka > kb {
+		va, vb, ka, kb = vb, va, kb, ka
+	}
+	switch {
+	case ka == 'f' || kb == 'f':
+		return toFloat(va, ka) == toFloat(vb, kb)
+	case ka == kb && ka == 'i':
+		return va.Int() == vb.Int()
+	case ka == kb:
+		return va.Uint() == vb.Uint()
+	}
+	// 'i' 与 'u'
+	return va.Int() >= 0 && uint64(va.Int()) == vb.Uint()
+}
+
+func toFloat(v reflect.Value, kind byte) float64 {
+	switch kind {
+	case 'i':
+		return float64(v.Int())
+	case 'u':
+		return float64(v.Uint())
+	}
+	return v.Float()
+}
+
+// 应用补丁，出错时 sm 不变
+// 路径按字符串与 map 中的 key 比较，已存在的 key 保持原有类型，新增的 key 为字符串
+func Apply(sm SortedMap, patch Patch) error {
+	return applyAtomic(sm, func(doc SortedMap) error {
+		for _, item := range patch {
+			if err := applyItem(doc, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func applyItem(doc SortedMap, item *PatchItem) error {
+	switch item.Op {
+	case PatchAdd, PatchReplace:
+		return SetPath(doc, item.Path, DeepCopyValue(item.Value, false))
+	case PatchRemove:
+		n, err := DeletePath(doc, item.Path)
+		if err == nil && n == 0 {
+			err = merrs.NewError("patch remove path %s not found", item.Path)
+		}
+		return err
+	}
+	return merrs.NewError("unsupported patch op %s", item.Op)
+}
+
+// 在 sm 的副本上修改，成功后替换 sm 的内容
+func applyAtomic(sm SortedMap, fn func(doc SortedMap) error) error {
+	doc := sm.DeepCopy()
+	if err := fn(doc); err != nil {
+		return err
+	}
+	sm.Clear()
+	Merge(sm, doc)
+	return nil
+}
+
+// 反向补丁，应用后恢复到应用补丁前的状态
+func (p Patch) Reverse() Patch {
+	r := make(Patch, 0, len(p))
+	for i := len(p) - 1; i >= 0; i-- {
+		item := *p[i]
+		switch item.Op {
+		case PatchAdd:
+			item.Op = PatchRemove
+			item.Value, item.OldValue = nil, item.Value
+		case PatchRemove:
+			item.Op = PatchAdd
+			item.Value, item.OldValue = item.OldValue, nil
+		case PatchReplace:
+			item.Value, item.OldValue = item.OldValue, item.Value
+		}
+		r = append(r, &item)
+	}
+	return r
+}
+
+// 解码 json 格式的补丁，值中的对象解码为 *LinkedMap
+func (p *Patch) UnmarshalJSON(bs []byte) error {
+	patch := Patch{}
+	err := NewJSONDecoder(bytes.NewReader(bs)).DecodeArray(func(i int, value interface{}) error {
+		m, ok := value.(Map)
+		if !ok {
+			return merrs.NewError("patch item %d is not an object", i)
+		}
+		item := &PatchItem{Op: PatchOp(cast.ToString(m.GetValue("op"))), Path: cast.ToString(m.GetValue("path"))}
+		item.Value, _ = m.Get("value")
+		item.OldValue, _ = m.Get("oldvalue")
+		patch = append(patch, item)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	*p = patch
+	return nil
+}
+
+// 三路合并，将 base 到 theirs 的修改合并到 ours 的副本中
+// 双方修改有冲突时保留 ours 的值并返回冲突
+func Merge3(base, ours, theirs SortedMap) (SortedMap, []*Conflict) {
+	po, pt := Diff(base, ours), Diff(base, theirs)
+	result := ours.DeepCopy()
+	conflicts := []*Conflict{}
+	for _, t := range pt {
+		conflict, same := false, false
+		for _, o := range po {
+			if !pathOverlap(o.Path, t.Path) {
+				continue
+			}
+			if o.Path == t.Path && o.Op == t.Op && valueEqual(o.Value, t.Value) {
+				same = true
+				continue
+			}
+			conflict = true
+			break
+		}
+		if !conflict && !same {
+			conflict = applyItem(result, t) != nil
+		}
+		if conflict {
+			c := &Conflict{Path: t.Path}
+			c.Base, _ = GetPath(base, t.Path)
+			c.Ours, _ = GetPath(ours, t.Path)
+			c.Theirs, _ = GetPath(theirs, t.Path)
+			conflicts = append(conflicts, c)
+		}
+	}
+	return result, conflicts
+}
+
+// 路径相同或互为上下级
+func pathOverlap(a, b string) bool {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	if a == "" || a == b {
+		return true
+	}
+	return strings.HasPrefix(b, a) && (b[len(a)] == '.' || b[len(a)] == '[')
+}
+
+// RFC 6902 JSON Patch 格式的操作
+type jsonPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// 编码为 RFC 6902 JSON Patch，路径转换为 JSON Pointer
+func (p Patch) MarshalJSONPatch() ([]byte, error) {
+	ops := make([]*jsonPatchOp, 0, len(p))
+	for _, item := range p {
+		pointer, err := pathToPointer(item.Path)
+		if err != nil {
+			return nil, err
+		}
+		op := &jsonPatchOp{Op: string(item.Op), Path: pointer}
+		if item.Op != PatchRemove {
+			if op.Value, err = json.Marshal(item.Value); err != nil {
+				return nil, merrs.NewError(err)
+			}
+		}
+		ops = append(ops, op)
+	}
+	bs, err := json.Marshal(ops)
+	if err != nil {
+		return nil, merrs.NewError(err)
+	}
+	return bs, nil
+}
+
+func pathToPointer(path string) (string, error) {
+	elems, err := parsePath(path)
+	if err != nil {
+		return "", err
+	}
+	sb := strings.Builder{}
+	for _, e := range elems {
+		sb.WriteByte('/')
+		if e.isIndex {
+			sb.WriteString(strconv.Itoa(e.index))
+		} else {
+			sb.WriteString(strings.ReplaceAll(strings.ReplaceAll(e.key, "~", "~0"), "/", "~1"))
+		}
+	}
+	return sb.String(), nil
+}
+
+// 应用 RFC 6902 JSON Patch，支持 add remove replace move copy test，出错时 sm 不变
+func ApplyJSONPatch(sm SortedMap, bs []byte) error {
+	ops := []*jsonPatchOp{}
+	if err := json.Unmarshal(bs, &ops); err != nil {
+		return merrs.NewError(err)
+	}
+	return applyAtomic(sm, func(doc SortedMap) error {
+		for _, op := range ops {
+			if err := applyJSONPatchOp(doc, op); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func applyJSONPatchOp(doc SortedMap, op *jsonPatchOp) error {
+	var value interface{}
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return merrs.NewError("json patch %s %s missing value", op.Op, op.Path)
+		}
+		v, err := NewJSONDecoder(bytes.NewReader(op.Value)).Decode()
+		if err != nil {
+			return err
+		}
+		value = v
+	case "move", "copy":
+		if op.Op == "move" && strings.HasPrefix(op.Path, op.From+"/") {
+			return merrs.NewError("json patch move %s to its child %s", op.From, op.Path)
+		}
+		from, err := resolvePointer(doc, op.From)
+		if err != nil {
+			return err
+		}
+		v, ok := from.get(doc)
+		if !ok {
+			return merrs.NewError("json patch %s from %s not found", op.Op, op.From)
+		}
+		if op.Op == "move" {
+			if err := from.remove(doc); err != nil {
+				return err
+			}
+		} else {
+			v = DeepCopyValue(v, false)
+		}
+		value = v
+	case "remove":
+	default:
+		return merrs.NewError("unsupported json patch op %s", op.Op)
+	}
+	target, err := resolvePointer(doc, op.Path)
+	if err != nil {
+		return err
+	}
+	switch op.Op {
+	case "remove":
+		return target.remove(doc)
+	case "replace":
+		if _, ok := target.get(doc); !ok {
+			return merrs.NewError("json patch replace %s not found", op.Path)
+		}
+		return target.set(doc, value, false)
+	case "test":
+		if v, ok := target.get(doc); !ok || !valueEqual(v, value) {
+			return merrs.NewError("json patch test %s failed", op.Path)
+		}
+		return nil
+	}
+	return target.set(doc, value, true)
+}
+
+// JSON Pointer 指向的位置，elem 为 nil 时为根
+type pointerTarget struct {
+	pointer string
+	parent  string
+	elem    *pathElem
+}
+
+// 按 doc 中的实际类型将 JSON Pointer 转换为路径，数组中的 - 表示末尾之后
+func resolvePointer(doc SortedMap, pointer string) (*pointerTarget, error) {
+	t := &pointerTarget{pointer: pointer}
+	if pointer == "" {
+		return t, nil
+	}
+	if pointer[0] != '/' {
+		return nil, merrs.NewError("json pointer %s must start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	var cur interface{} = doc
+	for i, token := range tokens {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		var e *pathElem
+		if vs, ok := cur.([]interface{}); ok {
+			idx := len(vs)
+			if token != "-" {
+				n, err := strconv.Atoi(token)
+				if err != nil || n < 0 || len(token) > 1 && token[0] == '0' {
+					return nil, merrs.NewError("json pointer %s has invalid index %s", pointer, token)
+				}
+				idx = n
+			}
+			e = &pathElem{isIndex: true, index: idx}
+		} else if _, ok := pathMapLen(cur); ok {
+			e = &pathElem{key: token}
+		} else {
+			return nil, merrs.NewError("json pointer %s not found", pointer)
+		}
+		if i == len(tokens)-1 {
+			t.elem = e
+			return t, nil
+		}
+		v, ok := elemValue(cur, e)
+		if !ok {
+			return nil, merrs.NewError("json pointer %s not found", pointer)
+		}
+		if e.isIndex {
+			t.parent = joinPathIndex(t.parent, e.index)
+		} else {
+			t.parent = joinPathKey(t.parent, e.key)
+		}
+		cur = v
+	}
+	return t, nil
+}
+
+func elemValue(v interface{}, e *pathElem) (interface{}, bool) {
+	if e.isIndex {
+		vs, ok := v.([]interface{})
+		if !ok || e.index >= len(vs) {
+			return nil, false
+		}
+		return vs[e.index], true
+	}
+	return pathMapGet(v, e.key)
+}
+
+func (t *pointerTarget) get(doc SortedMap) (interface{}, bool) {
+	if t.elem == nil {
+		return doc, true
+	}
+	parent, _ := GetPath(doc, t.parent)
+	return elemValue(parent, t.elem)
+}
+
+// insert 为 true 时在数组中插入，否则替换数组元素
+func (t *pointerTarget) set(doc SortedMap, value interface{}, insert bool) error {
+	if t.elem == nil {
+		sm, ok := value.(SortedMap)
+		if !ok {
+			return merrs.NewError("json patch root value must be an object")
+		}
+		doc.Clear()
+		Merge(doc, sm)
+		return nil
+	}
+	parent, _ := GetPath(doc, t.parent)
+	if !t.elem.isIndex {
+		pathMapPut(parent, t.elem.key, value)
+		return nil
+	}
+	// resolvePointer 保证上一级为数组
+	vs := parent.([]interface{})
+	i := t.elem.index
+	if !insert {
+		if i >= len(vs) {
+			return merrs.NewError("json pointer %s not found", t.pointer)
+		}
+		vs[i] = value
+		return nil
+	}
+	if i > len(vs) {
+		return merrs.NewError("json pointer %s index out of range %d", t.pointer, len(vs))
+	}
+	vs = append(vs, nil)
+	copy(vs[i+1:], vs[i:])
+	vs[i] = value
+	return SetPath(doc, t.parent, vs)
+}
+
+func (t *pointerTarget) remove(doc SortedMap) error {
+	if t.elem == nil {
+		return merrs.NewError("json patch can not remove root")
+	}
+	parent, _ := GetPath(doc, t.parent)
+	if t.elem.isIndex {
+		vs := parent.([]interface{})
+		i := t.elem.index
+		if i >= len(vs) {
+			return merrs.NewError("json pointer %s not found", t.pointer)
+		}
+		return SetPath(doc, t.parent, append(vs[:i], vs[i+1:]...))
+	}
+	if !pathMapDelete(parent, t.elem.key) {
+		return merrs.NewError("json pointer %s not found", t.pointer)
+	}
+	return nil
+}
+
+// 生成从 a 修改为 b 的 RFC 7386 JSON Merge Patch，删除的 key 为 null，数组整体替换
+func CreateMergePatch(a, b SortedMap) ([]byte, error) {
+	return MarshalJSON(mergePatchOf(a, b))
+}
+
+func mergePatchOf(a, b interface{}) SortedMap {
+	patch := NewLinkedMap()
+	pathMapEach(a, func(key string, va interface{}) bool {
+		if _, ok := pathMapGet(b, key); !ok {
+			patch.Put(key, nil)
+		}
+		return true
+	})
+	pathMapEach(b, func(key string, vb interface{}) bool {
+		va, ok := pathMapGet(a, key)
+		_, amap := pathMapLen(va)
+		_, bmap := pathMapLen(vb)
+		if ok && amap && bmap {
+			if sub := mergePatchOf(va, vb); sub.Len() > 0 {
+				patch.Put(key, sub)
+			}
+		} else if !ok || !valueEqual(va, vb) {
+			patch.Put(key, vb)
+		}
+		return true
+	})
+	return patch
+}
+
+// 应用 RFC 7386 JSON Merge Patch，值为 null 时删除 key，对象递归合并，其它值直接替换
+func ApplyMergePatch(sm SortedMap, bs []byte) error {
+	patch := NewLinkedMap()
+	if err := DecodeJSON(patch, bytes.NewReader(bs)); err != nil {
+		return err
+	}
+	return applyAtomic(sm, func(doc SortedMap) error {
+		mergePatch(doc, patch)
+		return nil
+	})
+}
+
+func mergePatch(target interface{}, patch SortedMap) interface{} {
+	if _, ok := pathMapLen(target); !ok {
+		target = NewLinkedMap()
+	}
+	patch.Fetch(func(k, v interface{}) bool {
+		key := cast.ToString(k)
+		if v == nil {
+			pathMapDelete(target, key)
+		} else if pm, ok := v.(SortedMap); ok {
+			old, _ := pathMapGet(target, key)
+			pathMapPut(target, key, mergePatch(old, pm))
+		} else {
+			pathMapPut(target, key, v)
+		}
+		return true
+	})
+	return target
+}
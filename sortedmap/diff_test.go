@@ -0,0 +1,148 @@
+package sortedmap_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wecisecode/util/sortedmap"
+)
+
+func parseLinkedMap(t *testing.T, s string) *sortedmap.LinkedMap {
+	sm := sortedmap.NewLinkedMap()
+	assert.Nil(t, sm.UnmarshalJSON([]byte(s)))
+	return sm
+}
+
+func TestDiffApply(t *testing.T) {
+	a := parseLinkedMap(t, `{"db":{"host":"a","port":3306,"opts":["x","y"]},"old":1,"list":[1,2]}`)
+	b := parseLinkedMap(t, `{"db":{"host":"b","port":3306,"opts":["x","z"]},"list":[1,2,3],"new":{"k":true}}`)
+	patch := sortedmap.Diff(a, b)
+	assert.Equal(t, sortedmap.Patch{
+		{Op: sortedmap.PatchReplace, Path: "db.host", Value: "b", OldValue: "a"},
+		{Op: sortedmap.PatchReplace, Path: "db.opts[1]", Value: "z", OldValue: "y"},
+		{Op: sortedmap.PatchRemove, Path: "old", OldValue: int64(1)},
+		{Op: sortedmap.PatchReplace, Path: "list", Value: []interface{}{int64(1), int64(2), int64(3)}, OldValue: []interface{}{int64(1), int64(2)}},
+		{Op: sortedmap.PatchAdd, Path: "new", Value: parseLinkedMap(t, `{"k":true}`)},
+	}, patch)
+	// 数值按值比较
+	assert.Equal(t, 0, len(sortedmap.Diff(a, sortedmap.NewLinkedMap().PutAll(map[string]interface{}{
+		"db":   map[string]interface{}{"host": "a", "port": 3306, "opts": []interface{}{"x", "y"}},
+		"old":  1.0,
+		"list": []interface{}{uint8(1), 2},
+	}))))
+
+	// 编码后解码的补丁与原补丁一致
+	bs, err := json.Marshal(patch)
+	assert.Nil(t, err)
+	decoded := sortedmap.Patch{}
+	assert.Nil(t, json.Unmarshal(bs, &decoded))
+	assert.Equal(t, patch, decoded)
+
+	c := a.DeepCopy()
+	assert.Nil(t, sortedmap.Apply(c, decoded))
+	assert.Equal(t, 0, len(sortedmap.Diff(c, b)))
+	// 回滚
+	assert.Nil(t, sortedmap.Apply(c, patch.Reverse()))
+	assert.Equal(t, 0, len(sortedmap.Diff(c, a)))
+
+	// 出错时不修改
+	err = sortedmap.Apply(c, sortedmap.Patch{
+		{Op: sortedmap.PatchRemove, Path: "old"},
+		{Op: sortedmap.PatchRemove, Path: "missing"},
+	})
+	assert.NotNil(t, err)
+	assert.True(t, c.Has("old"))
+}
+
+func TestDiffApplyIntKeys(t *testing.T) {
+	a := sortedmap.NewTreeMap()
+	a.Put(1, "a")
+	a.Put(2, "b")
+	a.Put(3, map[interface{}]interface{}{10: "x", 20: "y"})
+	b := sortedmap.NewTreeMap()
+	b.Put(1, "c")
+	b.Put(3, map[interface{}]interface{}{10: "x", 30: "z"})
+	patch := sortedmap.Diff(a, b)
+	assert.Equal(t, 4, len(patch))
+
+	c := a.DeepCopy()
+	assert.Nil(t, sortedmap.Apply(c, patch))
+	assert.Equal(t, 0, len(sortedmap.Diff(c, b)))
+	// 替换原有的 int key，不增加字符串 key
+	assert.Equal(t, []interface{}{1, 3}, c.Keys())
+	// 路径中没有 key 的类型，新增的 key 为字符串
+	assert.Nil(t, sortedmap.Apply(c, patch.Reverse()))
+	assert.Equal(t, 0, len(sortedmap.Diff(c, a)))
+	assert.Equal(t, 3, c.Len())
+	assert.True(t, c.Has("2"))
+
+	d := sortedmap.NewTreeMap()
+	d.Put(1, "a")
+	d.Put(2, map[interface{}]interface{}{10: "x", 20: "y"})
+	assert.Nil(t, sortedmap.SetPath(d, "1", "b"))
+	assert.Equal(t, []interface{}{1, 2}, d.Keys())
+	assert.Equal(t, "b", d.GetValue(1))
+	n, err := sortedmap.DeletePath(d, "2.10")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, map[interface{}]interface{}{20: "y"}, d.GetValue(2))
+}
+
+func TestMerge3(t *testing.T) {
+	base := parseLinkedMap(t, `{"a":1,"b":{"c":1,"d":1},"e":[1,2],"f":1}`)
+	ours := parseLinkedMap(t, `{"a":2,"b":{"c":2,"d":1},"e":[1,2],"f":2}`)
+	theirs := parseLinkedMap(t, `{"a":2,"b":{"c":3,"d":2},"e":[1,2,3]}`)
+	result, conflicts := sortedmap.Merge3(base, ours, theirs)
+	assert.Equal(t, `{"a":2,"b":{"c":2,"d":2},"e":[1,2,3],"f":2}`, mustJSON(t, result))
+	assert.Equal(t, []*sortedmap.Conflict{
+		{Path: "b.c", Base: int64(1), Ours: int64(2), Theirs: int64(3)},
+		{Path: "f", Base: int64(1), Ours: int64(2)},
+	}, conflicts)
+}
+
+func mustJSON(t *testing.T, v interface{}) string {
+	bs, err := json.Marshal(v)
+	assert.Nil(t, err)
+	return string(bs)
+}
+
+func TestJSONPatch(t *testing.T) {
+	a := parseLinkedMap(t, `{"a/b":{"c":[1,2]},"d":"x"}`)
+	b := parseLinkedMap(t, `{"a/b":{"c":[1,3]},"e~":null}`)
+	bs, err := sortedmap.Diff(a, b).MarshalJSONPatch()
+	assert.Nil(t, err)
+	assert.Equal(t, `[{"op":"replace","path":"/a~1b/c/1","value":3},{"op":"remove","path":"/d"},{"op":"add","path":"/e~0","value":null}]`, string(bs))
+	c := a.DeepCopy()
+	assert.Nil(t, sortedmap.ApplyJSONPatch(c, bs))
+	assert.Equal(t, mustJSON(t, b), mustJSON(t, c))
+
+	// RFC 6902 示例中的数组插入 移动 复制 测试
+	sm := parseLinkedMap(t, `{"foo":["bar","baz"],"x":{"y":1}}`)
+	assert.Nil(t, sortedmap.ApplyJSONPatch(sm, []byte(`[
+		{"op":"add","path":"/foo/1","value":"qux"},
+		{"op":"add","path":"/foo/-","value":{"n":1}},
+		{"op":"move","from":"/x/y","path":"/foo/0"},
+		{"op":"copy","from":"/foo/4","path":"/z"},
+		{"op":"test","path":"/foo/2","value":"qux"}
+	]`)))
+	assert.Equal(t, `{"foo":[1,"bar","qux","baz",{"n":1}],"x":{},"z":{"n":1}}`, mustJSON(t, sm))
+
+	// 任一操作失败时不修改
+	assert.NotNil(t, sortedmap.ApplyJSONPatch(sm, []byte(`[{"op":"remove","path":"/z"},{"op":"test","path":"/foo/0","value":2}]`)))
+	assert.NotNil(t, sortedmap.ApplyJSONPatch(sm, []byte(`[{"op":"remove","path":"/foo/9"}]`)))
+	assert.NotNil(t, sortedmap.ApplyJSONPatch(sm, []byte(`[{"op":"add","path":"/foo/01","value":1}]`)))
+	assert.NotNil(t, sortedmap.ApplyJSONPatch(sm, []byte(`[{"op":"move","from":"/foo","path":"/foo/0"}]`)))
+	assert.True(t, sm.Has("z"))
+}
+
+func TestMergePatch(t *testing.T) {
+	a := parseLinkedMap(t, `{"title":"Goodbye!","author":{"givenName":"John","familyName":"Doe"},"tags":["example","sample"],"content":"x"}`)
+	b := parseLinkedMap(t, `{"title":"Hello!","author":{"givenName":"John"},"tags":["example"],"content":"x","phoneNumber":"+01-123-456-7890"}`)
+	bs, err := sortedmap.CreateMergePatch(a, b)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"title":"Hello!","author":{"familyName":null},"tags":["example"],"phoneNumber":"+01-123-456-7890"}`, string(bs))
+	assert.Nil(t, sortedmap.ApplyMergePatch(a, bs))
+	assert.Equal(t, mustJSON(t, b), mustJSON(t, a))
+	assert.NotNil(t, sortedmap.ApplyMergePatch(a, []byte(`[1]`)))
+}
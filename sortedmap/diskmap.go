@@ -0,0 +1,667 @@
+package sortedmap
+
+import (
+	"cmp"
+	"encoding/json"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wecisecode/util/merrs"
+	"github.com/wecisecode/util/msgpack"
+)
+
+type DiskMapOption struct {
+	// 新建文件时的页大小，默认 4096，打开已有文件时使用文件中记录的页大小
+	PageSize int
+	// 每个节点的最大 key 数，默认 64
+	MaxKeys int
+	// 缓存的节点数，默认 1024
+	CacheSize int
+	// 提交时不调用 fsync，进程异常退出不会丢失已提交的数据，操作系统崩溃时可能丢失
+	NoSync bool
+}
+
+// 保存在单个本地文件中的 B+树 SortedMap
+// 修改在 Commit 后写入文件，提交是原子的，崩溃后打开时恢复到最后一次成功提交的状态
+// key 支持字符串 整数 浮点数 time.Time，整数统一转换为 int64，浮点数转换为 float64
+// value 通过 msgpack 编码保存，读取时为 msgpack 解码后的类型，如 map 解码为 map[string]interface{}，整数的类型与数值大小有关
+// 同一文件只能由一个 DiskMap 打开
+type DiskMap struct {
+	mutex   sync.Mutex
+	pager   *diskPager
+	maxKeys int
+	err     error
+}
+
+var _ SortedMap = &DiskMap{}
+
+func OpenDiskMap(path string, opt *DiskMapOption) (*DiskMap, error) {
+	o := DiskMapOption{}
+	if opt != nil {
+		o = *opt
+	}
+	if o.PageSize <= 0 {
+		o.PageSize = 4096
+	}
+	if o.PageSize < diskMetaSize {
+		return nil, merrs.NewError("sortedmap disk page size %d is too small", o.PageSize)
+	}
+	if o.MaxKeys < 4 {
+		o.MaxKeys = 64
+	}
+	if o.CacheSize <= 0 {
+		o.CacheSize = 1024
+	}
+	p, err := openDiskPager(path, &o)
+	if err != nil {
+		return nil, err
+	}
+	return &DiskMap{pager: p, maxKeys: o.MaxKeys}, nil
+}
+
+// 统一 key 的类型，保证编码解码前后比较结果一致
+func normalizeDiskKey(key interface{}) (interface{}, error) {
+	switch k := key.(type) {
+	case string:
+		return k, nil
+	case []byte:
+		return string(k), nil
+	case int:
+		return int64(k), nil
+	case int8:
+		return int64(k), nil
+	case int16:
+		return int64(k), nil
+	case int32:
+		return int64(k), nil
+	case int64:
+		return k, nil
+	case uint:
+		return normalizeDiskKey(uint64(k))
+	case uint8:
+		return int64(k), nil
+	case uint16:
+		return int64(k), nil
+	case uint32:
+		return int64(k), nil
+	case uint64:
+		if k <= math.MaxInt64 {
+			return int64(k), nil
+		}
+		return k, nil
+	case float32:
+		return float64(k), nil
+	case float64:
+		return k, nil
+	case time.Time:
+		return k, nil
+	case *time.Time:
+		if k != nil {
+			return *k, nil
+		}
+	}
+	return nil, merrs.NewError("sortedmap disk map unsupported key type %T", key)
+}
+
+// 数值 < 字符串 < 时间
+func diskKeyRank(k interface{}) int {
+	switch k.(type) {
+	case int64, uint64, float64:
+		return 0
+	case string:
+		return 1
+	}
+	return 2
+}
+
+func diskKeyCompare(a, b interface{}) int {
+	switch x := a.(type) {
+	case int64:
+		switch y := b.(type) {
+		case int64:
+			return cmp.Compare(x, y)
+		case uint64:
+			// uint64 只用于大于 math.MaxInt64 的值
+			return -1
+		case float64:
+			return cmp.Compare(float64(x), y)
+		}
+	case uint64:
+		switch y := b.(type) {
+		case int64:
+			return 1
+		case uint64:
+			return cmp.Compare(x, y)
+		case float64:
+			return cmp.Compare(float64(x), y)
+		}
+	case float64:
+		switch y := b.(type) {
+		case int64:
+			return cmp.Compare(x, float64(y))
+		case uint64:
+			return cmp.Compare(x, float64(y))
+		case float64:
+			return cmp.Compare(x, y)
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y)
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			return x.Compare(y)
+		}
+	}
+	return cmp.Compare(diskKeyRank(a), diskKeyRank(b))
+}
+
+// 第一个大于等于 key 的位置
+func diskSearch(keys []interface{}, key interface{}) (int, bool) {
+	i := sort.Search(len(keys), func(i int) bool { return diskKeyCompare(keys[i], key) >= 0 })
+	return i, i < len(keys) && diskKeyCompare(keys[i], key) == 0
+}
+
+// key 所在的子节点
+func diskChildIndex(keys []interface{}, key interface{}) int {
+	return sort.Search(len(keys), func(i int) bool { return diskKeyCompare(keys[i], key) > 0 })
+}
+
+func insertAt[T any](s []T, i int, v T) []T {
+	var zero T
+	s = append(s, zero)
+	copy(s[i+1:], s[i:])
+	s[i] = v
+	return s
+}
+
+func removeAt[T any](s []T, i int) []T {
+	copy(s[i:], s[i+1:])
+	var zero T
+	s[len(s)-1] = zero
+	return s[:len(s)-1]
+}
+
+func (m *DiskMap) setErr(err error) {
+	if err != nil && m.err == nil {
+		m.err = err
+	}
+}
+
+// SortedMap 接口方法中发生的第一个错误
+func (m *DiskMap) Err() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.err
+}
+
+// 设置 key 对应的值，key 不存在时返回 true
+// 出错时回滚所有未提交的修改
+func (m *DiskMap) Set(key interface{}, value interface{}) (inserted bool, err error) {
+	if key, err = normalizeDiskKey(key); err != nil {
+		return
+	}
+	bs, err := msgpack.Encode(value)
+	if err != nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	p := m.pager
+	root := p.root
+	if root == 0 {
+		root = p.newNode(true).id
+	}
+	id, sep, right, inserted, err := m.insert(root, key, bs)
+	if err != nil {
+		p.rollback()
+		return false, err
+	}
+	if right != 0 {
+		r := p.newNode(false)
+		r.keys = []interface{}{sep}
+		r.children = []uint64{id, right}
+		id = r.id
+	}
+	p.root = id
+	if inserted {
+		p.count++
+	}
+	return inserted, nil
+}
+
+// 返回修改后的节点编号，节点分裂时返回分隔 key 及右侧的新节点
+func (m *DiskMap) insert(id uint64, key interface{}, value []byte) (newID uint64, sep interface{}, right uint64, inserted bool, err error) {
+	p := m.pager
+	n, err := p.node(id)
+	if err != nil {
+		return
+	}
+	if n.leaf {
+		i, found := diskSearch(n.keys, key)
+		n = p.mutable(n)
+		if found {
+			n.values[i] = value
+			return n.id, nil, 0, false, nil
+		}
+		n.keys = insertAt(n.keys, i, key)
+		n.values = insertAt(n.values, i, value)
+		inserted = true
+	} else {
+		ci := diskChildIndex(n.keys, key)
+		var cid, cright uint64
+		var csep interface{}
+		cid, csep, cright, inserted, err = m.insert(n.children[ci], key, value)
+		if err != nil {
+			return
+		}
+		n = p.mutable(n)
+		n.children[ci] = cid
+		if cright != 0 {
+			n.keys = insertAt(n.keys, ci, csep)
+			n.children = insertAt(n.children, ci+1, cright)
+		}
+	}
+	if len(n.keys) <= m.maxKeys {
+		return n.id, nil, 0, inserted, nil
+	}
+	r := p.newNode(n.leaf)
+	mid := len(n.keys) / 2
+	if n.leaf {
+		sep = n.keys[mid]
+		r.keys = append(r.keys, n.keys[mid:]...)
+		r.values = append(r.values, n.values[mid:]...)
+		n.keys = n.keys[:mid:mid]
+		n.values = n.values[:mid:mid]
+	} else {
+		sep = n.keys[mid]
+		r.keys = append(r.keys, n.keys[mid+1:]...)
+		r.children = append(r.children, n.children[mid+1:]...)
+		n.keys = n.keys[:mid:mid]
+		n.children = n.children[: mid+1 : mid+1]
+	}
+	return n.id, sep, r.id, inserted, nil
+}
+
+// 删除 key，key 存在时返回 true
+// 出错时回滚所有未提交的修改
+func (m *DiskMap) Remove(key interface{}) (removed bool, err error) {
+	if key, err = normalizeDiskKey(key); err != nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	p := m.pager
+	if p.root == 0 {
+		return false, nil
+	}
+	id, removed, err := m.remove(p.root, key)
+	if err != nil {
+		p.rollback()
+		return false, err
+	}
+	if !removed {
+		return false, nil
+	}
+	p.count--
+	// 根节点只有一个子节点时降低树高
+	for id != 0 {
+		root, err := p.node(id)
+		if err != nil {
+			p.rollback()
+			return false, err
+		}
+		if len(root.keys) > 0 {
+			break
+		}
+		p.freeNode(root)
+		id = 0
+		if !root.leaf {
+			id = root.children[0]
+		}
+	}
+	p.root = id
+	return true, nil
+}
+
+func (m *DiskMap) remove(id uint64, key interface{}) (uint64, bool, error) {
+	p := m.pager
+	n, err := p.node(id)
+	if err != nil {
+		return id, false, err
+	}
+	if n.leaf {
+		i, found := diskSearch(n.keys, key)
+		if !found {
+			return id, false, nil
+		}
+		n = p.mutable(n)
+		n.keys = removeAt(n.keys, i)
+		n.values = removeAt(n.values, i)
+		return n.id, true, nil
+	}
+	ci := diskChildIndex(n.keys, key)
+	cid, removed, err := m.remove(n.children[ci], key)
+	if err != nil || !removed {
+		return id, removed, err
+	}
+	n = p.mutable(n)
+	n.children[ci] = cid
+	if child := p.dirty[cid]; len(child.keys) < m.maxKeys/2 && len(n.children) > 1 {
+		if err := m.merge(n, ci); err != nil {
+			return id, false, err
+		}
+	}
+	return n.id, true, nil
+}
+
+// 子节点 ci 与相邻节点合并后不超过最大 key 数时合并
+func (m *DiskMap) merge(n *diskNode, ci int) error {
+	p := m.pager
+	li := ci
+	if li == len(n.children)-1 {
+		li--
+	}
+	left, err := p.node(n.children[li])
+	if err != nil {
+		return err
+	}
+	right, err := p.node(n.children[li+1])
+	if err != nil {
+		return err
+	}
+	size := len(left.keys) + len(right.keys)
+	if !left.leaf {
+		size++
+	}
+	if size > m.maxKeys {
+		return nil
+	}
+	left = p.mutable(left)
+	if left.leaf {
+		left.keys = append(left.keys, right.keys...)
+		left.values = append(left.values, right.values...)
+	} else {
+		left.keys = append(append(left.keys, n.keys[li]), right.keys...)
+		left.children = append(left.children, right.children...)
+	}
+	p.freeNode(right)
+	n.children[li] = left.id
+	n.keys = removeAt(n.keys, li)
+	n.children = removeAt(n.children, li+1)
+	return nil
+}
+
+// 获取 key 对应的值
+func (m *DiskMap) Lookup(key interface{}) (value interface{}, ok bool, err error) {
+	if key, err = normalizeDiskKey(key); err != nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	p := m.pager
+	id := p.root
+	for id != 0 {
+		n, err := p.node(id)
+		if err != nil {
+			return nil, false, err
+		}
+		if !n.leaf {
+			id = n.children[diskChildIndex(n.keys, key)]
+			continue
+		}
+		i, found := diskSearch(n.keys, key)
+		if !found {
+			return nil, false, nil
+		}
+		err = msgpack.Decode(n.values[i], &value)
+		return value, err == nil, err
+	}
+	return nil, false, nil
+}
+
+// 遍历 from 到 to 之间的数据，包括 from 和 to，from 或 to 为 nil 时不限制
+func (m *DiskMap) Scan(from, to interface{}, reverse bool, p func(key interface{}, value interface{}) bool) (err error) {
+	var pfrom, pto *interface{}
+	if from != nil {
+		if from, err = normalizeDiskKey(from); err != nil {
+			return
+		}
+		pfrom = &from
+	}
+	if to != nil {
+		if to, err = normalizeDiskKey(to); err != nil {
+			return
+		}
+		pto = &to
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.pager.root == 0 {
+		return nil
+	}
+	_, err = m.scan(m.pager.root, pfrom, pto, reverse, func(key interface{}, bs []byte) (bool, error) {
+		var value interface{}
+		if err := msgpack.Decode(bs, &value); err != nil {
+			return false, err
+		}
+		return p(key, value), nil
+	})
+	return err
+}
+
+func (m *DiskMap) scan(id uint64, from, to *interface{}, reverse bool, p func(key interface{}, value []byte) (bool, error)) (bool, error) {
+	n, err := m.pager.node(id)
+	if err != nil {
+		return false, err
+	}
+	if n.leaf {
+		start, end := 0, len(n.keys)
+		if from != nil {
+			start, _ = diskSearch(n.keys, *from)
+		}
+		if to != nil {
+			end = diskChildIndex(n.keys, *to)
+		}
+		for i := start; i < end; i++ {
+			k := i
+			if reverse {
+				k = end - 1 - (i - start)
+			}
+			if ok, err := p(n.keys[k], n.values[k]); !ok || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+	start, end := 0, len(n.children)-1
+	if from != nil {
+		start = diskChildIndex(n.keys, *from)
+	}
+	if to != nil {
+		end = diskChildIndex(n.keys, *to)
+	}
+	for i := start; i <= end; i++ {
+		c := i
+		if reverse {
+			c = end - (i - start)
+		}
+		if ok, err := m.scan(n.children[c], from, to, reverse, p); !ok || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// 提交修改，提交完成前崩溃不影响之前提交的数据
+func (m *DiskMap) Commit() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.pager.commit()
+}
+
+// 放弃未提交的修改
+func (m *DiskMap) Rollback() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.pager.rollback()
+}
+
+// 提交修改并关闭文件
+func (m *DiskMap) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	err := m.pager.commit()
+	if e := m.pager.close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+func (m *DiskMap) Put(key interface{}, value interface{}) bool {
+	inserted, err := m.Set(key, value)
+	m.mutex.Lock()
+	m.setErr(err)
+	m.mutex.Unlock()
+	return inserted
+}
+
+func (m *DiskMap) Delete(key interface{}) bool {
+	removed, err := m.Remove(key)
+	m.mutex.Lock()
+	m.setErr(err)
+	m.mutex.Unlock()
+	return removed
+}
+
+func (m *DiskMap) Get(key interface{}, defaultValue ...interface{}) (interface{}, bool) {
+	value, ok, err := m.Lookup(key)
+	if err != nil {
+		m.mutex.Lock()
+		m.setErr(err)
+		m.mutex.Unlock()
+	}
+	if ok {
+		return value, true
+	}
+	if len(defaultValue) > 0 {
+		return defaultValue[0], false
+	}
+	return nil, false
+}
+
+func (m *DiskMap) GetValue(key interface{}, defaultValue ...interface{}) interface{} {
+	value, _ := m.Get(key, defaultValue...)
+	return value
+}
+
+func (m *DiskMap) Has(key interface{}) bool {
+	_, ok := m.Get(key)
+	return ok
+}
+
+func (m *DiskMap) Len() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return int(m.pager.count)
+}
+
+func (m *DiskMap) Keys() []interface{} {
+	keys := []interface{}{}
+	m.Fetch(func(key, value interface{}) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+func (m *DiskMap) Values() []interface{} {
+	vals := []interface{}{}
+	m.Fetch(func(key, value interface{}) bool {
+		vals = append(vals, value)
+		return true
+	})
+	return vals
+}
+
+// p 中不能修改 map
+func (m *DiskMap) Fetch(p func(key interface{}, value interface{}) bool) {
+	m.FetchRange(nil, nil, p, false)
+}
+
+// p 中不能修改 map
+func (m *DiskMap) FetchReverse(p func(key interface{}, value interface{}) bool) {
+	m.FetchRange(nil, nil, p, true)
+}
+
+// p 中不能修改 map
+func (m *DiskMap) FetchRange(from interface{}, to interface{}, p func(key interface{}, value interface{}) bool, reverse bool) {
+	if err := m.Scan(from, to, reverse, p); err != nil {
+		m.mutex.Lock()
+		m.setErr(err)
+		m.mutex.Unlock()
+	}
+}
+
+func (m *DiskMap) item(reverse bool) (mi *MapItem) {
+	m.FetchRange(nil, nil, func(key, value interface{}) bool {
+		mi = &MapItem{Key: key, Value: value}
+		return false
+	}, reverse)
+	return
+}
+
+func (m *DiskMap) FirstItem() *MapItem {
+	return m.item(false)
+}
+
+func (m *DiskMap) LastItem() *MapItem {
+	return m.item(true)
+}
+
+// 删除所有数据，提交后生效
+func (m *DiskMap) Clear() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.pager.freeAll()
+}
+
+func (m *DiskMap) PutAll(amap interface{}) SortedMap {
+	if sm, ok := amap.(SortedMap); ok {
+		Merge(m, sm)
+	} else {
+		MergeMap(m, amap)
+	}
+	return m
+}
+
+// 复制到内存中的 TreapMap
+func (m *DiskMap) Copy() SortedMap {
+	sm := NewTreapMap()
+	Merge(sm, m)
+	return sm
+}
+
+// 深层复制到内存中的 TreapMap
+func (m *DiskMap) DeepCopy() SortedMap {
+	sm := NewTreapMap()
+	DeepMerge(sm, m, true)
+	return sm
+}
+
+func (m *DiskMap) UnmarshalJSON(bs []byte) (err error) {
+	err = UnmarshalJSON(m, bs)
+	return
+}
+
+func (m *DiskMap) MarshalJSON() ([]byte, error) {
+	return MarshalJSON(m)
+}
+
+func (m *DiskMap) String() string {
+	bs, _ := json.MarshalIndent(m, "", "    ")
+	return string(bs)
+}
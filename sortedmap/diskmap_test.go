@@ -0,0 +1,242 @@
+package sortedmap_test
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wecisecode/util/sortedmap"
+)
+
+func checkDiskMap(t *testing.T, m *sortedmap.DiskMap, expect map[int]string) {
+	keys := []int{}
+	for k := range expect {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	assert.Equal(t, len(keys), m.Len())
+	i := 0
+	m.Fetch(func(key, value interface{}) bool {
+		assert.Equal(t, int64(keys[i]), key)
+		assert.Equal(t, expect[keys[i]], value)
+		i++
+		return true
+	})
+	assert.Equal(t, len(keys), i)
+	for _, k := range keys[:len(keys)/10] {
+		v, ok := m.Get(k)
+		assert.True(t, ok)
+		assert.Equal(t, expect[k], v)
+	}
+	assert.NoError(t, m.Err())
+}
+
+func TestDiskMap(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "map.db")
+	// 小的页及节点，覆盖多页节点、多层树及缓存淘汰
+	opt := &sortedmap.DiskMapOption{PageSize: 128, MaxKeys: 6, CacheSize: 8, NoSync: true}
+	m, err := sortedmap.OpenDiskMap(fn, opt)
+	assert.NoError(t, err)
+	expect := map[int]string{}
+	for round := 0; round < 10; round++ {
+		for i := 0; i < 300; i++ {
+			k := rand.Intn(1000)
+			if rand.Intn(3) == 0 {
+				_, exist := expect[k]
+				assert.Equal(t, exist, m.Delete(k))
+				delete(expect, k)
+			} else {
+				v := strconv.Itoa(k) + "-" + strconv.Itoa(round)
+				if k%50 == 0 {
+					// 超过一页的值
+					for len(v) < 300 {
+						v += v
+					}
+				}
+				_, exist := expect[k]
+				assert.Equal(t, !exist, m.Put(k, v))
+				expect[k] = v
+			}
+		}
+		checkDiskMap(t, m, expect)
+		assert.NoError(t, m.Commit())
+		if round%3 == 0 {
+			assert.NoError(t, m.Close())
+			m, err = sortedmap.OpenDiskMap(fn, opt)
+			assert.NoError(t, err)
+			checkDiskMap(t, m, expect)
+		}
+	}
+
+	// 范围查询
+	keys := []interface{}{}
+	m.FetchRange(100, 200, func(key, value interface{}) bool {
+		keys = append(keys, key)
+		return true
+	}, true)
+	expectKeys := []interface{}{}
+	for k := 200; k >= 100; k-- {
+		if _, ok := expect[k]; ok {
+			expectKeys = append(expectKeys, int64(k))
+		}
+	}
+	assert.Equal(t, expectKeys, keys)
+
+	// 回滚
+	m.Put(-1, "x")
+	m.Clear()
+	assert.Equal(t, 0, m.Len())
+	m.Rollback()
+	checkDiskMap(t, m, expect)
+
+	// 删除所有数据
+	for k := range expect {
+		assert.True(t, m.Delete(k))
+	}
+	assert.Equal(t, 0, m.Len())
+	assert.Nil(t, m.FirstItem())
+	assert.NoError(t, m.Close())
+	m, err = sortedmap.OpenDiskMap(fn, opt)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, m.Len())
+	assert.NoError(t, m.Close())
+}
+
+func TestDiskMapRecover(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "map.db")
+	opt := &sortedmap.DiskMapOption{PageSize: 256, MaxKeys: 8}
+	m, err := sortedmap.OpenDiskMap(fn, opt)
+	assert.NoError(t, err)
+	v1 := map[int]string{}
+	for i := 0; i < 100; i++ {
+		m.Put(i, "v1")
+		v1[i] = "v1"
+	}
+	assert.NoError(t, m.Commit())
+	for i := 0; i < 100; i += 2 {
+		m.Put(i, "v2")
+		m.Delete(i + 1)
+	}
+	assert.NoError(t, m.Commit())
+	// 未提交的修改
+	m.Put(1000, "v3")
+	assert.NoError(t, m.Err())
+	m.Rollback()
+	assert.NoError(t, m.Close())
+
+	// 模拟最后一次提交写入 meta 页时崩溃，第 2 次提交写入第 0 页
+	f, err := os.OpenFile(fn, os.O_RDWR, 0)
+	assert.NoError(t, err)
+	_, err = f.WriteAt([]byte("broken"), 0)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	m2, err := sortedmap.OpenDiskMap(fn, opt)
+	assert.NoError(t, err)
+	checkDiskMap(t, m2, v1)
+	assert.NoError(t, m2.Close())
+}
+
+func TestDiskMapReuse(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "map.db")
+	m, err := sortedmap.OpenDiskMap(fn, &sortedmap.DiskMapOption{NoSync: true})
+	assert.NoError(t, err)
+	size := func() int64 {
+		fi, err := os.Stat(fn)
+		assert.NoError(t, err)
+		return fi.Size()
+	}
+	var size10 int64
+	for round := 0; round < 50; round++ {
+		for i := 0; i < 1000; i++ {
+			m.Put(i, round)
+		}
+		assert.NoError(t, m.Commit())
+		if round == 10 {
+			size10 = size()
+		}
+	}
+	// 释放的页被重新使用，文件不会持续增长
+	assert.LessOrEqual(t, size(), size10*2)
+	assert.EqualValues(t, 49, m.GetValue(999))
+	assert.NoError(t, m.Close())
+}
+
+// 每次提交只修改一个 key，空闲页列表不会不断追加到文件末尾
+func TestDiskMapSinglePutCommit(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "map.db")
+	opt := &sortedmap.DiskMapOption{PageSize: 256, MaxKeys: 8, NoSync: true}
+	m, err := sortedmap.OpenDiskMap(fn, opt)
+	assert.NoError(t, err)
+	size := func() int64 {
+		fi, err := os.Stat(fn)
+		assert.NoError(t, err)
+		return fi.Size()
+	}
+	expect := map[int]string{}
+	for i := 0; i < 1000; i++ {
+		m.Put(i, strconv.Itoa(i))
+		expect[i] = strconv.Itoa(i)
+		assert.NoError(t, m.Commit())
+	}
+	loaded := size()
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 3000; i++ {
+		k := r.Intn(1000)
+		// 值长度变化使节点占用的页数变化
+		expect[k] = strings.Repeat("x", r.Intn(100))
+		m.Put(k, expect[k])
+		assert.NoError(t, m.Commit())
+	}
+	assert.LessOrEqual(t, size(), loaded*3/2)
+	checkDiskMap(t, m, expect)
+
+	// 删除全部数据后文件末尾的空闲页被截断
+	m.Clear()
+	assert.NoError(t, m.Commit())
+	m.Put(1, "a")
+	assert.NoError(t, m.Close())
+	assert.Less(t, size(), loaded/10)
+
+	m, err = sortedmap.OpenDiskMap(fn, opt)
+	assert.NoError(t, err)
+	checkDiskMap(t, m, map[int]string{1: "a"})
+	assert.NoError(t, m.Close())
+}
+
+func TestDiskMapLock(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "map.db")
+	m, err := sortedmap.OpenDiskMap(fn, nil)
+	assert.NoError(t, err)
+	_, err = sortedmap.OpenDiskMap(fn, nil)
+	assert.Error(t, err)
+	assert.NoError(t, m.Close())
+	m, err = sortedmap.OpenDiskMap(fn, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, m.Close())
+}
+
+func TestDiskMapKeys(t *testing.T) {
+	m, err := sortedmap.OpenDiskMap(filepath.Join(t.TempDir(), "map.db"), nil)
+	assert.NoError(t, err)
+	now := time.Now()
+	m.Put(int8(2), "int8")
+	m.Put(uint64(1), "uint64")
+	m.Put(1.5, "float")
+	m.Put("a", "string")
+	m.Put(now, "time")
+	assert.Equal(t, []interface{}{int64(1), 1.5, int64(2), "a"}, m.Keys()[:4])
+	assert.Equal(t, "int8", m.GetValue(2))
+	assert.Equal(t, "time", m.GetValue(&now))
+	_, err = m.Set(struct{}{}, 1)
+	assert.Error(t, err)
+	assert.False(t, m.Put([]int{1}, 1))
+	assert.Error(t, m.Err())
+	assert.NoError(t, m.Close())
+}
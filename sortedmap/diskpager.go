@@ -0,0 +1,496 @@
+package sortedmap
+
+import (
+	"container/list"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/wecisecode/util/merrs"
+	"github.com/wecisecode/util/msgpack"
+)
+
+// 文件格式
+// 第 0 1 页为交替写入的 meta 页，提交时写入 txid 较小的一页，打开时使用校验通过且 txid 较大的一页
+// 其它页保存节点及空闲页列表，每个节点占用一个或多个连续的页，页头为 crc32 数据长度 页数
+// 已提交的页不会被修改，修改的节点在提交时写入新的页，写入完成并同步后再写入 meta 页
+// 空闲页列表与节点一样写入已提交的空闲页，文件末尾的空闲页在提交后截断
+const (
+	diskMagic      = "SMBT"
+	diskVersion    = 1
+	diskMetaSize   = 60
+	diskPageHeader = 12
+	// 未提交节点的临时编号
+	diskTempID = uint64(1) << 63
+)
+
+type diskMeta struct {
+	pageSize  uint32
+	txid      uint64
+	root      uint64
+	pageCount uint64 // 文件中已分配的页数
+	freelist  uint64 // 空闲页列表所在的页，0 表示没有
+	count     uint64 // key 数
+}
+
+func (meta *diskMeta) encode() []byte {
+	bs := make([]byte, diskMetaSize)
+	copy(bs, diskMagic)
+	binary.LittleEndian.PutUint32(bs[4:], diskVersion)
+	binary.LittleEndian.PutUint32(bs[8:], meta.pageSize)
+	binary.LittleEndian.PutUint64(bs[12:], meta.txid)
+	binary.LittleEndian.PutUint64(bs[20:], meta.root)
+	binary.LittleEndian.PutUint64(bs[28:], meta.pageCount)
+	binary.LittleEndian.PutUint64(bs[36:], meta.freelist)
+	binary.LittleEndian.PutUint64(bs[44:], meta.count)
+	binary.LittleEndian.PutUint32(bs[56:], crc32.ChecksumIEEE(bs[:56]))
+	return bs
+}
+
+func decodeDiskMeta(bs []byte) *diskMeta {
+	if len(bs) < diskMetaSize || string(bs[:4]) != diskMagic ||
+		binary.LittleEndian.Uint32(bs[4:]) != diskVersion ||
+		binary.LittleEndian.Uint32(bs[56:]) != crc32.ChecksumIEEE(bs[:56]) {
+		return nil
+	}
+	return &diskMeta{
+		pageSize:  binary.LittleEndian.Uint32(bs[8:]),
+		txid:      binary.LittleEndian.Uint64(bs[12:]),
+		root:      binary.LittleEndian.Uint64(bs[20:]),
+		pageCount: binary.LittleEndian.Uint64(bs[28:]),
+		freelist:  binary.LittleEndian.Uint64(bs[36:]),
+		count:     binary.LittleEndian.Uint64(bs[44:]),
+	}
+}
+
+// B+树节点，内部节点 children[i] 子树中的 key 小于 keys[i]，children[i+1] 子树中的 key 大于等于 keys[i]
+type diskNode struct {
+	id       uint64
+	pages    int // 已提交节点占用的页数
+	leaf     bool
+	keys     []interface{}
+	values   [][]byte // msgpack 编码的值
+	children []uint64
+}
+
+type diskNodeData struct {
+	Leaf     bool          `msgpack:"l"`
+	Keys     []interface{} `msgpack:"k"`
+	Values   [][]byte      `msgpack:"v,omitempty"`
+	Children []uint64      `msgpack:"c,omitempty"`
+}
+
+// diskPager 使用的文件操作
+type diskFile interface {
+	io.ReaderAt
+	io.WriterAt
+	Name() string
+	Stat() (os.FileInfo, error)
+	Sync() error
+	Truncate(size int64) error
+	Close() error
+}
+
+type diskPager struct {
+	file     diskFile
+	pageSize int
+	noSync   bool
+	meta     diskMeta // 最后提交的 meta
+	// 空闲页列表占用的页数
+	freelistPages int
+	// 当前事务状态
+	root      uint64
+	count     uint64
+	pageCount uint64
+	free      []uint64             // 可以分配的页，从小到大排序
+	pending   []uint64             // 本次事务释放的页，提交后才能重新分配
+	dirty     map[uint64]*diskNode // 未提交的节点，以临时编号索引
+	tempSeq   uint64
+	changed   bool
+	committed []uint64 // 最后提交时的空闲页列表，用于回滚
+	// 已提交节点缓存
+	cacheSize int
+	cache     map[uint64]*list.Element
+	lru       *list.List
+}
+
+func openDiskPager(path string, opt *DiskMapOption) (*diskPager, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, merrs.NewError(err)
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	p := &diskPager{
+		file:      f,
+		pageSize:  opt.PageSize,
+		noSync:    opt.NoSync,
+		dirty:     map[uint64]*diskNode{},
+		cacheSize: opt.CacheSize,
+		cache:     map[uint64]*list.Element{},
+		lru:       list.New(),
+	}
+	if err := p.load(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *diskPager) load() error {
+	fi, err := p.file.Stat()
+	if err != nil {
+		return merrs.NewError(err)
+	}
+	if fi.Size() == 0 {
+		// 新文件，两个 meta 页写入相同的内容
+		p.meta = diskMeta{pageSize: uint32(p.pageSize), pageCount: 2}
+		bs := p.meta.encode()
+		for i := int64(0); i < 2; i++ {
+			if _, err := p.file.WriteAt(bs, i*int64(p.pageSize)); err != nil {
+				return merrs.NewError(err)
+			}
+		}
+		if err := p.sync(); err != nil {
+			return err
+		}
+	} else {
+		// 第 1 页的位置由页大小确定，第 0 页损坏时使用参数指定的页大小
+		meta := p.readMeta(0)
+		off := int64(p.pageSize)
+		if meta != nil {
+			off = int64(meta.pageSize)
+		}
+		if m := p.readMeta(off); m != nil && (meta == nil || m.txid > meta.txid && m.pageSize == meta.pageSize) {
+			meta = m
+		}
+		if meta == nil {
+			return merrs.NewError("sortedmap disk file %s meta page is corrupted", p.file.Name())
+		}
+		p.meta = *meta
+		p.pageSize = int(meta.pageSize)
+	}
+	p.rollback()
+	if p.meta.freelist != 0 {
+		bs, pages, err := p.readPage(p.meta.freelist)
+		if err != nil {
+			return err
+		}
+		p.freelistPages = pages
+		if err := msgpack.Decode(bs, &p.free); err != nil {
+			return err
+		}
+		sort.Slice(p.free, func(i, j int) bool { return p.free[i] < p.free[j] })
+	}
+	p.committed = append([]uint64{}, p.free...)
+	return nil
+}
+
+func (p *diskPager) readMeta(off int64) *diskMeta {
+	bs := make([]byte, diskMetaSize)
+	if _, err := p.file.ReadAt(bs, off); err != nil {
+		return nil
+	}
+	return decodeDiskMeta(bs)
+}
+
+// 恢复到最后提交的状态
+func (p *diskPager) rollback() {
+	p.root = p.meta.root
+	p.count = p.meta.count
+	p.pageCount = p.meta.pageCount
+	p.free = append([]uint64{}, p.committed...)
+	p.pending = nil
+	p.dirty = map[uint64]*diskNode{}
+	p.changed = false
+}
+
+func (p *diskPager) sync() error {
+	if p.noSync {
+		return nil
+	}
+	if err := p.file.Sync(); err != nil {
+		return merrs.NewError(err)
+	}
+	return nil
+}
+
+// 读取页数据，返回数据及占用的页数
+func (p *diskPager) readPage(id uint64) ([]byte, int, error) {
+	off := int64(id) * int64(p.pageSize)
+	buf := make([]byte, p.pageSize)
+	if _, err := p.file.ReadAt(buf, off); err != nil && err != io.EOF {
+		return nil, 0, merrs.NewError(err)
+	}
+	size := int(binary.LittleEndian.Uint32(buf[4:]))
+	pages := int(binary.LittleEndian.Uint32(buf[8:]))
+	if pages <= 0 || diskPageHeader+size > pages*p.pageSize {
+		return nil, 0, merrs.NewError("sortedmap disk file %s page %d is corrupted", p.file.Name(), id)
+	}
+	if pages > 1 {
+		buf = append(buf, make([]byte, (pages-1)*p.pageSize)...)
+		if _, err := p.file.ReadAt(buf[p.pageSize:], off+int64(p.pageSize)); err != nil && err != io.EOF {
+			return nil, 0, merrs.NewError(err)
+		}
+	}
+	data := buf[diskPageHeader : diskPageHeader+size]
+	if binary.LittleEndian.Uint32(buf) != crc32.ChecksumIEEE(buf[4:diskPageHeader+size]) {
+		return nil, 0, merrs.NewError("sortedmap disk file %s page %d checksum mismatch", p.file.Name(), id)
+	}
+	return data, pages, nil
+}
+
+// 分配页并写入数据，返回页编号及占用的页数
+func (p *diskPager) writePage(data []byte) (uint64, int, error) {
+	pages := (diskPageHeader + len(data) + p.pageSize - 1) / p.pageSize
+	id := p.alloc(pages)
+	if err := p.writePageAt(id, pages, data); err != nil {
+		return 0, 0, err
+	}
+	return id, pages, nil
+}
+
+// 将数据写入从 id 开始的 pages 个页，数据可以小于分配的页
+func (p *diskPager) writePageAt(id uint64, pages int, data []byte) error {
+	buf := make([]byte, pages*p.pageSize)
+	binary.LittleEndian.PutUint32(buf[4:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(buf[8:], uint32(pages))
+	copy(buf[diskPageHeader:], data)
+	binary.LittleEndian.PutUint32(buf, crc32.ChecksumIEEE(buf[4:diskPageHeader+len(data)]))
+	if _, err := p.file.WriteAt(buf, int64(id)*int64(p.pageSize)); err != nil {
+		return merrs.NewError(err)
+	}
+	return nil
+}
+
+// 从空闲页中分配编号最小的连续 pages 个页，没有时从文件末尾分配
+func (p *diskPager) alloc(pages int) uint64 {
+	for i := 0; i+pages <= len(p.free); i++ {
+		id := p.free[i]
+		if p.free[i+pages-1] != id+uint64(pages-1) {
+			continue
+		}
+		if i == 0 {
+			p.free = p.free[pages:]
+		} else {
+			p.free = append(p.free[:i], p.free[i+pages:]...)
+		}
+		return id
+	}
+	id := p.pageCount
+	p.pageCount += uint64(pages)
+	return id
+}
+
+func (p *diskPager) node(id uint64) (*diskNode, error) {
+	if id&diskTempID != 0 {
+		return p.dirty[id], nil
+	}
+	if e, ok := p.cache[id]; ok {
+		p.lru.MoveToFront(e)
+		return e.Value.(*diskNode), nil
+	}
+	bs, pages, err := p.readPage(id)
+	if err != nil {
+		return nil, err
+	}
+	data := &diskNodeData{}
+	if err := msgpack.Decode(bs, data); err != nil {
+		return nil, err
+	}
+	n := &diskNode{id: id, pages: pages, leaf: data.Leaf, keys: data.Keys, values: data.Values, children: data.Children}
+	for i, k := range n.keys {
+		if n.keys[i], err = normalizeDiskKey(k); err != nil {
+			return nil, err
+		}
+	}
+	p.cacheNode(n)
+	return n, nil
+}
+
+func (p *diskPager) cacheNode(n *diskNode) {
+	p.cache[n.id] = p.lru.PushFront(n)
+	for p.lru.Len() > p.cacheSize {
+		e := p.lru.Back()
+		p.lru.Remove(e)
+		delete(p.cache, e.Value.(*diskNode).id)
+	}
+}
+
+func (p *diskPager) newNode(leaf bool) *diskNode {
+	p.tempSeq++
+	n := &diskNode{id: diskTempID | p.tempSeq, leaf: leaf}
+	p.dirty[n.id] = n
+	p.changed = true
+	return n
+}
+
+// 返回可修改的节点，已提交的节点复制为新节点，原节点占用的页在提交后释放
+func (p *diskPager) mutable(n *diskNode) *diskNode {
+	if n.id&diskTempID != 0 {
+		return n
+	}
+	w := p.newNode(n.leaf)
+	w.keys = append([]interface{}{}, n.keys...)
+	w.values = append([][]byte{}, n.values...)
+	w.children = append([]uint64{}, n.children...)
+	p.freeNode(n)
+	return w
+}
+
+func (p *diskPager) freeNode(n *diskNode) {
+	p.changed = true
+	if n.id&diskTempID != 0 {
+		delete(p.dirty, n.id)
+		return
+	}
+	if e, ok := p.cache[n.id]; ok {
+		p.lru.Remove(e)
+		delete(p.cache, n.id)
+	}
+	for i := 0; i < n.pages; i++ {
+		p.pending = append(p.pending, n.id+uint64(i))
+	}
+}
+
+// 释放所有已提交的节点
+func (p *diskPager) freeAll() {
+	inuse := map[uint64]bool{}
+	for _, id := range p.free {
+		inuse[id] = true
+	}
+	for i := 0; i < p.freelistPages; i++ {
+		inuse[p.meta.freelist+uint64(i)] = true
+	}
+	p.pending = p.pending[:0]
+	for id := uint64(2); id < p.pageCount; id++ {
+		if !inuse[id] {
+			p.pending = append(p.pending, id)
+		}
+	}
+	p.dirty = map[uint64]*diskNode{}
+	p.cache = map[uint64]*list.Element{}
+	p.lru.Init()
+	p.root = 0
+	p.count = 0
+	p.changed = true
+}
+
+// 写入未提交节点，返回节点的页编号，未提交的节点不修改，写入的节点加入 written，提交成功后再加入缓存
+func (p *diskPager) flush(id uint64, written *[]*diskNode) (uint64, error) {
+	if id&diskTempID == 0 {
+		return id, nil
+	}
+	n := p.dirty[id]
+	w := &diskNode{leaf: n.leaf, keys: n.keys, values: n.values}
+	if len(n.children) > 0 {
+		w.children = make([]uint64, len(n.children))
+	}
+	for i, c := range n.children {
+		cid, err := p.flush(c, written)
+		if err != nil {
+			return 0, err
+		}
+		w.children[i] = cid
+	}
+	bs, err := msgpack.Encode(&diskNodeData{Leaf: w.leaf, Keys: w.keys, Values: w.values, Children: w.children})
+	if err != nil {
+		return 0, err
+	}
+	if w.id, w.pages, err = p.writePage(bs); err != nil {
+		return 0, err
+	}
+	*written = append(*written, w)
+	return w.id, nil
+}
+
+// 提交出错时恢复到提交前的状态，未提交的修改仍然保留，可以再次提交或回滚
+func (p *diskPager) commit() error {
+	if !p.changed {
+		return nil
+	}
+	oldFree, oldPageCount := append([]uint64{}, p.free...), p.pageCount
+	committed := false
+	defer func() {
+		if !committed {
+			p.free, p.pageCount = oldFree, oldPageCount
+		}
+	}()
+	var written []*diskNode
+	root, err := p.flush(p.root, &written)
+	if err != nil {
+		return err
+	}
+	meta := diskMeta{pageSize: uint32(p.pageSize), txid: p.meta.txid + 1, root: root, count: p.count}
+	// 本次释放的页及原空闲页列表占用的页仍被最后提交的数据引用，在下次事务中才能重新分配
+	reclaim := append([]uint64{}, p.pending...)
+	for i := 0; i < p.freelistPages; i++ {
+		reclaim = append(reclaim, p.meta.freelist+uint64(i))
+	}
+	// 空闲页列表写入已提交的空闲页，按编码后的最大长度分配，分配后列表只会变短
+	freelistPages := 0
+	if n := len(p.free) + len(reclaim); n > 0 {
+		freelistPages = (diskPageHeader + 5 + 9*n + p.pageSize - 1) / p.pageSize
+		meta.freelist = p.alloc(freelistPages)
+	}
+	free := append(append([]uint64{}, p.free...), reclaim...)
+	sort.Slice(free, func(i, j int) bool { return free[i] < free[j] })
+	// 文件末尾的连续空闲页直接归还
+	for len(free) > 0 && free[len(free)-1] == p.pageCount-1 {
+		free = free[:len(free)-1]
+		p.pageCount--
+	}
+	if freelistPages > 0 {
+		bs, err := msgpack.Encode(free)
+		if err != nil {
+			return err
+		}
+		if err := p.writePageAt(meta.freelist, freelistPages, bs); err != nil {
+			return err
+		}
+	}
+	meta.pageCount = p.pageCount
+	if err := p.sync(); err != nil {
+		return err
+	}
+	if _, err := p.file.WriteAt(meta.encode(), int64(meta.txid%2)*int64(p.pageSize)); err != nil {
+		return merrs.NewError(err)
+	}
+	if err := p.sync(); err != nil {
+		return err
+	}
+	committed = true
+	p.meta = meta
+	p.freelistPages = freelistPages
+	p.committed = free
+	p.rollback()
+	for _, n := range written {
+		p.cacheNode(n)
+	}
+	// meta 写入后末尾的页不再被引用，截断失败不影响已提交的数据
+	if size := int64(meta.pageCount) * int64(p.pageSize); size < p.fileSize() {
+		if e := p.file.Truncate(size); e != nil {
+			return merrs.NewError(e)
+		}
+	}
+	return nil
+}
+
+func (p *diskPager) fileSize() int64 {
+	fi, err := p.file.Stat()
+	if err != nil {
+		return 0
+	}
+	return fi.Size()
+}
+
+func (p *diskPager) close() error {
+	if err := p.file.Close(); err != nil {
+		return merrs.NewError(err)
+	}
+	return nil
+}
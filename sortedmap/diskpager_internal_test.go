@@ -0,0 +1,84 @@
+package sortedmap
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 第 failAt 次写入或同步时返回错误，failAt 为 0 时不出错
+type faultFile struct {
+	diskFile
+	ops    int
+	failAt int
+}
+
+func (f *faultFile) fault() error {
+	f.ops++
+	if f.failAt > 0 && f.ops >= f.failAt {
+		return errors.New("injected fault")
+	}
+	return nil
+}
+
+func (f *faultFile) WriteAt(b []byte, off int64) (int, error) {
+	if err := f.fault(); err != nil {
+		return 0, err
+	}
+	return f.diskFile.WriteAt(b, off)
+}
+
+func (f *faultFile) Sync() error {
+	if err := f.fault(); err != nil {
+		return err
+	}
+	return f.diskFile.Sync()
+}
+
+func TestDiskMapCommitFault(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "map.db")
+	m, err := OpenDiskMap(fn, &DiskMapOption{PageSize: 256, MaxKeys: 4})
+	assert.NoError(t, err)
+	ff := &faultFile{diskFile: m.pager.file}
+	m.pager.file = ff
+	expect := map[int]string{}
+	for i := 0; i < 50; i++ {
+		m.Put(i, strconv.Itoa(i))
+		expect[i] = strconv.Itoa(i)
+	}
+	assert.NoError(t, m.Commit())
+
+	check := func() {
+		assert.Equal(t, len(expect), m.Len())
+		for k, v := range expect {
+			assert.Equal(t, v, m.GetValue(k), k)
+		}
+		assert.NoError(t, m.Err())
+	}
+	for i := 50; i < 100; i++ {
+		m.Put(i, strconv.Itoa(i))
+		expect[i] = strconv.Itoa(i)
+	}
+	m.Delete(3)
+	delete(expect, 3)
+	// 依次在提交的每一步出错，出错后数据保持提交前的状态
+	for failAt := 1; ; failAt++ {
+		ff.ops, ff.failAt = 0, failAt
+		err := m.Commit()
+		ff.failAt = 0
+		if err == nil {
+			break
+		}
+		check()
+	}
+	check()
+	assert.NoError(t, m.Close())
+
+	m, err = OpenDiskMap(fn, &DiskMapOption{PageSize: 256, MaxKeys: 4})
+	assert.NoError(t, err)
+	check()
+	assert.NoError(t, m.Close())
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package sortedmap
+
+import "os"
+
+// 不支持 flock 的平台不加锁
+func lockFile(f *os.File) error {
+	return nil
+}
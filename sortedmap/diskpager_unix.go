@@ -0,0 +1,22 @@
+//go:build unix
+
+package sortedmap
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/wecisecode/util/merrs"
+)
+
+// 对文件加排他锁，已被其它进程或 DiskMap 锁定时返回错误，关闭文件时释放
+func lockFile(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return merrs.NewError("sortedmap disk file %s is locked by another DiskMap", f.Name())
+	}
+	if err != nil {
+		return merrs.NewError(err)
+	}
+	return nil
+}
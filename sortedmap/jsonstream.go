@@ -0,0 +1,131 @@
+package sortedmap
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/wecisecode/util/merrs"
+)
+
+// 从 io.Reader 流式解码 json，对象解码为 *LinkedMap 保持 key 的顺序，数组解码为 []interface{}
+// 整数解码为 int64，超出范围的整数及小数解码为 float64，与 UnmarshalJSON 一致
+// 可以连续解码多个值，如按行分隔的 json
+type JSONDecoder struct {
+	dec *json.Decoder
+}
+
+func NewJSONDecoder(r io.Reader) *JSONDecoder {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	return &JSONDecoder{dec: dec}
+}
+
+// 从 r 中解码一个 json 对象到 sm
+func DecodeJSON(sm SortedMap, r io.Reader) error {
+	return NewJSONDecoder(r).DecodeMap(sm)
+}
+
+// 是否还有下一个值
+func (d *JSONDecoder) More() bool {
+	return d.dec.More()
+}
+
+// 解码下一个值，没有更多的值时返回 io.EOF
+func (d *JSONDecoder) Decode() (interface{}, error) {
+	tok, err := d.dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	return d.value(tok)
+}
+
+// 解码下一个 json 对象到 sm
+func (d *JSONDecoder) DecodeMap(sm SortedMap) error {
+	if err := d.expect('{'); err != nil {
+		return err
+	}
+	return d.object(sm)
+}
+
+// 解码下一个 json 数组，每个元素解码后调用 p，不保存整个数组，适合处理大数组
+// p 返回错误时停止解码并返回该错误，之后不能继续使用该解码器
+func (d *JSONDecoder) DecodeArray(p func(i int, value interface{}) error) error {
+	if err := d.expect('['); err != nil {
+		return err
+	}
+	return d.array(p)
+}
+
+func (d *JSONDecoder) expect(delim json.Delim) error {
+	tok, err := d.dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != delim {
+		return merrs.NewError("json value is %v, expect %v", tok, delim)
+	}
+	return nil
+}
+
+func (d *JSONDecoder) value(tok json.Token) (interface{}, error) {
+	switch t := tok.(type) {
+	case json.Delim:
+		if t == '{' {
+			sm := NewLinkedMap()
+			return sm, d.object(sm)
+		}
+		// json.Decoder 保证此处只会是 '['
+		vs := []interface{}{}
+		err := d.array(func(i int, value interface{}) error {
+			vs = append(vs, value)
+			return nil
+		})
+		return vs, err
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i, nil
+		}
+		f, err := t.Float64()
+		if err != nil {
+			return nil, merrs.NewError(err)
+		}
+		return f, nil
+	}
+	// string bool nil
+	return tok, nil
+}
+
+func (d *JSONDecoder) object(sm SortedMap) error {
+	for d.dec.More() {
+		tok, err := d.dec.Token()
+		if err != nil {
+			return err
+		}
+		// json.Decoder 保证对象的 key 为字符串
+		key := tok.(string)
+		if tok, err = d.dec.Token(); err != nil {
+			return err
+		}
+		value, err := d.value(tok)
+		if err != nil {
+			return err
+		}
+		sm.Put(key, value)
+	}
+	_, err := d.dec.Token()
+	return err
+}
+
+func (d *JSONDecoder) array(p func(i int, value interface{}) error) error {
+	for i := 0; d.dec.More(); i++ {
+		value, err := d.Decode()
+		if err != nil {
+			return err
+		}
+		if err := p(i, value); err != nil {
+			return err
+		}
+	}
+	_, err := d.dec.Token()
+	return err
+}
@@ -0,0 +1,41 @@
+package sortedmap_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wecisecode/util/sortedmap"
+)
+
+func TestJSONDecoder(t *testing.T) {
+	d := sortedmap.NewJSONDecoder(strings.NewReader(`{"b":1,"a":[1.5,"x",null,{"c":false}]}
+[1,2,3]
+"s"`))
+	v, err := d.Decode()
+	assert.Nil(t, err)
+	sm := v.(*sortedmap.LinkedMap)
+	assert.Equal(t, []interface{}{"b", "a"}, sm.Keys())
+	assert.Equal(t, int64(1), sm.GetValue("b"))
+	a := sm.GetValue("a").([]interface{})
+	assert.Equal(t, []interface{}{1.5, "x", nil}, a[:3])
+	assert.Equal(t, []interface{}{"c"}, a[3].(*sortedmap.LinkedMap).Keys())
+
+	// 逐个元素解码数组
+	sum := int64(0)
+	assert.Nil(t, d.DecodeArray(func(i int, value interface{}) error {
+		sum += value.(int64)
+		return nil
+	}))
+	assert.Equal(t, int64(6), sum)
+	assert.True(t, d.More())
+	assert.NotNil(t, d.DecodeMap(sortedmap.NewLinkedMap()))
+	_, err = d.Decode()
+	assert.Equal(t, io.EOF, err)
+
+	tm := sortedmap.NewTreeMap()
+	assert.Nil(t, sortedmap.DecodeJSON(tm, strings.NewReader(`{"z":1,"y":{"x":2}}`)))
+	assert.Equal(t, []interface{}{"y", "z"}, tm.Keys())
+	assert.NotNil(t, sortedmap.DecodeJSON(tm, strings.NewReader(`{"z":`)))
+}
@@ -33,19 +33,37 @@ func (e *Element) Prev() *Element {
 	return newElement(e.element.Prev())
 }
 
+type LinkedMapOption struct {
+	// 按访问顺序排列，Get GetValue 及更新已有 key 时移到末尾，默认按插入顺序排列
+	AccessOrder bool
+	// 最大 key 数，超过时从头部删除最旧的项，0 表示不限制
+	Capacity int
+	// 超过容量删除时调用，调用时不持有锁
+	OnEvict func(key, value interface{})
+}
+
+// 保持插入顺序的 map，设置 AccessOrder 及 Capacity 时可以用作 LRU 缓存
 type LinkedMap struct {
 	sync.RWMutex
 	mapping
 	entries *list.List
+	option  LinkedMapOption
 }
 
 var _ SortedMap = &LinkedMap{}
 
 func NewLinkedMap() *LinkedMap {
+	return NewLinkedMapWithOption(nil)
+}
+
+func NewLinkedMapWithOption(opt *LinkedMapOption) *LinkedMap {
 	sm := &LinkedMap{
 		mapping: map[interface{}]*list.Element{},
 		entries: list.New(),
 	}
+	if opt != nil {
+		sm.option = *opt
+	}
 	return sm
 }
 
@@ -58,26 +76,26 @@ func (m *LinkedMap) PutAll(amap interface{}) SortedMap {
 	return m
 }
 
+// 复制的 map 使用相同的选项
 func (m *LinkedMap) Copy() SortedMap {
-	sm := NewLinkedMap()
+	sm := NewLinkedMapWithOption(&m.option)
 	Merge(sm, m)
 	return sm
 }
 
 func (m *LinkedMap) DeepCopy() SortedMap {
-	sm := NewLinkedMap()
+	sm := NewLinkedMapWithOption(&m.option)
 	DeepMerge(sm, m, true)
 	return sm
 }
 
 // Get returns the value for a key. If the key does not exist, the second return
 // parameter will be false and the value will be nil or defaultValue.
+// In access order mode the key is moved to the back.
 func (m *LinkedMap) Get(key interface{}, defaultValue ...interface{}) (interface{}, bool) {
-	m.RLock()
-	defer m.RUnlock()
-	value, ok := m.mapping[key]
+	value, ok := m.lookup(key)
 	if ok {
-		return value.Value.(*MapItem).Value, true
+		return value, true
 	}
 	if len(defaultValue) > 0 {
 		return defaultValue[0], false
@@ -86,34 +104,109 @@ func (m *LinkedMap) Get(key interface{}, defaultValue ...interface{}) (interface
 }
 
 func (m *LinkedMap) GetValue(key interface{}, defaultValue ...interface{}) interface{} {
+	value, _ := m.Get(key, defaultValue...)
+	return value
+}
+
+func (m *LinkedMap) lookup(key interface{}) (interface{}, bool) {
+	if m.option.AccessOrder {
+		m.Lock()
+		defer m.Unlock()
+		element, ok := m.mapping[key]
+		if !ok {
+			return nil, false
+		}
+		m.entries.MoveToBack(element)
+		return element.Value.(*MapItem).Value, true
+	}
 	m.RLock()
 	defer m.RUnlock()
-	value, ok := m.mapping[key]
-	if ok {
-		return value.Value.(*MapItem).Value
-	}
-	if len(defaultValue) > 0 {
-		return defaultValue[0]
+	element, ok := m.mapping[key]
+	if !ok {
+		return nil, false
 	}
-	return nil
+	return element.Value.(*MapItem).Value, true
 }
 
 // Put will set (or replace) a value for a key. If the key was new, then true
 // will be returned. The returned value will be false if the value was replaced
 // (even if the value was the same).
+// In access order mode a replaced key is moved to the back.
+// If the capacity is exceeded, the oldest elements are evicted.
 func (m *LinkedMap) Put(key, value interface{}) bool {
 	m.Lock()
-	defer m.Unlock()
-	_, didExist := m.mapping[key]
+	element, didExist := m.mapping[key]
 	if !didExist {
-		element := m.entries.PushBack(&MapItem{key, value})
-		m.mapping[key] = element
+		m.mapping[key] = m.entries.PushBack(&MapItem{key, value})
 	} else {
-		m.mapping[key].Value.(*MapItem).Value = value
+		element.Value.(*MapItem).Value = value
+		if m.option.AccessOrder {
+			m.entries.MoveToBack(element)
+		}
+	}
+	evicted := m.evict()
+	m.Unlock()
+	if m.option.OnEvict != nil {
+		for _, item := range evicted {
+			m.option.OnEvict(item.Key, item.Value)
+		}
 	}
 	return !didExist
 }
 
+// 删除超过容量的最旧的项
+func (m *LinkedMap) evict() (evicted []*MapItem) {
+	for m.option.Capacity > 0 && len(m.mapping) > m.option.Capacity {
+		item := m.removeElement(m.entries.Front())
+		if m.option.OnEvict != nil {
+			evicted = append(evicted, item)
+		}
+	}
+	return evicted
+}
+
+func (m *LinkedMap) removeElement(element *list.Element) *MapItem {
+	item := m.entries.Remove(element).(*MapItem)
+	delete(m.mapping, item.Key)
+	return item
+}
+
+// MoveToFront moves the element of a key to the front.
+// It will return false if the key does not exist.
+func (m *LinkedMap) MoveToFront(key interface{}) bool {
+	m.Lock()
+	defer m.Unlock()
+	element, ok := m.mapping[key]
+	if ok {
+		m.entries.MoveToFront(element)
+	}
+	return ok
+}
+
+// MoveToBack moves the element of a key to the back.
+// It will return false if the key does not exist.
+func (m *LinkedMap) MoveToBack(key interface{}) bool {
+	m.Lock()
+	defer m.Unlock()
+	element, ok := m.mapping[key]
+	if ok {
+		m.entries.MoveToBack(element)
+	}
+	return ok
+}
+
+// RemoveOldest removes and returns the first element, OnEvict is not called.
+// If there are no elements this will return nil.
+func (m *LinkedMap) RemoveOldest() *MapItem {
+	m.Lock()
+	defer m.Unlock()
+	front := m.entries.Front()
+	if front == nil {
+		return nil
+	}
+	return m.removeElement(front)
+}
+
 func (m *LinkedMap) Has(key interface{}) bool {
 	m.RLock()
 	defer m.RUnlock()
@@ -183,8 +276,7 @@ func (m *LinkedMap) Delete(key interface{}) (didDelete bool) {
 	defer m.Unlock()
 	element, ok := m.mapping[key]
 	if ok {
-		m.entries.Remove(element)
-		delete(m.mapping, key)
+		m.removeElement(element)
 	}
 	return ok
 }
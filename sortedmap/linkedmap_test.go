@@ -0,0 +1,66 @@
+package sortedmap_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wecisecode/util/sortedmap"
+)
+
+func TestLinkedMapAccessOrder(t *testing.T) {
+	evicted := []interface{}{}
+	m := sortedmap.NewLinkedMapWithOption(&sortedmap.LinkedMapOption{
+		AccessOrder: true,
+		Capacity:    3,
+		OnEvict: func(key, value interface{}) {
+			evicted = append(evicted, key)
+		},
+	})
+	m.Put("a", 1)
+	m.Put("b", 2)
+	m.Put("c", 3)
+	assert.Equal(t, 1, m.GetValue("a"))
+	assert.False(t, m.Put("b", 20))
+	assert.Equal(t, []interface{}{"c", "a", "b"}, m.Keys())
+	// Has 不改变顺序
+	assert.True(t, m.Has("c"))
+	m.Put("d", 4)
+	assert.Equal(t, []interface{}{"c"}, evicted)
+	assert.Equal(t, []interface{}{"a", "b", "d"}, m.Keys())
+
+	assert.True(t, m.MoveToFront("d"))
+	assert.True(t, m.MoveToBack("a"))
+	assert.False(t, m.MoveToBack("x"))
+	assert.Equal(t, []interface{}{"d", "b", "a"}, m.Keys())
+	assert.Equal(t, &sortedmap.MapItem{Key: "d", Value: 4}, m.RemoveOldest())
+	assert.Equal(t, 2, m.Len())
+	assert.Equal(t, []interface{}{"c"}, evicted)
+
+	// 按当前顺序编码，解码后顺序不变
+	bs, err := json.Marshal(m)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"b":20,"a":1}`, string(bs))
+	c := m.Copy().(*sortedmap.LinkedMap)
+	assert.Equal(t, m.Keys(), c.Keys())
+	c.Get("b")
+	assert.Equal(t, []interface{}{"a", "b"}, c.Keys())
+	n := sortedmap.NewLinkedMap()
+	assert.Nil(t, n.UnmarshalJSON(bs))
+	assert.Equal(t, m.Keys(), n.Keys())
+
+	m.RemoveOldest()
+	m.RemoveOldest()
+	assert.Nil(t, m.RemoveOldest())
+}
+
+func TestLinkedMapInsertOrder(t *testing.T) {
+	m := sortedmap.NewLinkedMap()
+	m.Put("b", 1)
+	m.Put("a", 2)
+	m.Get("b")
+	m.Put("b", 3)
+	assert.Equal(t, []interface{}{"b", "a"}, m.Keys())
+	assert.Equal(t, 3, m.GetValue("b"))
+	assert.Equal(t, "x", m.GetValue("c", "x"))
+}
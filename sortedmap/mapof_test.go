@@ -0,0 +1,132 @@
+package sortedmap_test
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wecisecode/util/sortedmap"
+)
+
+type mapOf[K any, V any] interface {
+	Put(key K, value V) bool
+	Delete(key K) bool
+	Get(key K, defaultValue ...V) (V, bool)
+	Has(key K) bool
+	Len() int
+	Keys() []K
+	Values() []V
+	FirstItem() *sortedmap.Entry[K, V]
+	LastItem() *sortedmap.Entry[K, V]
+	FetchReverse(p func(key K, value V) bool)
+	FetchRange(from, to *K, p func(key K, value V) bool, reverse bool)
+}
+
+func fetchRangeKeys[K any, V any](m mapOf[K, V], from, to *K, reverse bool) []K {
+	keys := []K{}
+	m.FetchRange(from, to, func(key K, value V) bool {
+		keys = append(keys, key)
+		return true
+	}, reverse)
+	return keys
+}
+
+func testMapOf(t *testing.T, m mapOf[int, string]) {
+	assert.Nil(t, m.FirstItem())
+	assert.Nil(t, m.LastItem())
+	expect := map[int]string{}
+	for i := 0; i < 1000; i++ {
+		k := rand.Intn(500)
+		_, exist := expect[k]
+		assert.Equal(t, !exist, m.Put(k, "v"+strings.Repeat("x", k%3)))
+		expect[k] = "v" + strings.Repeat("x", k%3)
+		if k%7 == 0 {
+			assert.True(t, m.Delete(k))
+			assert.False(t, m.Delete(k))
+			delete(expect, k)
+		}
+	}
+	keys := []int{}
+	for k := range expect {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	assert.Equal(t, len(keys), m.Len())
+	assert.Equal(t, keys, m.Keys())
+	assert.Equal(t, keys[0], m.FirstItem().Key)
+	assert.Equal(t, keys[len(keys)-1], m.LastItem().Key)
+	for _, k := range keys {
+		v, ok := m.Get(k)
+		assert.True(t, ok)
+		assert.Equal(t, expect[k], v)
+	}
+	v, ok := m.Get(7, "default")
+	assert.False(t, ok)
+	assert.Equal(t, "default", v)
+	assert.False(t, m.Has(-1))
+
+	from, to := 100, 200
+	inrange := []int{}
+	for _, k := range keys {
+		if k >= from && k <= to {
+			inrange = append(inrange, k)
+		}
+	}
+	reversed := func(ks []int) []int {
+		r := make([]int, len(ks))
+		for i, k := range ks {
+			r[len(ks)-1-i] = k
+		}
+		return r
+	}
+	assert.Equal(t, inrange, fetchRangeKeys(m, &from, &to, false))
+	assert.Equal(t, reversed(inrange), fetchRangeKeys(m, &from, &to, true))
+	assert.Equal(t, keys, fetchRangeKeys[int, string](m, nil, nil, false))
+	assert.Equal(t, reversed(keys), fetchRangeKeys[int, string](m, nil, nil, true))
+	rkeys := []int{}
+	m.FetchReverse(func(key int, value string) bool {
+		rkeys = append(rkeys, key)
+		return len(rkeys) < 3
+	})
+	assert.Equal(t, reversed(keys)[:3], rkeys)
+}
+
+func TestTreeMapOf(t *testing.T) {
+	testMapOf(t, sortedmap.NewTreeMapOf[int, string]())
+}
+
+func TestTreapMapOf(t *testing.T) {
+	testMapOf(t, sortedmap.NewTreapMapOf[int, string]())
+
+	// 自定义比较函数，降序
+	m := sortedmap.NewTreapMapFunc[string, int](func(a, b string) int { return strings.Compare(b, a) })
+	m.Put("a", 1)
+	m.Put("c", 3)
+	m.Put("b", 2)
+	assert.Equal(t, []string{"c", "b", "a"}, m.Keys())
+	// 遍历时修改
+	m.Fetch(func(key string, value int) bool {
+		m.Delete(key)
+		return true
+	})
+	assert.Equal(t, 0, m.Len())
+}
+
+func TestLegacyFetchRange(t *testing.T) {
+	for _, m := range []sortedmap.SortedMap{sortedmap.NewTreeMap(), sortedmap.NewTreapMap()} {
+		for _, k := range []int{5, 1, 3, 2, 4} {
+			m.Put(k, k*10)
+		}
+		keys := []interface{}{}
+		m.FetchRange(2, 4, func(key, value interface{}) bool {
+			keys = append(keys, key)
+			return true
+		}, true)
+		assert.Equal(t, []interface{}{4, 3, 2}, keys)
+		assert.Equal(t, []interface{}{1, 2, 3, 4, 5}, m.Keys())
+		assert.Equal(t, 1, m.FirstItem().Key)
+		assert.Equal(t, 50, m.LastItem().Value)
+	}
+}
@@ -0,0 +1,131 @@
+package sortedmap_test
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wecisecode/util/sortedmap"
+)
+
+type navigableMapOf[K any, V any] interface {
+	mapOf[K, V]
+	Floor(key K) *sortedmap.Entry[K, V]
+	Ceiling(key K) *sortedmap.Entry[K, V]
+	Lower(key K) *sortedmap.Entry[K, V]
+	Higher(key K) *sortedmap.Entry[K, V]
+	Rank(key K) int
+	Select(i int) *sortedmap.Entry[K, V]
+	PopFirst() *sortedmap.Entry[K, V]
+	PopLast() *sortedmap.Entry[K, V]
+	DeleteRange(from, to *K) int
+}
+
+// 有序 key 列表中的位置，key 不存在时为插入位置
+func searchKeys(keys []int, key int) (int, bool) {
+	i := sort.SearchInts(keys, key)
+	return i, i < len(keys) && keys[i] == key
+}
+
+func entryKey[V any](e *sortedmap.Entry[int, V]) int {
+	if e == nil {
+		return -1
+	}
+	return e.Key
+}
+
+func keyAt(keys []int, i int) int {
+	if i < 0 || i >= len(keys) {
+		return -1
+	}
+	return keys[i]
+}
+
+func testNavigableMapOf(t *testing.T, m navigableMapOf[int, int]) {
+	for i := 0; i < 2000; i++ {
+		k := rand.Intn(1000) * 2
+		m.Put(k, k)
+		if i%3 == 0 {
+			m.Delete(rand.Intn(1000) * 2)
+		}
+	}
+	for round := 0; round < 20; round++ {
+		keys := m.Keys()
+		for i := 0; i < 100; i++ {
+			k := rand.Intn(2100) - 50
+			pos, found := searchKeys(keys, k)
+			assert.Equal(t, pos, m.Rank(k))
+			if found {
+				assert.Equal(t, k, entryKey(m.Floor(k)))
+				assert.Equal(t, k, entryKey(m.Ceiling(k)))
+				assert.Equal(t, keyAt(keys, pos+1), entryKey(m.Higher(k)))
+			} else {
+				assert.Equal(t, keyAt(keys, pos-1), entryKey(m.Floor(k)))
+				assert.Equal(t, keyAt(keys, pos), entryKey(m.Ceiling(k)))
+				assert.Equal(t, keyAt(keys, pos), entryKey(m.Higher(k)))
+			}
+			assert.Equal(t, keyAt(keys, pos-1), entryKey(m.Lower(k)))
+			idx := rand.Intn(len(keys)+2) - 1
+			assert.Equal(t, keyAt(keys, idx), entryKey(m.Select(idx)))
+		}
+		assert.Equal(t, keys[0], m.PopFirst().Key)
+		assert.Equal(t, keys[len(keys)-1], m.PopLast().Key)
+		keys = m.Keys()
+		from := rand.Intn(2000)
+		to := from + rand.Intn(100)
+		expect := 0
+		for _, k := range keys {
+			if k >= from && k <= to {
+				expect++
+			}
+		}
+		assert.Equal(t, expect, m.DeleteRange(&from, &to))
+		assert.Equal(t, len(keys)-expect, m.Len())
+		if e := m.Ceiling(from); e != nil {
+			assert.Greater(t, e.Key, to)
+		}
+		// from > to 时不删除
+		assert.Equal(t, 0, m.DeleteRange(&to, &from))
+	}
+	to := 1000
+	n := m.Len()
+	deleted := m.DeleteRange(nil, &to)
+	assert.Equal(t, n-deleted, m.Len())
+	assert.True(t, m.FirstItem().Key > to)
+	assert.Equal(t, m.Len(), m.DeleteRange(nil, nil))
+	assert.Nil(t, m.PopFirst())
+	assert.Nil(t, m.PopLast())
+	assert.Nil(t, m.Select(0))
+	assert.Equal(t, 0, m.Rank(10))
+}
+
+func TestNavigableMapOf(t *testing.T) {
+	testNavigableMapOf(t, sortedmap.NewTreeMapOf[int, int]())
+	testNavigableMapOf(t, sortedmap.NewTreapMapOf[int, int]())
+}
+
+func TestNavigableMap(t *testing.T) {
+	for _, m := range []sortedmap.NavigableMap{sortedmap.NewTreeMap(), sortedmap.NewTreapMap()} {
+		for _, k := range []int{10, 20, 30, 40, 50} {
+			m.Put(k, k)
+		}
+		assert.Equal(t, 20, m.Floor(25).Key)
+		assert.Equal(t, 20, m.Floor(20).Key)
+		assert.Equal(t, 10, m.Lower(20).Key)
+		assert.Equal(t, 30, m.Ceiling(25).Key)
+		assert.Equal(t, 30, m.Higher(20).Key)
+		assert.Nil(t, m.Floor(5))
+		assert.Nil(t, m.Higher(50))
+		assert.Equal(t, 2, m.Rank(25))
+		assert.Equal(t, 40, m.Select(3).Key)
+		assert.Nil(t, m.Select(5))
+		assert.Equal(t, 10, m.PopFirst().Key)
+		assert.Equal(t, 50, m.PopLast().Key)
+		assert.Equal(t, 2, m.DeleteRange(15, 30))
+		assert.Equal(t, []interface{}{40}, m.Keys())
+		assert.False(t, m.Has(20))
+		assert.Equal(t, 1, m.DeleteRange(nil, nil))
+		assert.Equal(t, 0, m.Len())
+	}
+}
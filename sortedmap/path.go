@@ -0,0 +1,472 @@
+package sortedmap
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wecisecode/util/cast"
+	"github.com/wecisecode/util/merrs"
+)
+
+// 路径查询，适用于 SortedMap map[string]interface{} map[interface{}]interface{} 及 []interface{} 嵌套的数据
+// 路径格式如 a.b[2].c，key 之间以 . 分隔，[n] 为数组下标，负数下标从末尾开始计数
+// * 匹配任意 key，[*] 匹配任意下标，key 中的 . [ ] * \ 需要用 \ 转义
+// 空路径表示数据本身
+
+type pathElem struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// 路径匹配的值及其实际路径
+type PathValue struct {
+	Path  string
+	Value interface{}
+}
+
+func parsePath(path string) ([]*pathElem, error) {
+	elems := []*pathElem{}
+	key := []byte{}
+	// 当前 key 是否有内容，用于区分空 key
+	inKey := false
+	escaped := false
+	endKey := func() {
+		if !inKey {
+			return
+		}
+		e := &pathElem{key: string(key)}
+		if !escaped && e.key == "*" {
+			e.wildcard = true
+		}
+		elems = append(elems, e)
+		key = key[:0]
+		inKey = false
+		escaped = false
+	}
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; c {
+		case '\\':
+			if i+1 >= len(path) {
+				return nil, merrs.NewError("path %s ends with escape character", path)
+			}
+			i++
+			key = append(key, path[i])
+			inKey = true
+			escaped = true
+		case '.':
+			if !inKey && (i == 0 || path[i-1] != ']') {
+				return nil, merrs.NewError("path %s has empty key at %d", path, i)
+			}
+			endKey()
+			if i == len(path)-1 {
+				return nil, merrs.NewError("path %s ends with .", path)
+			}
+		case '[':
+			endKey()
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, merrs.NewError("path %s missing ]", path)
+			}
+			s := path[i+1 : i+end]
+			e := &pathElem{isIndex: true}
+			if s == "*" {
+				e.wildcard = true
+			} else {
+				n, err := strconv.Atoi(s)
+				if err != nil {
+					return nil, merrs.NewError("path %s has invalid index %s", path, s)
+				}
+				e.index = n
+			}
+			elems = append(elems, e)
+			i += end
+			if i+1 < len(path) && path[i+1] != '.' && path[i+1] != '[' {
+				return nil, merrs.NewError("path %s expect . or [ at %d", path, i+1)
+			}
+		case ']':
+			return nil, merrs.NewError("path %s has unexpected ] at %d", path, i)
+		default:
+			key = append(key, c)
+			inKey = true
+		}
+	}
+	endKey()
+	return elems, nil
+}
+
+func escapePathKey(key string) string {
+	if key == "*" {
+		return `\*`
+	}
+	if !strings.ContainsAny(key, `.[]\`) {
+		return key
+	}
+	bs := make([]byte, 0, len(key)+4)
+	for i := 0; i < len(key); i++ {
+		switch key[i] {
+		case '.', '[', ']', '\\':
+			bs = append(bs, '\\')
+		}
+		bs = append(bs, key[i])
+	}
+	return string(bs)
+}
+
+func joinPathKey(path, key string) string {
+	if path == "" {
+		return escapePathKey(key)
+	}
+	return path + "." + escapePathKey(key)
+}
+
+func joinPathIndex(path string, i int) string {
+	return path + "[" + strconv.Itoa(i) + "]"
+}
+
+// 按 key 取 map 中的值，v 不是 map 时 ok 返回 false
+func pathMapGet(v interface{}, key string) (value interface{}, ok bool) {
+	_, value, ok = pathMapKey(v, key)
+	return
+}
+
+// 查找 map 中与 key 对应的实际 key，key 不是字符串类型时按字符串比较，v 不是 map 或 key 不存在时 ok 返回 false
+func pathMapKey(v interface{}, key string) (mkey interface{}, value interface{}, ok bool) {
+	switch m := v.(type) {
+	case Map:
+		if value, ok = m.Get(key); ok {
+			return key, value, true
+		}
+		m.Fetch(func(k, val interface{}) bool {
+			if _, isString := k.(string); !isString && cast.ToString(k) == key {
+				mkey, value, ok = k, val, true
+				return false
+			}
+			return true
+		})
+		return mkey, value, ok
+	case map[string]interface{}:
+		value, ok = m[key]
+		return key, value, ok
+	case map[interface{}]interface{}:
+		if value, ok = m[key]; ok {
+			return key, value, true
+		}
+		for k, val := range m {
+			if cast.ToString(k) == key {
+				return k, val, true
+			}
+		}
+	}
+	return nil, nil, false
+}
+
+// 遍历 map 中的所有项，Go map 按 key 排序，v 不是 map 时返回 false
+func pathMapEach(v interface{}, p func(key string, value interface{}) bool) bool {
+	switch m := v.(type) {
+	case Map:
+		m.Fetch(func(k, val interface{}) bool {
+			return p(cast.ToString(k), val)
+		})
+	case map[string]interface{}:
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if !p(k, m[k]) {
+				break
+			}
+		}
+	case map[interface{}]interface{}:
+		keys := make([]string, 0, len(m))
+		values := make(map[string]interface{}, len(m))
+		for k, val := range m {
+			s := cast.ToString(k)
+			keys = append(keys, s)
+			values[s] = val
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if !p(k, values[k]) {
+				break
+			}
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// 已存在与 key 对应的非字符串 key 时替换其值
+func pathMapPut(v interface{}, key string, value interface{}) bool {
+	mkey, _, ok := pathMapKey(v, key)
+	if !ok {
+		mkey = key
+	}
+	switch m := v.(type) {
+	case Map:
+		m.Put(mkey, value)
+	case map[string]interface{}:
+		m[key] = value
+	case map[interface{}]interface{}:
+		m[mkey] = value
+	default:
+		return false
+	}
+	return true
+}
+
+func pathMapDelete(v interface{}, key string) bool {
+	mkey, _, ok := pathMapKey(v, key)
+	if !ok {
+		return false
+	}
+	switch m := v.(type) {
+	case Map:
+		return m.Delete(mkey)
+	case map[string]interface{}:
+		delete(m, key)
+	case map[interface{}]interface{}:
+		delete(m, mkey)
+	}
+	return true
+}
+
+// 负数下标从末尾开始计数，超出范围时返回 false
+func pathIndex(vs []interface{}, i int) (int, bool) {
+	if i < 0 {
+		i += len(vs)
+	}
+	return i, i >= 0 && i < len(vs)
+}
+
+// 遍历路径匹配的值，p 返回 false 时停止
+func findPath(v interface{}, path string, elems []*pathElem, p func(path string, value interface{}) bool) bool {
+	if len(elems) == 0 {
+		return p(path, v)
+	}
+	e, rest := elems[0], elems[1:]
+	if e.isIndex {
+		vs, ok := v.([]interface{})
+		if !ok {
+			return true
+		}
+		if e.wildcard {
+			for i, value := range vs {
+				if !findPath(value, joinPathIndex(path, i), rest, p) {
+					return false
+				}
+			}
+			return true
+		}
+		if i, ok := pathIndex(vs, e.index); ok {
+			return findPath(vs[i], joinPathIndex(path, i), rest, p)
+		}
+		return true
+	}
+	if e.wildcard {
+		ret := true
+		pathMapEach(v, func(key string, value interface{}) bool {
+			ret = findPath(value, joinPathKey(path, key), rest, p)
+			return ret
+		})
+		return ret
+	}
+	if value, ok := pathMapGet(v, e.key); ok {
+		return findPath(value, joinPathKey(path, e.key), rest, p)
+	}
+	return true
+}
+
+// 取路径对应的值，路径中有通配符时返回第一个匹配的值，路径格式错误或不存在时返回 false
+func GetPath(v interface{}, path string) (value interface{}, ok bool) {
+	elems, err := parsePath(path)
+	if err != nil {
+		return nil, false
+	}
+	findPath(v, "", elems, func(path string, val interface{}) bool {
+		value, ok = val, true
+		return false
+	})
+	return value, ok
+}
+
+// 查找路径匹配的所有值，返回值中的路径为实际的 key 及下标
+func FindPath(v interface{}, path string) ([]*PathValue, error) {
+	elems, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	pvs := []*PathValue{}
+	findPath(v, "", elems, func(path string, value interface{}) bool {
+		pvs = append(pvs, &PathValue{Path: path, Value: value})
+		return true
+	})
+	return pvs, nil
+}
+
+// 设置路径对应的值，路径中不能有通配符
+// 不存在的 key 自动创建，下一级为 key 时创建 *LinkedMap，为下标时创建 []interface{}
+// 下标等于数组长度时追加到末尾，更大的下标返回错误
+func SetPath(sm SortedMap, path string, value interface{}) error {
+	elems, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	if len(elems) == 0 || elems[0].isIndex {
+		return merrs.NewError("path %s must start with a key", path)
+	}
+	for _, e := range elems {
+		if e.wildcard {
+			return merrs.NewError("path %s can not set with wildcard", path)
+		}
+	}
+	_, err = setPath(sm, path, elems, value)
+	return err
+}
+
+// 返回设置后的值，数组追加元素时与原值不同，需要写回上一级
+func setPath(v interface{}, path string, elems []*pathElem, value interface{}) (interface{}, error) {
+	if len(elems) == 0 {
+		return value, nil
+	}
+	e, rest := elems[0], elems[1:]
+	if e.isIndex {
+		if v == nil {
+			v = []interface{}{}
+		}
+		vs, ok := v.([]interface{})
+		if !ok {
+			return nil, merrs.NewError("path %s index %d on non-array value", path, e.index)
+		}
+		if e.index == len(vs) {
+			nv, err := setPath(nil, path, rest, value)
+			if err != nil {
+				return nil, err
+			}
+			return append(vs, nv), nil
+		}
+		i, ok := pathIndex(vs, e.index)
+		if !ok {
+			return nil, merrs.NewError("path %s index %d out of range %d", path, e.index, len(vs))
+		}
+		nv, err := setPath(vs[i], path, rest, value)
+		if err != nil {
+			return nil, err
+		}
+		vs[i] = nv
+		return vs, nil
+	}
+	if v == nil {
+		v = NewLinkedMap()
+	}
+	old, _ := pathMapGet(v, e.key)
+	nv, err := setPath(old, path, rest, value)
+	if err != nil {
+		return nil, err
+	}
+	if !pathMapPut(v, e.key, nv) {
+		return nil, merrs.NewError("path %s key %s on non-map value", path, e.key)
+	}
+	return v, nil
+}
+
+// 删除路径匹配的所有值，返回删除的个数
+func DeletePath(sm SortedMap, path string) (int, error) {
+	elems, err := parsePath(path)
+	if err != nil {
+		return 0, err
+	}
+	if len(elems) == 0 || elems[0].isIndex {
+		return 0, merrs.NewError("path %s must start with a key", path)
+	}
+	_, n := deletePath(sm, elems)
+	return n, nil
+}
+
+// 返回删除后的值，删除数组元素时与原值不同，需要写回上一级
+func deletePath(v interface{}, elems []*pathElem) (interface{}, int) {
+	e, rest := elems[0], elems[1:]
+	n := 0
+	if e.isIndex {
+		vs, ok := v.([]interface{})
+		if !ok {
+			return v, 0
+		}
+		idx := []int{}
+		if e.wildcard {
+			for i := range vs {
+				idx = append(idx, i)
+			}
+		} else if i, ok := pathIndex(vs, e.index); ok {
+			idx = append(idx, i)
+		}
+		if len(rest) > 0 {
+			for _, i := range idx {
+				var c int
+				vs[i], c = deletePath(vs[i], rest)
+				n += c
+			}
+			return vs, n
+		}
+		if len(idx) == 0 {
+			return v, 0
+		}
+		if e.wildcard {
+			return vs[:0], len(vs)
+		}
+		return append(vs[:idx[0]], vs[idx[0]+1:]...), 1
+	}
+	keys := []string{}
+	if e.wildcard {
+		pathMapEach(v, func(key string, value interface{}) bool {
+			keys = append(keys, key)
+			return true
+		})
+	} else if _, ok := pathMapGet(v, e.key); ok {
+		keys = append(keys, e.key)
+	}
+	for _, key := range keys {
+		if len(rest) == 0 {
+			if pathMapDelete(v, key) {
+				n++
+			}
+			continue
+		}
+		value, _ := pathMapGet(v, key)
+		nv, c := deletePath(value, rest)
+		if c > 0 {
+			pathMapPut(v, key, nv)
+			n += c
+		}
+	}
+	return v, n
+}
+
+// 按顺序遍历所有非 map 非数组的值及其路径，p 返回 false 时停止
+func WalkPath(v interface{}, p func(path string, value interface{}) bool) {
+	walkPath(v, "", p)
+}
+
+func walkPath(v interface{}, path string, p func(path string, value interface{}) bool) bool {
+	if vs, ok := v.([]interface{}); ok {
+		for i, value := range vs {
+			if !walkPath(value, joinPathIndex(path, i), p) {
+				return false
+			}
+		}
+		return true
+	}
+	ret := true
+	if pathMapEach(v, func(key string, value interface{}) bool {
+		ret = walkPath(value, joinPathKey(path, key), p)
+		return ret
+	}) {
+		return ret
+	}
+	return p(path, v)
+}
@@ -0,0 +1,73 @@
+package sortedmap_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wecisecode/util/sortedmap"
+)
+
+func TestPath(t *testing.T) {
+	sm := sortedmap.NewLinkedMap()
+	assert.Nil(t, sm.UnmarshalJSON([]byte(`{"a":{"b":[1,2,{"c":"x"}],"d.e":true},"f":[{"g":1},{"g":2}]}`)))
+
+	v, ok := sortedmap.GetPath(sm, "a.b[2].c")
+	assert.True(t, ok)
+	assert.Equal(t, "x", v)
+	v, _ = sortedmap.GetPath(sm, "a.b[-2]")
+	assert.Equal(t, int64(2), v)
+	v, _ = sortedmap.GetPath(sm, `a.d\.e`)
+	assert.Equal(t, true, v)
+	_, ok = sortedmap.GetPath(sm, "a.b[3]")
+	assert.False(t, ok)
+	_, ok = sortedmap.GetPath(sm, "a..b")
+	assert.False(t, ok)
+	v, _ = sortedmap.GetPath(sm, "")
+	assert.Equal(t, sm, v)
+
+	pvs, err := sortedmap.FindPath(sm, "f[*].g")
+	assert.Nil(t, err)
+	assert.Equal(t, []*sortedmap.PathValue{{Path: "f[0].g", Value: int64(1)}, {Path: "f[1].g", Value: int64(2)}}, pvs)
+	pvs, _ = sortedmap.FindPath(sm, "*.b[0]")
+	assert.Equal(t, []*sortedmap.PathValue{{Path: "a.b[0]", Value: int64(1)}}, pvs)
+	_, err = sortedmap.FindPath(sm, "a[x]")
+	assert.NotNil(t, err)
+
+	// 创建不存在的 key，下标等于长度时追加
+	assert.Nil(t, sortedmap.SetPath(sm, "a.b[2].c", "y"))
+	assert.Nil(t, sortedmap.SetPath(sm, "a.b[3]", int64(4)))
+	assert.Nil(t, sortedmap.SetPath(sm, "h.i[0].j", "new"))
+	assert.NotNil(t, sortedmap.SetPath(sm, "h.i[5]", 1))
+	assert.NotNil(t, sortedmap.SetPath(sm, "f[*].g", 1))
+	assert.NotNil(t, sortedmap.SetPath(sm, "a.b.c", 1))
+	v, _ = sortedmap.GetPath(sm, "h.i[0].j")
+	assert.Equal(t, "new", v)
+	v, _ = sortedmap.GetPath(sm, "a.b[2].c")
+	assert.Equal(t, "y", v)
+
+	paths := []string{}
+	sortedmap.WalkPath(sm, func(path string, value interface{}) bool {
+		paths = append(paths, path)
+		return true
+	})
+	assert.Equal(t, "a.b[0] a.b[1] a.b[2].c a.b[3] a.d\\.e f[0].g f[1].g h.i[0].j", strings.Join(paths, " "))
+
+	n, err := sortedmap.DeletePath(sm, "f[*].g")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	n, _ = sortedmap.DeletePath(sm, "a.b[0]")
+	assert.Equal(t, 1, n)
+	v, _ = sortedmap.GetPath(sm, "a.b[0]")
+	assert.Equal(t, int64(2), v)
+	n, _ = sortedmap.DeletePath(sm, "*")
+	assert.Equal(t, 3, n)
+	assert.Equal(t, 0, sm.Len())
+
+	// Go map 按 key 排序
+	m := map[string]interface{}{"b": []interface{}{map[interface{}]interface{}{1: "x"}}, "a": 1}
+	pvs, _ = sortedmap.FindPath(m, "*")
+	assert.Equal(t, "a", pvs[0].Path)
+	v, _ = sortedmap.GetPath(m, "b[0].1")
+	assert.Equal(t, "x", v)
+}
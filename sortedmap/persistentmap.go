@@ -0,0 +1,153 @@
+package sortedmap
+
+import (
+	"cmp"
+	"math/rand"
+)
+
+// 不可变有序 map，Put Delete 等修改操作返回新的版本，原版本不变
+// 新旧版本共享未修改的节点，修改代价为 O(log n)，可以无锁并发读取
+// 零值不可用，需通过 NewPersistentMap 或 NewPersistentMapFunc 创建
+type PersistentMap[K any, V any] struct {
+	treap *treap[K, V]
+}
+
+// 使用 cmp.Compare 比较 key
+func NewPersistentMap[K cmp.Ordered, V any]() *PersistentMap[K, V] {
+	return NewPersistentMapFunc[K, V](cmp.Compare[K])
+}
+
+// 使用指定的比较函数，a < b 返回负数，a == b 返回 0，a > b 返回正数
+func NewPersistentMapFunc[K any, V any](compare func(a, b K) int) *PersistentMap[K, V] {
+	return &PersistentMap[K, V]{treap: newTreap[K, V](compare)}
+}
+
+// 返回设置 key 后的新版本
+func (m *PersistentMap[K, V]) Put(key K, value V) *PersistentMap[K, V] {
+	return &PersistentMap[K, V]{treap: m.treap.upsert(key, value, rand.Int())}
+}
+
+// 返回删除 key 后的新版本，key 不存在时返回当前版本
+func (m *PersistentMap[K, V]) Delete(key K) *PersistentMap[K, V] {
+	if m.treap.get(key) == nil {
+		return m
+	}
+	return &PersistentMap[K, V]{treap: m.treap.delete(key)}
+}
+
+// 返回删除 from 到 to 之间的项后的新版本及删除的项数，包括 from 和 to，from 或 to 为 nil 时不限制
+func (m *PersistentMap[K, V]) DeleteRange(from, to *K) (*PersistentMap[K, V], int) {
+	t, n := m.treap.deleteRange(from, to)
+	if n == 0 {
+		return m, 0
+	}
+	return &PersistentMap[K, V]{treap: t}, n
+}
+
+// 返回空的新版本
+func (m *PersistentMap[K, V]) Clear() *PersistentMap[K, V] {
+	return NewPersistentMapFunc[K, V](m.treap.compare)
+}
+
+func (m *PersistentMap[K, V]) Get(key K, defaultValue ...V) (V, bool) {
+	if n := m.treap.get(key); n != nil {
+		return n.value, true
+	}
+	if len(defaultValue) > 0 {
+		return defaultValue[0], false
+	}
+	var v V
+	return v, false
+}
+
+func (m *PersistentMap[K, V]) GetValue(key K, defaultValue ...V) V {
+	v, _ := m.Get(key, defaultValue...)
+	return v
+}
+
+func (m *PersistentMap[K, V]) Has(key K) bool {
+	return m.treap.get(key) != nil
+}
+
+func (m *PersistentMap[K, V]) Len() int {
+	return m.treap.root.Size()
+}
+
+// 为空时返回 nil
+func (m *PersistentMap[K, V]) FirstItem() *Entry[K, V] {
+	return m.treap.min().entry()
+}
+
+// 为空时返回 nil
+func (m *PersistentMap[K, V]) LastItem() *Entry[K, V] {
+	return m.treap.max().entry()
+}
+
+// 小于等于 key 的最大项，不存在时返回 nil
+func (m *PersistentMap[K, V]) Floor(key K) *Entry[K, V] {
+	return m.treap.floor(key, true).entry()
+}
+
+// 大于等于 key 的最小项，不存在时返回 nil
+func (m *PersistentMap[K, V]) Ceiling(key K) *Entry[K, V] {
+	return m.treap.ceiling(key, true).entry()
+}
+
+// 小于 key 的最大项，不存在时返回 nil
+func (m *PersistentMap[K, V]) Lower(key K) *Entry[K, V] {
+	return m.treap.floor(key, false).entry()
+}
+
+// 大于 key 的最小项，不存在时返回 nil
+func (m *PersistentMap[K, V]) Higher(key K) *Entry[K, V] {
+	return m.treap.ceiling(key, false).entry()
+}
+
+// 小于 key 的项数
+func (m *PersistentMap[K, V]) Rank(key K) int {
+	return m.treap.rank(key)
+}
+
+// 按顺序的第 i 项，从 0 开始，超出范围时返回 nil
+func (m *PersistentMap[K, V]) Select(i int) *Entry[K, V] {
+	return m.treap.selectAt(i).entry()
+}
+
+func (m *PersistentMap[K, V]) Keys() []K {
+	keys := make([]K, 0, m.Len())
+	m.Fetch(func(key K, value V) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+func (m *PersistentMap[K, V]) Values() []V {
+	vals := make([]V, 0, m.Len())
+	m.Fetch(func(key K, value V) bool {
+		vals = append(vals, value)
+		return true
+	})
+	return vals
+}
+
+// 按 key 升序遍历，p 返回 false 时结束
+func (m *PersistentMap[K, V]) Fetch(p func(key K, value V) bool) {
+	m.treap.each(m.treap.root, false, func(n *treapNode[K, V]) bool {
+		return p(n.key, n.value)
+	})
+}
+
+// 按 key 降序遍历，p 返回 false 时结束
+func (m *PersistentMap[K, V]) FetchReverse(p func(key K, value V) bool) {
+	m.treap.each(m.treap.root, true, func(n *treapNode[K, V]) bool {
+		return p(n.key, n.value)
+	})
+}
+
+// 遍历 from 到 to 之间的数据，包括 from 和 to，from 或 to 为 nil 时不限制
+func (m *PersistentMap[K, V]) FetchRange(from, to *K, p func(key K, value V) bool, reverse bool) {
+	m.treap.fetchRange(from, to, reverse, func(n *treapNode[K, V]) bool {
+		return p(n.key, n.value)
+	})
+}
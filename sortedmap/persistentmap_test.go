@@ -0,0 +1,76 @@
+package sortedmap_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wecisecode/util/sortedmap"
+)
+
+func TestPersistentMap(t *testing.T) {
+	v0 := sortedmap.NewPersistentMap[string, int]()
+	v1 := v0.Put("b", 2).Put("a", 1).Put("c", 3)
+	v2 := v1.Put("b", 20).Delete("a")
+	assert.Equal(t, 0, v0.Len())
+	assert.Equal(t, []string{"a", "b", "c"}, v1.Keys())
+	assert.Equal(t, []int{1, 2, 3}, v1.Values())
+	assert.Equal(t, []string{"b", "c"}, v2.Keys())
+	assert.Equal(t, 20, v2.GetValue("b"))
+	assert.Equal(t, 2, v1.GetValue("b"))
+	// 删除不存在的 key 返回原版本
+	assert.Same(t, v2, v2.Delete("x"))
+	v3, n := v1.DeleteRange(nil, ptr("b"))
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []string{"c"}, v3.Keys())
+	assert.Equal(t, 3, v1.Len())
+	assert.Equal(t, "b", v1.Floor("bb").Key)
+	assert.Equal(t, "c", v1.Select(2).Key)
+	assert.Equal(t, 0, v1.Clear().Len())
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestTreapMapSnapshot(t *testing.T) {
+	m := sortedmap.NewTreapMapOf[int, int]()
+	for i := 0; i < 100; i++ {
+		m.Put(i, i)
+	}
+	snapshot := m.Snapshot()
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			m.Delete(i)
+			m.Put(i+1000, i)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		// 快照不受后续修改影响，读取时不需要加锁
+		for i := 0; i < 10; i++ {
+			sum := 0
+			snapshot.Fetch(func(key, value int) bool {
+				sum += value
+				return true
+			})
+			assert.Equal(t, 4950, sum)
+		}
+	}()
+	wg.Wait()
+	assert.Equal(t, 100, snapshot.Len())
+	assert.Equal(t, 1000, m.FirstItem().Key)
+
+	lm := sortedmap.NewTreapMap()
+	lm.Put("a", 1)
+	cp := lm.Copy()
+	ls := lm.Snapshot()
+	lm.Put("b", 2)
+	cp.Delete("a")
+	assert.Equal(t, []interface{}{"a", "b"}, lm.Keys())
+	assert.Equal(t, 0, cp.Len())
+	assert.Equal(t, []interface{}{"a"}, ls.Keys())
+}
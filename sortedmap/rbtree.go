@@ -1,333 +1,412 @@
 package sortedmap
 
-// redBlackTree is an implemantation of a Red Black Tree
-type redBlackTree struct {
-	compare Compare
-	root    *redBlackNode
-	min     *redBlackNode
-	max     *redBlackNode
-	size    int
+// redBlackTree is an implemantation of a left-leaning Red Black Tree
+// every node keeps the size of its subtree for order statistic operations
+type redBlackTree[K any, V any] struct {
+	compare func(a, b K) int
+	root    *redBlackNode[K, V]
 }
 
 // redBlackNode is a node of the redBlackTree
-type redBlackNode struct {
-	item  Item
-	left  *redBlackNode
-	right *redBlackNode
+type redBlackNode[K any, V any] struct {
+	key   K
+	value V
+	left  *redBlackNode[K, V]
+	right *redBlackNode[K, V]
 	red   bool
+	size  int
 }
 
-func NewRedBlackTree(compare Compare) *redBlackTree {
-	return &redBlackTree{compare: compare}
+func newRedBlackTree[K any, V any](compare func(a, b K) int) *redBlackTree[K, V] {
+	return &redBlackTree[K, V]{compare: compare}
 }
 
 // Size returns the number of nodes in the redBlackTree
-func (t *redBlackTree) Size() int {
-	return t.size
+func (t *redBlackTree[K, V]) Size() int {
+	return t.root.Size()
 }
 
-// Child returns the left or right node of the redBlackTree
-func (n *redBlackNode) Child(right bool) *redBlackNode {
-	if right {
-		return n.right
+// Size returns the number of nodes in the subtree, 0 for nil
+func (n *redBlackNode[K, V]) Size() int {
+	if n == nil {
+		return 0
 	}
-	return n.left
+	return n.size
 }
 
-func (n *redBlackNode) setChild(right bool, node *redBlackNode) {
+// Child returns the left or right node of the redBlackTree
+func (n *redBlackNode[K, V]) Child(right bool) *redBlackNode[K, V] {
 	if right {
-		n.right = node
-	} else {
-		n.left = node
+		return n.right
 	}
+	return n.left
 }
 
 // returns true if redBlackNode is red
-func isRed(node *redBlackNode) bool {
+func isRed[K any, V any](node *redBlackNode[K, V]) bool {
 	return node != nil && node.red
 }
 
-func singleRotate(oldroot *redBlackNode, dir bool) *redBlackNode {
-	newroot := oldroot.Child(!dir)
-
-	oldroot.setChild(!dir, newroot.Child(dir))
-	newroot.setChild(dir, oldroot)
-
-	oldroot.red = true
-	newroot.red = false
-
-	return newroot
+func rotateLeft[K any, V any](h *redBlackNode[K, V]) *redBlackNode[K, V] {
+	x := h.right
+	h.right = x.left
+	x.left = h
+	x.red = h.red
+	h.red = true
+	x.size = h.size
+	h.size = 1 + h.left.Size() + h.right.Size()
+	return x
 }
 
-func doubleRotate(root *redBlackNode, dir bool) *redBlackNode {
-	root.setChild(!dir, singleRotate(root.Child(!dir), !dir))
-	return singleRotate(root, dir)
+func rotateRight[K any, V any](h *redBlackNode[K, V]) *redBlackNode[K, V] {
+	x := h.left
+	h.left = x.right
+	x.right = h
+	x.red = h.red
+	h.red = true
+	x.size = h.size
+	h.size = 1 + h.left.Size() + h.right.Size()
+	return x
 }
 
-func (t *redBlackTree) Min() Item {
-	return t.min.item
+func flipColors[K any, V any](h *redBlackNode[K, V]) {
+	h.red = !h.red
+	h.left.red = !h.left.red
+	h.right.red = !h.right.red
 }
 
-func (t *redBlackTree) Max() Item {
-	return t.max.item
+// restore left-leaning invariants on the way up
+func fixUp[K any, V any](h *redBlackNode[K, V]) *redBlackNode[K, V] {
+	if isRed(h.right) && !isRed(h.left) {
+		h = rotateLeft(h)
+	}
+	if isRed(h.left) && isRed(h.left.left) {
+		h = rotateRight(h)
+	}
+	if isRed(h.left) && isRed(h.right) {
+		flipColors(h)
+	}
+	h.size = 1 + h.left.Size() + h.right.Size()
+	return h
 }
 
-// Insert inserts a value and string into the tree
-// Returns true on succesful insertion, false if duplicate exists
-func (t *redBlackTree) Insert(item Item) (ret bool) {
-	if t.root == nil {
-		t.root = &redBlackNode{item: item}
-		t.min = t.root
-		t.max = t.root
-		ret = true
-	} else {
-		var head = &redBlackNode{}
-
-		var dir = true
-		var last = true
-
-		var parent *redBlackNode  // parent
-		var gparent *redBlackNode // grandparent
-		var ggparent = head       // great grandparent
-		var node = t.root
-
-		ggparent.right = t.root
-
-		for {
-			if node == nil {
-				// insert new node at bottom
-				node = &redBlackNode{item: item, red: true}
-				parent.setChild(dir, node)
-				if t.compare(item, t.min.item) < 0 {
-					t.min = node
-				} else if t.compare(item, t.max.item) > 0 {
-					t.max = node
-				}
-				ret = true
-			} else if isRed(node.left) && isRed(node.right) {
-				// flip colors
-				node.red = true
-				node.left.red, node.right.red = false, false
-			}
-			// fix red violation
-			if isRed(node) && isRed(parent) {
-				dir2 := ggparent.right == gparent
-
-				if node == parent.Child(last) {
-					ggparent.setChild(dir2, singleRotate(gparent, !last))
-				} else {
-					ggparent.setChild(dir2, doubleRotate(gparent, !last))
-				}
-			}
-
-			cmp := t.compare(node.item, item)
-
-			// stop if found
-			if cmp == 0 {
-				break
-			}
-
-			last = dir
-			dir = cmp < 0
+func moveRedLeft[K any, V any](h *redBlackNode[K, V]) *redBlackNode[K, V] {
+	flipColors(h)
+	if isRed(h.right.left) {
+		h.right = rotateRight(h.right)
+		h = rotateLeft(h)
+		flipColors(h)
+	}
+	return h
+}
 
-			// update helpers
-			if gparent != nil {
-				ggparent = gparent
-			}
-			gparent = parent
-			parent = node
+func moveRedRight[K any, V any](h *redBlackNode[K, V]) *redBlackNode[K, V] {
+	flipColors(h)
+	if isRed(h.left.left) {
+		h = rotateRight(h)
+		flipColors(h)
+	}
+	return h
+}
 
-			node = node.Child(dir)
-		}
+// 空树时返回 nil
+func (t *redBlackTree[K, V]) Min() *redBlackNode[K, V] {
+	n := t.root
+	for n != nil && n.left != nil {
+		n = n.left
+	}
+	return n
+}
 
-		t.root = head.right
+// 空树时返回 nil
+func (t *redBlackTree[K, V]) Max() *redBlackNode[K, V] {
+	n := t.root
+	for n != nil && n.right != nil {
+		n = n.right
 	}
+	return n
+}
 
-	// make root black
+// Insert inserts a key and value into the tree
+// Returns true on succesful insertion, false if the key exists and the value is replaced
+func (t *redBlackTree[K, V]) Insert(key K, value V) (ret bool) {
+	t.root = t.insert(t.root, key, value, &ret)
 	t.root.red = false
+	return ret
+}
 
-	if ret {
-		t.size++
+func (t *redBlackTree[K, V]) insert(h *redBlackNode[K, V], key K, value V, inserted *bool) *redBlackNode[K, V] {
+	if h == nil {
+		*inserted = true
+		return &redBlackNode[K, V]{key: key, value: value, red: true, size: 1}
 	}
-
-	return ret
+	cmp := t.compare(key, h.key)
+	if cmp < 0 {
+		h.left = t.insert(h.left, key, value, inserted)
+	} else if cmp > 0 {
+		h.right = t.insert(h.right, key, value, inserted)
+	} else {
+		// replace the existing key and value
+		h.key = key
+		h.value = value
+	}
+	return fixUp(h)
 }
 
-// Delete removes a value from the redBlackTree
-// Returns true on succesful deletion, false if val is not in tree
-func (t *redBlackTree) Delete(item Item) bool {
-	if t.root == nil {
+// Delete removes a key from the redBlackTree
+// Returns true on succesful deletion, false if key is not in tree
+func (t *redBlackTree[K, V]) Delete(key K) bool {
+	if t.Search(key) == nil {
 		return false
 	}
+	if !isRed(t.root.left) && !isRed(t.root.right) {
+		t.root.red = true
+	}
+	t.root = t.delete(t.root, key)
+	if t.root != nil {
+		t.root.red = false
+	}
+	return true
+}
 
-	var head = &redBlackNode{red: true} // fake red node to push down
-	var node = head
-	var parent *redBlackNode  //parent
-	var gparent *redBlackNode //grandparent
-	var found *redBlackNode
-
-	var dir = true
-
-	node.right = t.root
-
-	for node.Child(dir) != nil {
-		last := dir
-
-		// update helpers
-		gparent = parent
-		parent = node
-		node = node.Child(dir)
-
-		cmp := t.compare(node.item, item)
+// key must exist in the subtree
+func (t *redBlackTree[K, V]) delete(h *redBlackNode[K, V], key K) *redBlackNode[K, V] {
+	if t.compare(key, h.key) < 0 {
+		if !isRed(h.left) && !isRed(h.left.left) {
+			h = moveRedLeft(h)
+		}
+		h.left = t.delete(h.left, key)
+	} else {
+		if isRed(h.left) {
+			h = rotateRight(h)
+		}
+		if t.compare(key, h.key) == 0 && h.right == nil {
+			return nil
+		}
+		if !isRed(h.right) && !isRed(h.right.left) {
+			h = moveRedRight(h)
+		}
+		if t.compare(key, h.key) == 0 {
+			m := h.right
+			for m.left != nil {
+				m = m.left
+			}
+			h.key = m.key
+			h.value = m.value
+			h.right = deleteMin(h.right)
+		} else {
+			h.right = t.delete(h.right, key)
+		}
+	}
+	return fixUp(h)
+}
 
-		dir = cmp < 0
+func deleteMin[K any, V any](h *redBlackNode[K, V]) *redBlackNode[K, V] {
+	if h.left == nil {
+		return nil
+	}
+	if !isRed(h.left) && !isRed(h.left.left) {
+		h = moveRedLeft(h)
+	}
+	h.left = deleteMin(h.left)
+	return fixUp(h)
+}
 
-		// save node if found
-		if cmp == 0 {
-			found = node
+// Search searches for a key in the redBlackTree, returns nil if key is not in the tree.
+func (t *redBlackTree[K, V]) Search(key K) *redBlackNode[K, V] {
+	n := t.root
+	for n != nil {
+		cmp := t.compare(key, n.key)
+		if cmp < 0 {
+			n = n.left
+		} else if cmp > 0 {
+			n = n.right
+		} else {
+			return n
 		}
+	}
+	return nil
+}
 
-		// pretend to push red node down
-		if !isRed(node) && !isRed(node.Child(dir)) {
-			if isRed(node.Child(!dir)) {
-				sr := singleRotate(node, dir)
-				parent.setChild(last, sr)
-				parent = sr
-			} else {
-				sibling := parent.Child(!last)
-				if sibling != nil {
-					if !isRed(sibling.Child(!last)) && !isRed(sibling.Child(last)) {
-						// flip colors
-						parent.red = false
-						sibling.red, node.red = true, true
-					} else {
-						dir2 := gparent.right == parent
-
-						if isRed(sibling.Child(last)) {
-							gparent.setChild(dir2, doubleRotate(parent, last))
-						} else if isRed(sibling.Child(!last)) {
-							gparent.setChild(dir2, singleRotate(parent, last))
-						}
-
-						gpc := gparent.Child(dir2)
-						gpc.red = true
-						node.red = true
-						gpc.left.red, gpc.right.red = false, false
-					}
-				}
+// 小于等于 key 的最大节点，inclusive 为 false 时为小于 key 的最大节点，不存在时返回 nil
+func (t *redBlackTree[K, V]) Floor(key K, inclusive bool) (floor *redBlackNode[K, V]) {
+	n := t.root
+	for n != nil {
+		cmp := t.compare(key, n.key)
+		if cmp > 0 || cmp == 0 && inclusive {
+			floor = n
+			if cmp == 0 {
+				return
 			}
+			n = n.right
+		} else {
+			n = n.left
 		}
 	}
+	return
+}
 
-	// get rid of node if we've found one
-	if found != nil {
-		found.item = node.item
-		parent.setChild(parent.right == node, node.Child(node.left == nil))
-		if found == t.min {
-			t.min = parent
-			if parent == head {
-				t.min = head.right
-			}
-		} else if found == t.max {
-			t.max = parent
-			if parent == head {
-				t.max = head.right
+// 大于等于 key 的最小节点，inclusive 为 false 时为大于 key 的最小节点，不存在时返回 nil
+func (t *redBlackTree[K, V]) Ceiling(key K, inclusive bool) (ceiling *redBlackNode[K, V]) {
+	n := t.root
+	for n != nil {
+		cmp := t.compare(key, n.key)
+		if cmp < 0 || cmp == 0 && inclusive {
+			ceiling = n
+			if cmp == 0 {
+				return
 			}
+			n = n.left
+		} else {
+			n = n.right
 		}
-		t.size--
 	}
+	return
+}
 
-	t.root = head.right
-	if t.root != nil {
-		t.root.red = false
+// 小于 key 的节点数
+func (t *redBlackTree[K, V]) Rank(key K) (rank int) {
+	n := t.root
+	for n != nil {
+		cmp := t.compare(key, n.key)
+		if cmp <= 0 {
+			n = n.left
+		} else {
+			rank += 1 + n.left.Size()
+			n = n.right
+		}
 	}
-
-	return found != nil
+	return
 }
 
-func (t *redBlackTree) search(n *redBlackNode, item Item) (Item, bool) {
-	cmp := t.compare(n.item, item)
-	if cmp == 0 {
-		return n.item, true
-	} else if cmp < 0 {
-		if n.left != nil {
-			return t.search(n.left, item)
+// 第 i 个节点，从 0 开始，超出范围时返回 nil
+func (t *redBlackTree[K, V]) Select(i int) *redBlackNode[K, V] {
+	n := t.root
+	for n != nil {
+		ls := n.left.Size()
+		if i < ls {
+			n = n.left
+		} else if i > ls {
+			i -= ls + 1
+			n = n.right
+		} else {
+			return n
 		}
-	} else if n.right != nil {
-		return t.search(n.right, item)
 	}
-	return nil, false
+	return nil
+}
+
+// 按顺序遍历所有节点
+func (t *redBlackTree[K, V]) Each(reverse bool, p func(n *redBlackNode[K, V]) bool) {
+	t.each(t.root, reverse, p)
 }
 
-// Search searches for a value in the redBlackTree, returns the string and true
-// if found or the empty string and false if val is not in the tree.
-func (t *redBlackTree) Search(item Item) (Item, bool) {
-	if t.root == nil {
-		return nil, false
+func (t *redBlackTree[K, V]) each(n *redBlackNode[K, V], reverse bool, p func(n *redBlackNode[K, V]) bool) bool {
+	if n == nil {
+		return true
 	}
-	return t.search(t.root, item)
+	return t.each(n.Child(reverse), reverse, p) && p(n) && t.each(n.Child(!reverse), reverse, p)
 }
 
-func (t *redBlackTree) VisitAscend(from Item, p ItemVisitor) {
+// 升序遍历大于等于 from 的节点
+func (t *redBlackTree[K, V]) VisitAscend(from K, p func(n *redBlackNode[K, V]) bool) {
 	t.visitAscend(t.root, from, p)
 }
 
-func (t *redBlackTree) visitAscend(node *redBlackNode, item Item, p ItemVisitor) bool {
+func (t *redBlackTree[K, V]) visitAscend(node *redBlackNode[K, V], from K, p func(n *redBlackNode[K, V]) bool) bool {
 	if node == nil {
 		return true
 	}
-
-	cmp := t.compare(node.item, item)
-	// skip left branch when all its values are smaller than val
-	if cmp >= 0 {
-		b := t.visitAscend(node.left, item, p)
-		if !b {
-			return false
-		}
-	}
-
+	cmp := t.compare(node.key, from)
+	// skip left branch when all its keys are smaller than from
 	if cmp >= 0 {
-		b := p(node.item)
-		if !b {
+		if !t.visitAscend(node.left, from, p) || !p(node) {
 			return false
 		}
 	}
-
-	b := t.visitAscend(node.right, item, p)
-	if !b {
-		return false
-	}
-	return true
+	return t.visitAscend(node.right, from, p)
 }
 
-func (t *redBlackTree) VisitDescend(to Item, p ItemVisitor) {
-	t.visitAscend(t.root, to, p)
+// 降序遍历小于等于 to 的节点
+func (t *redBlackTree[K, V]) VisitDescend(to K, p func(n *redBlackNode[K, V]) bool) {
+	t.visitDescend(t.root, to, p)
 }
 
-func (t *redBlackTree) visitDescend(node *redBlackNode, item Item, p ItemVisitor) bool {
+func (t *redBlackTree[K, V]) visitDescend(node *redBlackNode[K, V], to K, p func(n *redBlackNode[K, V]) bool) bool {
 	if node == nil {
 		return true
 	}
-
-	cmp := t.compare(node.item, item)
-	// skip left branch when all its values are smaller than val
+	cmp := t.compare(node.key, to)
+	// skip right branch when all its keys are greater than to
 	if cmp <= 0 {
-		b := t.visitDescend(node.right, item, p)
-		if !b {
+		if !t.visitDescend(node.right, to, p) || !p(node) {
 			return false
 		}
 	}
+	return t.visitDescend(node.left, to, p)
+}
 
-	if cmp <= 0 {
-		b := p(node.item)
-		if !b {
-			return false
-		}
+// 以 Item 为元素的红黑树，保持原有接口，新代码应使用 TreeMapOf
+type RedBlackTree struct {
+	t *redBlackTree[interface{}, struct{}]
+}
+
+func NewRedBlackTree(compare Compare) *RedBlackTree {
+	return &RedBlackTree{t: newRedBlackTree[interface{}, struct{}](compare)}
+}
+
+// Size returns the number of nodes in the RedBlackTree
+func (t *RedBlackTree) Size() int {
+	return t.t.Size()
+}
+
+// 空树时返回 nil
+func (t *RedBlackTree) Min() Item {
+	if n := t.t.Min(); n != nil {
+		return n.key
 	}
+	return nil
+}
 
-	b := t.visitDescend(node.left, item, p)
-	if !b {
-		return false
+// 空树时返回 nil
+func (t *RedBlackTree) Max() Item {
+	if n := t.t.Max(); n != nil {
+		return n.key
 	}
-	return true
+	return nil
+}
+
+// Insert inserts an item into the tree
+// Returns true on succesful insertion, false if duplicate exists and the item is replaced
+func (t *RedBlackTree) Insert(item Item) bool {
+	return t.t.Insert(item, struct{}{})
+}
+
+// Delete removes an item from the tree
+// Returns true on succesful deletion, false if item is not in tree
+func (t *RedBlackTree) Delete(item Item) bool {
+	return t.t.Delete(item)
+}
+
+// Search searches for an item in the tree, returns the stored item and true
+// if found or nil and false if item is not in the tree.
+func (t *RedBlackTree) Search(item Item) (Item, bool) {
+	if n := t.t.Search(item); n != nil {
+		return n.key, true
+	}
+	return nil, false
+}
+
+// 升序遍历大于等于 from 的元素
+func (t *RedBlackTree) VisitAscend(from Item, p ItemVisitor) {
+	t.t.VisitAscend(from, func(n *redBlackNode[interface{}, struct{}]) bool {
+		return p(n.key)
+	})
+}
+
+// 降序遍历小于等于 to 的元素
+func (t *RedBlackTree) VisitDescend(to Item, p ItemVisitor) {
+	t.t.VisitDescend(to, func(n *redBlackNode[interface{}, struct{}]) bool {
+		return p(n.key)
+	})
 }
@@ -0,0 +1,383 @@
+package sortedmap
+
+import (
+	"cmp"
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+const skipListMaxLevel = 32
+
+// 并发跳表，读取及遍历不加锁，写入只锁定相关的前驱节点
+// 算法参见 A Simple Optimistic Skiplist Algorithm (Herlihy, Lev, Luchangco, Shavit)
+type skipList[K any, V any] struct {
+	compare func(a, b K) int
+	head    *skipNode[K, V]
+	size    atomic.Int64
+}
+
+type skipNode[K any, V any] struct {
+	key   K
+	value atomic.Pointer[V]
+	next  []atomic.Pointer[skipNode[K, V]]
+	mutex sync.Mutex
+	// 已逻辑删除
+	marked atomic.Bool
+	// 已在所有层中链接
+	fullyLinked atomic.Bool
+}
+
+func newSkipList[K any, V any](compare func(a, b K) int) *skipList[K, V] {
+	return &skipList[K, V]{
+		compare: compare,
+		head:    &skipNode[K, V]{next: make([]atomic.Pointer[skipNode[K, V]], skipListMaxLevel)},
+	}
+}
+
+func (n *skipNode[K, V]) topLevel() int {
+	return len(n.next) - 1
+}
+
+// 节点存在且未被删除
+func (n *skipNode[K, V]) valid() bool {
+	return n.fullyLinked.Load() && !n.marked.Load()
+}
+
+func skipListRandomLevel() int {
+	level := 0
+	for level < skipListMaxLevel-1 && rand.Int63()&3 == 0 {
+		level++
+	}
+	return level
+}
+
+// 查找各层中 key 的前驱及后继，返回 key 所在的最高层，不存在时返回 -1
+func (l *skipList[K, V]) find(key K, preds, succs *[skipListMaxLevel]*skipNode[K, V]) int {
+	found := -1
+	pred := l.head
+	for level := skipListMaxLevel - 1; level >= 0; level-- {
+		curr := pred.next[level].Load()
+		for curr != nil && l.compare(curr.key, key) < 0 {
+			pred = curr
+			curr = pred.next[level].Load()
+		}
+		if found == -1 && curr != nil && l.compare(curr.key, key) == 0 {
+			found = level
+		}
+		preds[level] = pred
+		succs[level] = curr
+	}
+	return found
+}
+
+// 逐层锁定前驱节点并校验，返回已锁定的最高层
+func lockPreds[K any, V any](preds *[skipListMaxLevel]*skipNode[K, V], topLevel int, valid func(level int) bool) (int, bool) {
+	for level := 0; level <= topLevel; level++ {
+		if level == 0 || preds[level] != preds[level-1] {
+			preds[level].mutex.Lock()
+		}
+		if !valid(level) {
+			return level, false
+		}
+	}
+	return topLevel, true
+}
+
+func unlockPreds[K any, V any](preds *[skipListMaxLevel]*skipNode[K, V], highest int) {
+	for level := 0; level <= highest; level++ {
+		if level == 0 || preds[level] != preds[level-1] {
+			preds[level].mutex.Unlock()
+		}
+	}
+}
+
+// key 不存在时插入并返回 true，否则替换原值并返回 false
+func (l *skipList[K, V]) put(key K, value V) bool {
+	var preds, succs [skipListMaxLevel]*skipNode[K, V]
+	topLevel := skipListRandomLevel()
+	for {
+		if found := l.find(key, &preds, &succs); found != -1 {
+			n := succs[found]
+			if !n.marked.Load() {
+				for !n.fullyLinked.Load() {
+					runtime.Gosched()
+				}
+				n.value.Store(&value)
+				return false
+			}
+			// 正在被删除，重试
+			continue
+		}
+		highest, ok := lockPreds(&preds, topLevel, func(level int) bool {
+			pred, succ := preds[level], succs[level]
+			return !pred.marked.Load() && (succ == nil || !succ.marked.Load()) && pred.next[level].Load() == succ
+		})
+		if !ok {
+			unlockPreds(&preds, highest)
+			continue
+		}
+		n := &skipNode[K, V]{key: key, next: make([]atomic.Pointer[skipNode[K, V]], topLevel+1)}
+		n.value.Store(&value)
+		for level := 0; level <= topLevel; level++ {
+			n.next[level].Store(succs[level])
+		}
+		for level := 0; level <= topLevel; level++ {
+			preds[level].next[level].Store(n)
+		}
+		n.fullyLinked.Store(true)
+		unlockPreds(&preds, highest)
+		l.size.Add(1)
+		return true
+	}
+}
+
+// 删除 key，返回被删除的节点，不存在时返回 nil
+func (l *skipList[K, V]) delete(key K) *skipNode[K, V] {
+	var preds, succs [skipListMaxLevel]*skipNode[K, V]
+	var victim *skipNode[K, V]
+	for {
+		found := l.find(key, &preds, &succs)
+		if victim == nil {
+			if found == -1 {
+				return nil
+			}
+			n := succs[found]
+			if !n.fullyLinked.Load() || n.topLevel() != found || n.marked.Load() {
+				return nil
+			}
+			n.mutex.Lock()
+			if n.marked.Load() {
+				n.mutex.Unlock()
+				return nil
+			}
+			n.marked.Store(true)
+			victim = n
+		}
+		topLevel := victim.topLevel()
+		highest, ok := lockPreds(&preds, topLevel, func(level int) bool {
+			pred := preds[level]
+			return !pred.marked.Load() && pred.next[level].Load() == victim
+		})
+		if !ok {
+			unlockPreds(&preds, highest)
+			continue
+		}
+		for level := topLevel; level >= 0; level-- {
+			preds[level].next[level].Store(victim.next[level].Load())
+		}
+		victim.mutex.Unlock()
+		unlockPreds(&preds, highest)
+		l.size.Add(-1)
+		return victim
+	}
+}
+
+func (l *skipList[K, V]) get(key K) *skipNode[K, V] {
+	var preds, succs [skipListMaxLevel]*skipNode[K, V]
+	if found := l.find(key, &preds, &succs); found != -1 && succs[found].valid() {
+		return succs[found]
+	}
+	return nil
+}
+
+// 大于等于 key 的第一个有效节点
+func (l *skipList[K, V]) ceiling(key K) *skipNode[K, V] {
+	pred := l.head
+	var curr *skipNode[K, V]
+	for level := skipListMaxLevel - 1; level >= 0; level-- {
+		curr = pred.next[level].Load()
+		for curr != nil && l.compare(curr.key, key) < 0 {
+			pred = curr
+			curr = pred.next[level].Load()
+		}
+	}
+	for curr != nil && !curr.valid() {
+		curr = curr.next[0].Load()
+	}
+	return curr
+}
+
+// 小于 key 的最后一个有效节点，key 为 nil 时为最后一个有效节点
+func (l *skipList[K, V]) lower(key *K) *skipNode[K, V] {
+	for {
+		pred := l.head
+		for level := skipListMaxLevel - 1; level >= 0; level-- {
+			curr := pred.next[level].Load()
+			for curr != nil && (key == nil || l.compare(curr.key, *key) < 0) {
+				pred = curr
+				curr = pred.next[level].Load()
+			}
+		}
+		if pred == l.head {
+			return nil
+		}
+		if pred.valid() {
+			return pred
+		}
+		key = &pred.key
+	}
+}
+
+func (l *skipList[K, V]) first() *skipNode[K, V] {
+	n := l.head.next[0].Load()
+	for n != nil && !n.valid() {
+		n = n.next[0].Load()
+	}
+	return n
+}
+
+// 遍历 from 到 to 之间的有效节点，包括 from 和 to，from 或 to 为 nil 时不限制
+// 遍历过程中可以修改，遍历开始后插入的节点可能不被访问到，删除的节点可能被访问到
+func (l *skipList[K, V]) fetchRange(from, to *K, reverse bool, visitor func(n *skipNode[K, V]) bool) {
+	if reverse {
+		// 单向链表，逆序时逐个查找前驱节点
+		var n *skipNode[K, V]
+		if to == nil {
+			n = l.lower(nil)
+		} else if n = l.get(*to); n == nil {
+			n = l.lower(to)
+		}
+		for n != nil && (from == nil || l.compare(n.key, *from) >= 0) {
+			if !visitor(n) {
+				return
+			}
+			n = l.lower(&n.key)
+		}
+		return
+	}
+	var n *skipNode[K, V]
+	if from == nil {
+		n = l.first()
+	} else {
+		n = l.ceiling(*from)
+	}
+	for n != nil && (to == nil || l.compare(n.key, *to) <= 0) {
+		if n.valid() && !visitor(n) {
+			return
+		}
+		n = n.next[0].Load()
+	}
+}
+
+func (n *skipNode[K, V]) entry() *Entry[K, V] {
+	if n == nil {
+		return nil
+	}
+	return &Entry[K, V]{Key: n.key, Value: *n.value.Load()}
+}
+
+// 类型安全的并发跳表有序 map，读取不加锁，写入只锁定相关节点，适合读写并发较高的场景
+type SkipListMapOf[K any, V any] struct {
+	list atomic.Pointer[skipList[K, V]]
+}
+
+// 使用 cmp.Compare 比较 key
+func NewSkipListMapOf[K cmp.Ordered, V any]() *SkipListMapOf[K, V] {
+	return NewSkipListMapFunc[K, V](cmp.Compare[K])
+}
+
+// 使用指定的比较函数，a < b 返回负数，a == b 返回 0，a > b 返回正数
+func NewSkipListMapFunc[K any, V any](compare func(a, b K) int) *SkipListMapOf[K, V] {
+	m := &SkipListMapOf[K, V]{}
+	m.list.Store(newSkipList[K, V](compare))
+	return m
+}
+
+// key 不存在时返回 true，否则替换原值并返回 false
+func (m *SkipListMapOf[K, V]) Put(key K, value V) bool {
+	return m.list.Load().put(key, value)
+}
+
+func (m *SkipListMapOf[K, V]) Delete(key K) bool {
+	return m.list.Load().delete(key) != nil
+}
+
+func (m *SkipListMapOf[K, V]) Get(key K, defaultValue ...V) (V, bool) {
+	if n := m.list.Load().get(key); n != nil {
+		return *n.value.Load(), true
+	}
+	if len(defaultValue) > 0 {
+		return defaultValue[0], false
+	}
+	var v V
+	return v, false
+}
+
+func (m *SkipListMapOf[K, V]) GetValue(key K, defaultValue ...V) V {
+	v, _ := m.Get(key, defaultValue...)
+	return v
+}
+
+func (m *SkipListMapOf[K, V]) Has(key K) bool {
+	return m.list.Load().get(key) != nil
+}
+
+func (m *SkipListMapOf[K, V]) Len() int {
+	return int(m.list.Load().size.Load())
+}
+
+func (m *SkipListMapOf[K, V]) Clear() {
+	m.list.Store(newSkipList[K, V](m.list.Load().compare))
+}
+
+func (m *SkipListMapOf[K, V]) Keys() []K {
+	keys := make([]K, 0, m.Len())
+	m.Fetch(func(key K, value V) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+func (m *SkipListMapOf[K, V]) Values() []V {
+	vals := make([]V, 0, m.Len())
+	m.Fetch(func(key K, value V) bool {
+		vals = append(vals, value)
+		return true
+	})
+	return vals
+}
+
+// 为空时返回 nil
+func (m *SkipListMapOf[K, V]) FirstItem() *Entry[K, V] {
+	return m.list.Load().first().entry()
+}
+
+// 为空时返回 nil
+func (m *SkipListMapOf[K, V]) LastItem() *Entry[K, V] {
+	return m.list.Load().lower(nil).entry()
+}
+
+// 删除并返回第一项，为空时返回 nil
+func (m *SkipListMapOf[K, V]) PopFirst() *Entry[K, V] {
+	l := m.list.Load()
+	for {
+		n := l.first()
+		if n == nil {
+			return nil
+		}
+		// 被其它协程删除时重试，删除的可能是同一 key 重新插入的节点，同样返回
+		if v := l.delete(n.key); v != nil {
+			return v.entry()
+		}
+	}
+}
+
+// 按 key 升序遍历，p 返回 false 时结束，p 中可以修改 map
+func (m *SkipListMapOf[K, V]) Fetch(p func(key K, value V) bool) {
+	m.FetchRange(nil, nil, p, false)
+}
+
+// 按 key 降序遍历，p 返回 false 时结束，p 中可以修改 map，逆序遍历每项需要 O(log n) 查找
+func (m *SkipListMapOf[K, V]) FetchReverse(p func(key K, value V) bool) {
+	m.FetchRange(nil, nil, p, true)
+}
+
+// 遍历 from 到 to 之间的数据，包括 from 和 to，from 或 to 为 nil 时不限制，p 中可以修改 map
+func (m *SkipListMapOf[K, V]) FetchRange(from, to *K, p func(key K, value V) bool, reverse bool) {
+	m.list.Load().fetchRange(from, to, reverse, func(n *skipNode[K, V]) bool {
+		return p(n.key, *n.value.Load())
+	})
+}
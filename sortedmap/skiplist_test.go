@@ -0,0 +1,212 @@
+package sortedmap_test
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wecisecode/util/sortedmap"
+)
+
+func TestSkipListMapOf(t *testing.T) {
+	testMapOf(t, sortedmap.NewSkipListMapOf[int, string]())
+
+	m := sortedmap.NewSkipListMapOf[int, int]()
+	for i := 0; i < 10; i++ {
+		m.Put(i, i)
+	}
+	// 遍历时修改
+	m.Fetch(func(key int, value int) bool {
+		m.Delete(key + 1)
+		return true
+	})
+	assert.Equal(t, []int{0, 2, 4, 6, 8}, m.Keys())
+	assert.Equal(t, 0, m.PopFirst().Key)
+	m.Clear()
+	assert.Equal(t, 0, m.Len())
+	assert.Nil(t, m.PopFirst())
+}
+
+func TestSkipListMapConcurrent(t *testing.T) {
+	m := sortedmap.NewSkipListMapOf[int, int]()
+	var wg sync.WaitGroup
+	var puts, deletes atomic.Int64
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(g)))
+			for i := 0; i < 5000; i++ {
+				k := r.Intn(1000)
+				switch r.Intn(4) {
+				case 0:
+					if m.Delete(k) {
+						deletes.Add(1)
+					}
+				case 1:
+					// 并发遍历保持有序
+					last := -1
+					m.FetchRange(&k, nil, func(key int, value int) bool {
+						assert.Less(t, last, key)
+						assert.Equal(t, key, value)
+						last = key
+						return key < k+50
+					}, false)
+				default:
+					if m.Put(k, k) {
+						puts.Add(1)
+					}
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	keys := m.Keys()
+	assert.Equal(t, int(puts.Load()-deletes.Load()), len(keys))
+	assert.Equal(t, len(keys), m.Len())
+	for i := 1; i < len(keys); i++ {
+		assert.Less(t, keys[i-1], keys[i])
+	}
+
+	// 并发取出，每项只被取出一次
+	var popped atomic.Int64
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for m.PopFirst() != nil {
+				popped.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(len(keys)), popped.Load())
+	assert.Equal(t, 0, m.Len())
+}
+
+// 同一 key 并发删除及重新插入时，PopFirst 删除的项都被返回
+func TestSkipListMapPopFirstReinsert(t *testing.T) {
+	m := sortedmap.NewSkipListMapOf[int, int]()
+	var inserted, removed atomic.Int64
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 5000; i++ {
+				k := i % 4
+				if m.Delete(k) {
+					removed.Add(1)
+				}
+				if m.Put(k, i) {
+					inserted.Add(1)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 5000; i++ {
+				if m.PopFirst() != nil {
+					removed.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, inserted.Load()-removed.Load(), int64(m.Len()))
+}
+
+func TestSkipListMap(t *testing.T) {
+	m := sortedmap.NewSkipListMap()
+	m.PutAll(map[interface{}]interface{}{"b": 2, "a": 1, "c": 3})
+	assert.Equal(t, []interface{}{"a", "b", "c"}, m.Keys())
+	assert.Equal(t, "a", m.FirstItem().Key)
+	assert.Equal(t, "c", m.LastItem().Key)
+	keys := []interface{}{}
+	m.FetchRange("b", nil, func(key interface{}, value interface{}) bool {
+		keys = append(keys, key)
+		return true
+	}, true)
+	assert.Equal(t, []interface{}{"c", "b"}, keys)
+	bs, err := m.MarshalJSON()
+	assert.Nil(t, err)
+	sm := sortedmap.NewSkipListMap()
+	assert.Nil(t, sm.UnmarshalJSON(bs))
+	assert.Equal(t, m.Keys(), sm.Keys())
+	assert.Equal(t, 3, m.Copy().Len())
+}
+
+type timeoutQueue interface {
+	Put(key int64, value func()) bool
+	FirstItem() *sortedmap.Entry[int64, func()]
+	PopFirst() *sortedmap.Entry[int64, func()]
+}
+
+// 模拟 mtimer 超时队列，多协程添加定时项、检查队首及取出到期项
+func benchmarkTimeoutQueue(b *testing.B, q timeoutQueue) {
+	var seq atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		r := rand.New(rand.NewSource(seq.Add(1)))
+		for pb.Next() {
+			switch r.Intn(10) {
+			case 0, 1:
+				q.Put(seq.Add(1)<<16|r.Int63n(1<<16), nil)
+			case 2:
+				q.PopFirst()
+			default:
+				q.FirstItem()
+			}
+		}
+	})
+}
+
+func BenchmarkSkipListMapOf(b *testing.B) {
+	benchmarkTimeoutQueue(b, sortedmap.NewSkipListMapOf[int64, func()]())
+}
+
+func BenchmarkTreeMapOf(b *testing.B) {
+	benchmarkTimeoutQueue(b, sortedmap.NewTreeMapOf[int64, func()]())
+}
+
+func BenchmarkTreapMapOf(b *testing.B) {
+	benchmarkTimeoutQueue(b, sortedmap.NewTreapMapOf[int64, func()]())
+}
+
+type randomAccessMap interface {
+	Put(key int64, value func()) bool
+	Get(key int64, defaultValue ...func()) (func(), bool)
+	Delete(key int64) bool
+}
+
+// 随机 key 读多写少
+func benchmarkReadMostly(b *testing.B, m randomAccessMap) {
+	for i := int64(0); i < 100000; i++ {
+		m.Put(i*2, nil)
+	}
+	var seq atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		r := rand.New(rand.NewSource(seq.Add(1)))
+		for pb.Next() {
+			k := r.Int63n(200000)
+			switch r.Intn(20) {
+			case 0:
+				m.Put(k, nil)
+			case 1:
+				m.Delete(k)
+			default:
+				m.Get(k)
+			}
+		}
+	})
+}
+
+func BenchmarkSkipListMapOfReadMostly(b *testing.B) {
+	benchmarkReadMostly(b, sortedmap.NewSkipListMapOf[int64, func()]())
+}
+
+func BenchmarkTreeMapOfReadMostly(b *testing.B) {
+	benchmarkReadMostly(b, sortedmap.NewTreeMapOf[int64, func()]())
+}
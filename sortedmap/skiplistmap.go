@@ -0,0 +1,77 @@
+package sortedmap
+
+import (
+	"encoding/json"
+)
+
+// 基于并发跳表的 SortedMap，读取不加锁，写入只锁定相关节点
+// 遍历不持有锁，遍历过程中可以修改，遍历开始后的修改不一定可见
+type SkipListMap struct {
+	*SkipListMapOf[interface{}, interface{}]
+}
+
+var _ SortedMap = &SkipListMap{}
+
+func NewSkipListMap() *SkipListMap {
+	return &SkipListMap{NewSkipListMapFunc[interface{}, interface{}](KeyCompare)}
+}
+
+func (m *SkipListMap) PutAll(amap interface{}) SortedMap {
+	if sm, ok := amap.(SortedMap); ok {
+		Merge(m, sm)
+	} else {
+		MergeMap(m, amap)
+	}
+	return m
+}
+
+func (m *SkipListMap) Copy() SortedMap {
+	sm := NewSkipListMap()
+	Merge(sm, m)
+	return sm
+}
+
+func (m *SkipListMap) DeepCopy() SortedMap {
+	sm := NewSkipListMap()
+	DeepMerge(sm, m, true)
+	return sm
+}
+
+func (m *SkipListMap) FirstItem() *MapItem {
+	return mapItem(m.SkipListMapOf.FirstItem())
+}
+
+func (m *SkipListMap) LastItem() *MapItem {
+	return mapItem(m.SkipListMapOf.LastItem())
+}
+
+// 删除并返回第一项，为空时返回 nil
+func (m *SkipListMap) PopFirst() *MapItem {
+	return mapItem(m.SkipListMapOf.PopFirst())
+}
+
+func mapItem(e *Entry[interface{}, interface{}]) *MapItem {
+	if e == nil {
+		return nil
+	}
+	return &MapItem{Key: e.Key, Value: e.Value}
+}
+
+func (m *SkipListMap) FetchRange(from interface{}, to interface{}, p func(key interface{}, value interface{}) bool, reverse bool) {
+	pfrom, pto := rangeBounds(from, to)
+	m.SkipListMapOf.FetchRange(pfrom, pto, p, reverse)
+}
+
+func (m *SkipListMap) UnmarshalJSON(bs []byte) (err error) {
+	err = UnmarshalJSON(m, bs)
+	return
+}
+
+func (m *SkipListMap) MarshalJSON() ([]byte, error) {
+	return MarshalJSON(m)
+}
+
+func (m *SkipListMap) String() string {
+	bs, _ := json.MarshalIndent(m, "", "    ")
+	return string(bs)
+}
@@ -1,22 +1,39 @@
 package sortedmap
 
-type Treap struct {
-	compare Compare
-	root    *Node
+// 不可变 treap，Upsert Delete 返回新的 treap，未修改的节点在新旧版本间共享
+type treap[K any, V any] struct {
+	compare func(a, b K) int
+	root    *treapNode[K, V]
 }
 
-type Node struct {
-	item     Item
+type treapNode[K any, V any] struct {
+	key      K
+	value    V
 	priority int
-	left     *Node
-	right    *Node
+	left     *treapNode[K, V]
+	right    *treapNode[K, V]
+	// 子树节点数
+	size int
 }
 
-func NewTreap(c Compare) *Treap {
-	return &Treap{compare: c, root: nil}
+func newTreapNode[K any, V any](key K, value V, priority int, left, right *treapNode[K, V]) *treapNode[K, V] {
+	return &treapNode[K, V]{key: key, value: value, priority: priority, left: left, right: right,
+		size: 1 + left.Size() + right.Size()}
 }
 
-func (t *Treap) Min() Item {
+// 子树节点数，nil 为 0
+func (n *treapNode[K, V]) Size() int {
+	if n == nil {
+		return 0
+	}
+	return n.size
+}
+
+func newTreap[K any, V any](compare func(a, b K) int) *treap[K, V] {
+	return &treap[K, V]{compare: compare}
+}
+
+func (t *treap[K, V]) min() *treapNode[K, V] {
 	n := t.root
 	if n == nil {
 		return nil
@@ -24,10 +41,10 @@ func (t *Treap) Min() Item {
 	for n.left != nil {
 		n = n.left
 	}
-	return n.item
+	return n
 }
 
-func (t *Treap) Max() Item {
+func (t *treap[K, V]) max() *treapNode[K, V] {
 	n := t.root
 	if n == nil {
 		return nil
@@ -35,19 +52,19 @@ func (t *Treap) Max() Item {
 	for n.right != nil {
 		n = n.right
 	}
-	return n.item
+	return n
 }
 
-func (t *Treap) Get(target Item) Item {
+func (t *treap[K, V]) get(key K) *treapNode[K, V] {
 	n := t.root
 	for n != nil {
-		c := t.compare(target, n.item)
+		c := t.compare(key, n.key)
 		if c < 0 {
 			n = n.left
 		} else if c > 0 {
 			n = n.right
 		} else {
-			return n.item
+			return n
 		}
 	}
 	return nil
@@ -57,12 +74,12 @@ func (t *Treap) Get(target Item) Item {
 // Priorities from future updates on already existing items are
 // ignored.  To change the priority for an item, you need to do a
 // Delete then an Upsert.
-func (t *Treap) Upsert(item Item, itemPriority int) *Treap {
-	r := t.union(t.root, &Node{item: item, priority: itemPriority})
-	return &Treap{compare: t.compare, root: r}
+func (t *treap[K, V]) upsert(key K, value V, priority int) *treap[K, V] {
+	r := t.union(t.root, newTreapNode[K, V](key, value, priority, nil, nil))
+	return &treap[K, V]{compare: t.compare, root: r}
 }
 
-func (t *Treap) union(this *Node, that *Node) *Node {
+func (t *treap[K, V]) union(this *treapNode[K, V], that *treapNode[K, V]) *treapNode[K, V] {
 	if this == nil {
 		return that
 	}
@@ -70,71 +87,46 @@ func (t *Treap) union(this *Node, that *Node) *Node {
 		return this
 	}
 	if this.priority > that.priority {
-		left, middle, right := t.split(that, this.item)
+		left, middle, right := t.split(that, this.key)
 		if middle == nil {
-			return &Node{
-				item:     this.item,
-				priority: this.priority,
-				left:     t.union(this.left, left),
-				right:    t.union(this.right, right),
-			}
-		}
-		return &Node{
-			item:     middle.item,
-			priority: this.priority,
-			left:     t.union(this.left, left),
-			right:    t.union(this.right, right),
+			return newTreapNode(this.key, this.value, this.priority, t.union(this.left, left), t.union(this.right, right))
 		}
+		return newTreapNode(middle.key, middle.value, this.priority, t.union(this.left, left), t.union(this.right, right))
 	}
 	// We don't use middle because the "that" has precendence.
-	left, _, right := t.split(this, that.item)
-	return &Node{
-		item:     that.item,
-		priority: that.priority,
-		left:     t.union(left, that.left),
-		right:    t.union(right, that.right),
-	}
+	left, _, right := t.split(this, that.key)
+	return newTreapNode(that.key, that.value, that.priority, t.union(left, that.left), t.union(right, that.right))
 }
 
-// Splits a treap into two treaps based on a split item "s".
+// Splits a treap into two treaps based on a split key "s".
 // The result tuple-3 means (left, X, right), where X is either...
-// nil - meaning the item s was not in the original treap.
-// non-nil - returning the Node that had item s.
-// The tuple-3's left result treap has items < s,
-// and the tuple-3's right result treap has items > s.
-func (t *Treap) split(n *Node, s Item) (*Node, *Node, *Node) {
+// nil - meaning the key s was not in the original treap.
+// non-nil - returning the Node that had key s.
+// The tuple-3's left result treap has keys < s,
+// and the tuple-3's right result treap has keys > s.
+func (t *treap[K, V]) split(n *treapNode[K, V], s K) (*treapNode[K, V], *treapNode[K, V], *treapNode[K, V]) {
 	if n == nil {
 		return nil, nil, nil
 	}
-	c := t.compare(s, n.item)
+	c := t.compare(s, n.key)
 	if c == 0 {
 		return n.left, n, n.right
 	}
 	if c < 0 {
 		left, middle, right := t.split(n.left, s)
-		return left, middle, &Node{
-			item:     n.item,
-			priority: n.priority,
-			left:     right,
-			right:    n.right,
-		}
+		return left, middle, newTreapNode(n.key, n.value, n.priority, right, n.right)
 	}
 	left, middle, right := t.split(n.right, s)
-	return &Node{
-		item:     n.item,
-		priority: n.priority,
-		left:     n.left,
-		right:    left,
-	}, middle, right
+	return newTreapNode(n.key, n.value, n.priority, n.left, left), middle, right
 }
 
-func (t *Treap) Delete(target Item) *Treap {
-	left, _, right := t.split(t.root, target)
-	return &Treap{compare: t.compare, root: t.join(left, right)}
+func (t *treap[K, V]) delete(key K) *treap[K, V] {
+	left, _, right := t.split(t.root, key)
+	return &treap[K, V]{compare: t.compare, root: t.join(left, right)}
 }
 
-// All the items from this are < items from that.
-func (t *Treap) join(this *Node, that *Node) *Node {
+// All the keys from this are < keys from that.
+func (t *treap[K, V]) join(this *treapNode[K, V], that *treapNode[K, V]) *treapNode[K, V] {
 	if this == nil {
 		return that
 	}
@@ -142,55 +134,221 @@ func (t *Treap) join(this *Node, that *Node) *Node {
 		return this
 	}
 	if this.priority > that.priority {
-		return &Node{
-			item:     this.item,
-			priority: this.priority,
-			left:     this.left,
-			right:    t.join(this.right, that),
+		return newTreapNode(this.key, this.value, this.priority, this.left, t.join(this.right, that))
+	}
+	return newTreapNode(that.key, that.value, that.priority, t.join(this, that.left), that.right)
+}
+
+// 删除 from 到 to 之间的 key，包括 from 和 to，from 或 to 为 nil 时不限制，返回新的 treap 及删除的数量
+func (t *treap[K, V]) deleteRange(from, to *K) (*treap[K, V], int) {
+	if from != nil && to != nil && t.compare(*from, *to) > 0 {
+		return t, 0
+	}
+	var left, right *treapNode[K, V]
+	rest := t.root
+	if from != nil {
+		left, _, rest = t.split(rest, *from)
+	}
+	if to != nil {
+		_, _, right = t.split(rest, *to)
+	}
+	root := t.join(left, right)
+	return &treap[K, V]{compare: t.compare, root: root}, t.root.Size() - root.Size()
+}
+
+// 小于等于 key 的最大节点，inclusive 为 false 时为小于 key 的最大节点，不存在时返回 nil
+func (t *treap[K, V]) floor(key K, inclusive bool) (floor *treapNode[K, V]) {
+	n := t.root
+	for n != nil {
+		c := t.compare(key, n.key)
+		if c > 0 || c == 0 && inclusive {
+			floor = n
+			if c == 0 {
+				return
+			}
+			n = n.right
+		} else {
+			n = n.left
 		}
 	}
-	return &Node{
-		item:     that.item,
-		priority: that.priority,
-		left:     t.join(this, that.left),
-		right:    that.right,
+	return
+}
+
+// 大于等于 key 的最小节点，inclusive 为 false 时为大于 key 的最小节点，不存在时返回 nil
+func (t *treap[K, V]) ceiling(key K, inclusive bool) (ceiling *treapNode[K, V]) {
+	n := t.root
+	for n != nil {
+		c := t.compare(key, n.key)
+		if c < 0 || c == 0 && inclusive {
+			ceiling = n
+			if c == 0 {
+				return
+			}
+			n = n.left
+		} else {
+			n = n.right
+		}
 	}
+	return
 }
 
-// Visit items greater-than-or-equal to the pivot, in ascending order.
-func (t *Treap) VisitAscend(pivot Item, visitor ItemVisitor) {
-	t.visitAscend(t.root, pivot, visitor)
+// 小于 key 的节点数
+func (t *treap[K, V]) rank(key K) (rank int) {
+	n := t.root
+	for n != nil {
+		if t.compare(key, n.key) <= 0 {
+			n = n.left
+		} else {
+			rank += 1 + n.left.Size()
+			n = n.right
+		}
+	}
+	return
+}
+
+// 第 i 个节点，从 0 开始，超出范围时返回 nil
+func (t *treap[K, V]) selectAt(i int) *treapNode[K, V] {
+	n := t.root
+	for n != nil {
+		ls := n.left.Size()
+		if i < ls {
+			n = n.left
+		} else if i > ls {
+			i -= ls + 1
+			n = n.right
+		} else {
+			return n
+		}
+	}
+	return nil
+}
+
+// 按顺序遍历所有节点
+func (t *treap[K, V]) each(n *treapNode[K, V], reverse bool, visitor func(n *treapNode[K, V]) bool) bool {
+	if n == nil {
+		return true
+	}
+	first, second := n.left, n.right
+	if reverse {
+		first, second = second, first
+	}
+	return t.each(first, reverse, visitor) && visitor(n) && t.each(second, reverse, visitor)
+}
+
+// 遍历 from 到 to 之间的节点，包括 from 和 to，from 或 to 为 nil 时不限制
+func (t *treap[K, V]) fetchRange(from, to *K, reverse bool, visitor func(n *treapNode[K, V]) bool) {
+	if reverse {
+		visit := func(n *treapNode[K, V]) bool {
+			if from != nil && t.compare(n.key, *from) < 0 {
+				return false
+			}
+			return visitor(n)
+		}
+		if to == nil {
+			t.each(t.root, true, visit)
+		} else {
+			t.visitDescend(t.root, *to, visit)
+		}
+	} else {
+		visit := func(n *treapNode[K, V]) bool {
+			if to != nil && t.compare(n.key, *to) > 0 {
+				return false
+			}
+			return visitor(n)
+		}
+		if from == nil {
+			t.each(t.root, false, visit)
+		} else {
+			t.visitAscend(t.root, *from, visit)
+		}
+	}
 }
 
-func (t *Treap) visitAscend(n *Node, pivot Item, visitor ItemVisitor) bool {
+// Visit keys greater-than-or-equal to the pivot, in ascending order.
+func (t *treap[K, V]) visitAscend(n *treapNode[K, V], pivot K, visitor func(n *treapNode[K, V]) bool) bool {
 	if n == nil {
 		return true
 	}
-	c := t.compare(pivot, n.item)
+	c := t.compare(pivot, n.key)
 	if c < 0 && !t.visitAscend(n.left, pivot, visitor) {
 		return false
 	}
-	if c <= 0 && !visitor(n.item) {
+	if c <= 0 && !visitor(n) {
 		return false
 	}
 	return t.visitAscend(n.right, pivot, visitor)
 }
 
-// Visit items less-than-or-equal to the pivot, in descending order.
-func (t *Treap) VisitDescend(pivot Item, visitor ItemVisitor) {
-	t.visitDescend(t.root, pivot, visitor)
-}
-
-func (t *Treap) visitDescend(n *Node, pivot Item, visitor ItemVisitor) bool {
+// Visit keys less-than-or-equal to the pivot, in descending order.
+func (t *treap[K, V]) visitDescend(n *treapNode[K, V], pivot K, visitor func(n *treapNode[K, V]) bool) bool {
 	if n == nil {
 		return true
 	}
-	c := t.compare(pivot, n.item)
+	c := t.compare(pivot, n.key)
 	if c > 0 && !t.visitDescend(n.right, pivot, visitor) {
 		return false
 	}
-	if c >= 0 && !visitor(n.item) {
+	if c >= 0 && !visitor(n) {
 		return false
 	}
 	return t.visitDescend(n.left, pivot, visitor)
 }
+
+// 以 Item 为元素的不可变 treap
+type Treap struct {
+	t *treap[interface{}, struct{}]
+}
+
+// Treap 的节点，保持原有类型名
+type Node = treapNode[interface{}, struct{}]
+
+func NewTreap(c Compare) *Treap {
+	return &Treap{t: newTreap[interface{}, struct{}](c)}
+}
+
+func (t *Treap) Min() Item {
+	if n := t.t.min(); n != nil {
+		return n.key
+	}
+	return nil
+}
+
+func (t *Treap) Max() Item {
+	if n := t.t.max(); n != nil {
+		return n.key
+	}
+	return nil
+}
+
+func (t *Treap) Get(target Item) Item {
+	if n := t.t.get(target); n != nil {
+		return n.key
+	}
+	return nil
+}
+
+// Note: only the priority of the first insert of an item is used.
+// Priorities from future updates on already existing items are
+// ignored.  To change the priority for an item, you need to do a
+// Delete then an Upsert.
+func (t *Treap) Upsert(item Item, itemPriority int) *Treap {
+	return &Treap{t: t.t.upsert(item, struct{}{}, itemPriority)}
+}
+
+func (t *Treap) Delete(target Item) *Treap {
+	return &Treap{t: t.t.delete(target)}
+}
+
+// Visit items greater-than-or-equal to the pivot, in ascending order.
+func (t *Treap) VisitAscend(pivot Item, visitor ItemVisitor) {
+	t.t.visitAscend(t.t.root, pivot, func(n *Node) bool {
+		return visitor(n.key)
+	})
+}
+
+// Visit items less-than-or-equal to the pivot, in descending order.
+func (t *Treap) VisitDescend(pivot Item, visitor ItemVisitor) {
+	t.t.visitDescend(t.t.root, pivot, func(n *Node) bool {
+		return visitor(n.key)
+	})
+}
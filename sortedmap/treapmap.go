@@ -2,20 +2,21 @@ package sortedmap
 
 import (
 	"encoding/json"
+	"maps"
 	"math/rand"
 	"sync"
 )
 
 type TreapMap struct {
-	treap *Treap
+	treap *treap[interface{}, interface{}]
 	sync.RWMutex
 	mm map[interface{}]interface{}
 }
 
-var _ SortedMap = &TreapMap{}
+var _ NavigableMap = &TreapMap{}
 
 func NewTreapMap() *TreapMap {
-	return &TreapMap{treap: NewTreap(MapItemCompare), mm: map[interface{}]interface{}{}}
+	return &TreapMap{treap: newTreap[interface{}, interface{}](KeyCompare), mm: map[interface{}]interface{}{}}
 }
 
 func (m *TreapMap) PutAll(amap interface{}) SortedMap {
@@ -27,10 +28,11 @@ func (m *TreapMap) PutAll(amap interface{}) SortedMap {
 	return m
 }
 
+// 与原 map 共享不可变的 treap，只复制 key 索引
 func (m *TreapMap) Copy() SortedMap {
-	sm := NewTreapMap()
-	Merge(sm, m)
-	return sm
+	m.RLock()
+	defer m.RUnlock()
+	return &TreapMap{treap: m.treap, mm: maps.Clone(m.mm)}
 }
 
 func (m *TreapMap) DeepCopy() SortedMap {
@@ -40,19 +42,23 @@ func (m *TreapMap) DeepCopy() SortedMap {
 }
 
 func (m *TreapMap) FirstItem() *MapItem {
-	mi := m.treap.Min()
-	if mi == nil {
+	m.RLock()
+	defer m.RUnlock()
+	n := m.treap.min()
+	if n == nil {
 		return nil
 	}
-	return mi.(*MapItem)
+	return &MapItem{Key: n.key, Value: n.value}
 }
 
 func (m *TreapMap) LastItem() *MapItem {
-	mi := m.treap.Max()
-	if mi == nil {
+	m.RLock()
+	defer m.RUnlock()
+	n := m.treap.max()
+	if n == nil {
 		return nil
 	}
-	return mi.(*MapItem)
+	return &MapItem{Key: n.key, Value: n.value}
 }
 
 func (m *TreapMap) Get(key interface{}, defaultValue ...interface{}) (interface{}, bool) {
@@ -92,7 +98,7 @@ func (m *TreapMap) Put(key interface{}, value interface{}) bool {
 	m.Lock()
 	defer m.Unlock()
 	_, exist := m.mm[key]
-	m.treap = m.treap.Upsert(Item(&MapItem{key, value}), rand.Int())
+	m.treap = m.treap.upsert(key, value, rand.Int())
 	m.mm[key] = value
 	return !exist
 }
@@ -102,7 +108,7 @@ func (m *TreapMap) Delete(key interface{}) (didDeleted bool) {
 	defer m.Unlock()
 	_, didDeleted = m.mm[key]
 	if didDeleted {
-		m.treap = m.treap.Delete(key)
+		m.treap = m.treap.delete(key)
 		delete(m.mm, key)
 	}
 	return
@@ -111,7 +117,7 @@ func (m *TreapMap) Delete(key interface{}) (didDeleted bool) {
 func (m *TreapMap) Clear() {
 	m.Lock()
 	defer m.Unlock()
-	m.treap = NewTreap(MapItemCompare)
+	m.treap = newTreap[interface{}, interface{}](KeyCompare)
 	m.mm = map[interface{}]interface{}{}
 }
 
@@ -123,23 +129,19 @@ func (m *TreapMap) Len() int {
 
 func (m *TreapMap) Keys() []interface{} {
 	keys := []interface{}{}
-	m.treap.VisitAscend(m.treap.Min, func(i Item) bool {
-		if mi, ok := i.(*MapItem); ok {
-			keys = append(keys, mi.Key)
-		}
+	m.fetch(func(key, value interface{}) bool {
+		keys = append(keys, key)
 		return true
-	})
+	}, false)
 	return keys
 }
 
 func (m *TreapMap) Values() []interface{} {
 	vals := []interface{}{}
-	m.treap.VisitAscend(m.treap.Min, func(i Item) bool {
-		if mi, ok := i.(*MapItem); ok {
-			vals = append(vals, mi.Value)
-		}
+	m.fetch(func(key, value interface{}) bool {
+		vals = append(vals, value)
 		return true
-	})
+	}, false)
 	return vals
 }
 
@@ -151,58 +153,106 @@ func (m *TreapMap) FetchReverse(p func(key interface{}, value interface{}) bool)
 	m.fetch(p, true)
 }
 
+// treap 不可变，遍历获取到的版本时不需要加锁，p 中可以修改 map
+func (m *TreapMap) snapshot() *treap[interface{}, interface{}] {
+	m.RLock()
+	defer m.RUnlock()
+	return m.treap
+}
+
 func (m *TreapMap) fetch(p func(key interface{}, value interface{}) bool, reverse bool) {
-	if len(m.mm) == 0 {
-		return
+	t := m.snapshot()
+	t.each(t.root, reverse, func(n *treapNode[interface{}, interface{}]) bool {
+		return p(n.key, n.value)
+	})
+}
+
+func (m *TreapMap) FetchRange(from interface{}, to interface{}, p func(key interface{}, value interface{}) bool, reverse bool) {
+	pfrom, pto := rangeBounds(from, to)
+	m.snapshot().fetchRange(pfrom, pto, reverse, func(n *treapNode[interface{}, interface{}]) bool {
+		return p(n.key, n.value)
+	})
+}
+
+// nil 表示不限制
+func rangeBounds(from, to interface{}) (pfrom, pto *interface{}) {
+	if from != nil {
+		pfrom = &from
 	}
-	if reverse {
-		m.treap.VisitDescend(m.treap.Max, func(i Item) bool {
-			if mi, ok := i.(*MapItem); ok {
-				return p(mi.Key, mi.Value)
-			}
-			return true
-		})
-	} else {
-		m.treap.VisitAscend(m.treap.Min, func(i Item) bool {
-			if mi, ok := i.(*MapItem); ok {
-				return p(mi.Key, mi.Value)
-			}
-			return true
-		})
+	if to != nil {
+		pto = &to
 	}
+	return
 }
 
-func (m *TreapMap) FetchRange(from interface{}, to interface{}, p func(key interface{}, value interface{}) bool, reverse bool) {
-	if len(m.mm) == 0 {
-		return
+// 当前数据的不可变快照，代价为 O(1)
+func (m *TreapMap) Snapshot() *PersistentMap[interface{}, interface{}] {
+	return &PersistentMap[interface{}, interface{}]{treap: m.snapshot()}
+}
+
+func (m *TreapMap) item(n *treapNode[interface{}, interface{}]) *MapItem {
+	if n == nil {
+		return nil
 	}
-	if reverse {
-		if to == nil {
-			to = m.treap.Max()
-		}
-		m.treap.VisitDescend(to, func(i Item) bool {
-			if from != nil && m.treap.compare(i, from) < 0 {
-				return false
-			}
-			if mi, ok := i.(*MapItem); ok {
-				return p(mi.Key, mi.Value)
-			}
-			return true
-		})
-	} else {
-		if from == nil {
-			from = m.treap.Min()
-		}
-		m.treap.VisitAscend(from, func(i Item) bool {
-			if to != nil && m.treap.compare(i, to) > 0 {
-				return false
-			}
-			if mi, ok := i.(*MapItem); ok {
-				return p(mi.Key, mi.Value)
-			}
-			return true
-		})
+	return &MapItem{Key: n.key, Value: n.value}
+}
+
+func (m *TreapMap) Floor(key interface{}) *MapItem {
+	return m.item(m.snapshot().floor(key, true))
+}
+
+func (m *TreapMap) Ceiling(key interface{}) *MapItem {
+	return m.item(m.snapshot().ceiling(key, true))
+}
+
+func (m *TreapMap) Lower(key interface{}) *MapItem {
+	return m.item(m.snapshot().floor(key, false))
+}
+
+func (m *TreapMap) Higher(key interface{}) *MapItem {
+	return m.item(m.snapshot().ceiling(key, false))
+}
+
+func (m *TreapMap) Rank(key interface{}) int {
+	return m.snapshot().rank(key)
+}
+
+func (m *TreapMap) Select(i int) *MapItem {
+	return m.item(m.snapshot().selectAt(i))
+}
+
+func (m *TreapMap) PopFirst() *MapItem {
+	m.Lock()
+	defer m.Unlock()
+	return m.pop(m.treap.min())
+}
+
+func (m *TreapMap) PopLast() *MapItem {
+	m.Lock()
+	defer m.Unlock()
+	return m.pop(m.treap.max())
+}
+
+func (m *TreapMap) pop(n *treapNode[interface{}, interface{}]) *MapItem {
+	mi := m.item(n)
+	if mi != nil {
+		m.treap = m.treap.delete(mi.Key)
+		delete(m.mm, mi.Key)
 	}
+	return mi
+}
+
+func (m *TreapMap) DeleteRange(from interface{}, to interface{}) int {
+	m.Lock()
+	defer m.Unlock()
+	pfrom, pto := rangeBounds(from, to)
+	m.treap.fetchRange(pfrom, pto, false, func(n *treapNode[interface{}, interface{}]) bool {
+		delete(m.mm, n.key)
+		return true
+	})
+	var n int
+	m.treap, n = m.treap.deleteRange(pfrom, pto)
+	return n
 }
 
 func (m *TreapMap) UnmarshalJSON(bs []byte) (err error) {
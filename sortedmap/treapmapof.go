@@ -0,0 +1,210 @@
+package sortedmap
+
+import (
+	"cmp"
+	"math/rand"
+	"sync"
+)
+
+// 类型安全的 treap 有序 map
+// treap 不可变，遍历时只在开始时获取当前版本，遍历过程中可以修改 map
+type TreapMapOf[K any, V any] struct {
+	sync.RWMutex
+	treap *treap[K, V]
+}
+
+// 使用 cmp.Compare 比较 key
+func NewTreapMapOf[K cmp.Ordered, V any]() *TreapMapOf[K, V] {
+	return NewTreapMapFunc[K, V](cmp.Compare[K])
+}
+
+// 使用指定的比较函数，a < b 返回负数，a == b 返回 0，a > b 返回正数
+func NewTreapMapFunc[K any, V any](compare func(a, b K) int) *TreapMapOf[K, V] {
+	return &TreapMapOf[K, V]{treap: newTreap[K, V](compare)}
+}
+
+// 共享不可变的 treap，复制代价为 O(1)
+func (m *TreapMapOf[K, V]) Copy() *TreapMapOf[K, V] {
+	m.RLock()
+	defer m.RUnlock()
+	return &TreapMapOf[K, V]{treap: m.treap}
+}
+
+func (m *TreapMapOf[K, V]) snapshot() *treap[K, V] {
+	m.RLock()
+	defer m.RUnlock()
+	return m.treap
+}
+
+// 为空时返回 nil
+func (m *TreapMapOf[K, V]) FirstItem() *Entry[K, V] {
+	return m.snapshot().min().entry()
+}
+
+// 为空时返回 nil
+func (m *TreapMapOf[K, V]) LastItem() *Entry[K, V] {
+	return m.snapshot().max().entry()
+}
+
+func (n *treapNode[K, V]) entry() *Entry[K, V] {
+	if n == nil {
+		return nil
+	}
+	return &Entry[K, V]{Key: n.key, Value: n.value}
+}
+
+func (m *TreapMapOf[K, V]) Get(key K, defaultValue ...V) (V, bool) {
+	if n := m.snapshot().get(key); n != nil {
+		return n.value, true
+	}
+	if len(defaultValue) > 0 {
+		return defaultValue[0], false
+	}
+	var v V
+	return v, false
+}
+
+func (m *TreapMapOf[K, V]) GetValue(key K, defaultValue ...V) V {
+	v, _ := m.Get(key, defaultValue...)
+	return v
+}
+
+func (m *TreapMapOf[K, V]) Has(key K) bool {
+	return m.snapshot().get(key) != nil
+}
+
+// key 不存在时返回 true，否则替换原值并返回 false
+func (m *TreapMapOf[K, V]) Put(key K, value V) bool {
+	m.Lock()
+	defer m.Unlock()
+	exist := m.treap.get(key) != nil
+	m.treap = m.treap.upsert(key, value, rand.Int())
+	return !exist
+}
+
+func (m *TreapMapOf[K, V]) Delete(key K) bool {
+	m.Lock()
+	defer m.Unlock()
+	if m.treap.get(key) == nil {
+		return false
+	}
+	m.treap = m.treap.delete(key)
+	return true
+}
+
+func (m *TreapMapOf[K, V]) Clear() {
+	m.Lock()
+	defer m.Unlock()
+	m.treap = newTreap[K, V](m.treap.compare)
+}
+
+func (m *TreapMapOf[K, V]) Len() int {
+	return m.snapshot().root.Size()
+}
+
+func (m *TreapMapOf[K, V]) Keys() []K {
+	keys := []K{}
+	m.Fetch(func(key K, value V) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+func (m *TreapMapOf[K, V]) Values() []V {
+	vals := []V{}
+	m.Fetch(func(key K, value V) bool {
+		vals = append(vals, value)
+		return true
+	})
+	return vals
+}
+
+// 按 key 升序遍历，p 返回 false 时结束
+func (m *TreapMapOf[K, V]) Fetch(p func(key K, value V) bool) {
+	t := m.snapshot()
+	t.each(t.root, false, func(n *treapNode[K, V]) bool {
+		return p(n.key, n.value)
+	})
+}
+
+// 按 key 降序遍历，p 返回 false 时结束
+func (m *TreapMapOf[K, V]) FetchReverse(p func(key K, value V) bool) {
+	t := m.snapshot()
+	t.each(t.root, true, func(n *treapNode[K, V]) bool {
+		return p(n.key, n.value)
+	})
+}
+
+// 遍历 from 到 to 之间的数据，包括 from 和 to，from 或 to 为 nil 时不限制
+func (m *TreapMapOf[K, V]) FetchRange(from, to *K, p func(key K, value V) bool, reverse bool) {
+	m.snapshot().fetchRange(from, to, reverse, func(n *treapNode[K, V]) bool {
+		return p(n.key, n.value)
+	})
+}
+
+// 当前数据的不可变快照，代价为 O(1)
+func (m *TreapMapOf[K, V]) Snapshot() *PersistentMap[K, V] {
+	return &PersistentMap[K, V]{treap: m.snapshot()}
+}
+
+// 小于等于 key 的最大项，不存在时返回 nil
+func (m *TreapMapOf[K, V]) Floor(key K) *Entry[K, V] {
+	return m.snapshot().floor(key, true).entry()
+}
+
+// 大于等于 key 的最小项，不存在时返回 nil
+func (m *TreapMapOf[K, V]) Ceiling(key K) *Entry[K, V] {
+	return m.snapshot().ceiling(key, true).entry()
+}
+
+// 小于 key 的最大项，不存在时返回 nil
+func (m *TreapMapOf[K, V]) Lower(key K) *Entry[K, V] {
+	return m.snapshot().floor(key, false).entry()
+}
+
+// 大于 key 的最小项，不存在时返回 nil
+func (m *TreapMapOf[K, V]) Higher(key K) *Entry[K, V] {
+	return m.snapshot().ceiling(key, false).entry()
+}
+
+// 小于 key 的项数
+func (m *TreapMapOf[K, V]) Rank(key K) int {
+	return m.snapshot().rank(key)
+}
+
+// 按顺序的第 i 项，从 0 开始，超出范围时返回 nil
+func (m *TreapMapOf[K, V]) Select(i int) *Entry[K, V] {
+	return m.snapshot().selectAt(i).entry()
+}
+
+// 删除并返回第一项，为空时返回 nil
+func (m *TreapMapOf[K, V]) PopFirst() *Entry[K, V] {
+	m.Lock()
+	defer m.Unlock()
+	e := m.treap.min().entry()
+	if e != nil {
+		m.treap = m.treap.delete(e.Key)
+	}
+	return e
+}
+
+// 删除并返回最后一项，为空时返回 nil
+func (m *TreapMapOf[K, V]) PopLast() *Entry[K, V] {
+	m.Lock()
+	defer m.Unlock()
+	e := m.treap.max().entry()
+	if e != nil {
+		m.treap = m.treap.delete(e.Key)
+	}
+	return e
+}
+
+// 删除 from 到 to 之间的项，包括 from 和 to，from 或 to 为 nil 时不限制，返回删除的项数
+func (m *TreapMapOf[K, V]) DeleteRange(from, to *K) int {
+	m.Lock()
+	defer m.Unlock()
+	var n int
+	m.treap, n = m.treap.deleteRange(from, to)
+	return n
+}
@@ -7,14 +7,14 @@ import (
 
 type TreeMap struct {
 	sync.RWMutex
-	tree *redBlackTree
+	tree *redBlackTree[interface{}, interface{}]
 	mm   map[interface{}]interface{}
 }
 
-var _ SortedMap = &TreeMap{}
+var _ NavigableMap = &TreeMap{}
 
 func NewTreeMap() *TreeMap {
-	return &TreeMap{tree: NewRedBlackTree(MapItemCompare), mm: map[interface{}]interface{}{}}
+	return &TreeMap{tree: newRedBlackTree[interface{}, interface{}](KeyCompare), mm: map[interface{}]interface{}{}}
 }
 
 func (m *TreeMap) PutAll(amap interface{}) SortedMap {
@@ -39,19 +39,23 @@ func (m *TreeMap) DeepCopy() SortedMap {
 }
 
 func (m *TreeMap) FirstItem() *MapItem {
-	mi := m.tree.Min()
-	if mi == nil {
+	m.RLock()
+	defer m.RUnlock()
+	n := m.tree.Min()
+	if n == nil {
 		return nil
 	}
-	return mi.(*MapItem)
+	return &MapItem{Key: n.key, Value: n.value}
 }
 
 func (m *TreeMap) LastItem() *MapItem {
-	mi := m.tree.Max()
-	if mi == nil {
+	m.RLock()
+	defer m.RUnlock()
+	n := m.tree.Max()
+	if n == nil {
 		return nil
 	}
-	return mi.(*MapItem)
+	return &MapItem{Key: n.key, Value: n.value}
 }
 
 func (m *TreeMap) Get(key interface{}, defaultValue ...interface{}) (interface{}, bool) {
@@ -91,7 +95,7 @@ func (m *TreeMap) Put(key interface{}, value interface{}) bool {
 	m.Lock()
 	defer m.Unlock()
 	_, exist := m.mm[key]
-	m.tree.Insert(Item(&MapItem{Key: key, Value: value}))
+	m.tree.Insert(key, value)
 	m.mm[key] = value
 	return !exist
 }
@@ -101,7 +105,7 @@ func (m *TreeMap) Delete(key interface{}) (didDeleted bool) {
 	defer m.Unlock()
 	_, didDeleted = m.mm[key]
 	if didDeleted {
-		m.tree.Delete(Item(key))
+		m.tree.Delete(key)
 		delete(m.mm, key)
 	}
 	return
@@ -110,7 +114,7 @@ func (m *TreeMap) Delete(key interface{}) (didDeleted bool) {
 func (m *TreeMap) Clear() {
 	m.Lock()
 	defer m.Unlock()
-	m.tree = NewRedBlackTree(MapItemCompare)
+	m.tree = newRedBlackTree[interface{}, interface{}](KeyCompare)
 	m.mm = map[interface{}]interface{}{}
 }
 
@@ -124,12 +128,10 @@ func (m *TreeMap) Keys() []interface{} {
 	m.RLock()
 	defer m.RUnlock()
 	keys := []interface{}{}
-	m.tree.VisitAscend(m.tree.Min(), func(i Item) bool {
-		if mi, ok := i.(*MapItem); ok {
-			keys = append(keys, mi.Key)
-		}
+	m.fetch(func(key, value interface{}) bool {
+		keys = append(keys, key)
 		return true
-	})
+	}, false)
 	return keys
 }
 
@@ -137,12 +139,10 @@ func (m *TreeMap) Values() []interface{} {
 	m.RLock()
 	defer m.RUnlock()
 	vals := []interface{}{}
-	m.tree.VisitAscend(m.tree.Min(), func(i Item) bool {
-		if mi, ok := i.(*MapItem); ok {
-			vals = append(vals, mi.Value)
-		}
+	m.fetch(func(key, value interface{}) bool {
+		vals = append(vals, value)
 		return true
-	})
+	}, false)
 	return vals
 }
 
@@ -159,61 +159,128 @@ func (m *TreeMap) FetchReverse(p func(key interface{}, value interface{}) bool)
 }
 
 func (m *TreeMap) fetch(p func(key interface{}, value interface{}) bool, reverse bool) {
-	if len(m.mm) == 0 {
-		return
-	}
-	if reverse {
-		m.tree.VisitDescend(m.tree.Max(), func(i Item) bool {
-			if mi, ok := i.(*MapItem); ok {
-				return p(mi.Key, mi.Value)
-			}
-			return true
-		})
-	} else {
-		m.tree.VisitAscend(m.tree.Min(), func(i Item) bool {
-			if mi, ok := i.(*MapItem); ok {
-				return p(mi.Key, mi.Value)
-			}
-			return true
-		})
-	}
+	m.tree.Each(reverse, func(n *redBlackNode[interface{}, interface{}]) bool {
+		return p(n.key, n.value)
+	})
 }
 
 func (m *TreeMap) FetchRange(from interface{}, to interface{}, p func(key interface{}, value interface{}) bool, reverse bool) {
 	m.RLock()
 	defer m.RUnlock()
-	if len(m.mm) == 0 {
-		return
-	}
 	if reverse {
+		visit := func(n *redBlackNode[interface{}, interface{}]) bool {
+			if from != nil && m.tree.compare(n.key, from) < 0 {
+				return false
+			}
+			return p(n.key, n.value)
+		}
 		if to == nil {
-			to = m.tree.Max()
+			m.tree.Each(true, visit)
+		} else {
+			m.tree.VisitDescend(to, visit)
 		}
-		m.tree.VisitDescend(to, func(i Item) bool {
-			if from != nil && m.tree.compare(i, from) < 0 {
+	} else {
+		visit := func(n *redBlackNode[interface{}, interface{}]) bool {
+			if to != nil && m.tree.compare(n.key, to) > 0 {
 				return false
 			}
-			if mi, ok := i.(*MapItem); ok {
-				return p(mi.Key, mi.Value)
-			}
-			return true
-		})
-	} else {
+			return p(n.key, n.value)
+		}
 		if from == nil {
-			from = m.tree.Min()
+			m.tree.Each(false, visit)
+		} else {
+			m.tree.VisitAscend(from, visit)
 		}
-		m.tree.VisitAscend(from, func(i Item) bool {
-			if to != nil && m.tree.compare(i, to) > 0 {
-				return false
-			}
-			if mi, ok := i.(*MapItem); ok {
-				return p(mi.Key, mi.Value)
-			}
-			return true
-		})
 	}
 }
 
+func (m *TreeMap) item(n *redBlackNode[interface{}, interface{}]) *MapItem {
+	if n == nil {
+		return nil
+	}
+	return &MapItem{Key: n.key, Value: n.value}
+}
+
+func (m *TreeMap) Floor(key interface{}) *MapItem {
+	m.RLock()
+	defer m.RUnlock()
+	return m.item(m.tree.Floor(key, true))
+}
+
+func (m *TreeMap) Ceiling(key interface{}) *MapItem {
+	m.RLock()
+	defer m.RUnlock()
+	return m.item(m.tree.Ceiling(key, true))
+}
+
+func (m *TreeMap) Lower(key interface{}) *MapItem {
+	m.RLock()
+	defer m.RUnlock()
+	return m.item(m.tree.Floor(key, false))
+}
+
+func (m *TreeMap) Higher(key interface{}) *MapItem {
+	m.RLock()
+	defer m.RUnlock()
+	return m.item(m.tree.Ceiling(key, false))
+}
+
+func (m *TreeMap) Rank(key interface{}) int {
+	m.RLock()
+	defer m.RUnlock()
+	return m.tree.Rank(key)
+}
+
+func (m *TreeMap) Select(i int) *MapItem {
+	m.RLock()
+	defer m.RUnlock()
+	return m.item(m.tree.Select(i))
+}
+
+func (m *TreeMap) PopFirst() *MapItem {
+	m.Lock()
+	defer m.Unlock()
+	return m.pop(m.tree.Min())
+}
+
+func (m *TreeMap) PopLast() *MapItem {
+	m.Lock()
+	defer m.Unlock()
+	return m.pop(m.tree.Max())
+}
+
+func (m *TreeMap) pop(n *redBlackNode[interface{}, interface{}]) *MapItem {
+	mi := m.item(n)
+	if mi != nil {
+		m.tree.Delete(mi.Key)
+		delete(m.mm, mi.Key)
+	}
+	return mi
+}
+
+func (m *TreeMap) DeleteRange(from interface{}, to interface{}) int {
+	m.Lock()
+	defer m.Unlock()
+	keys := []interface{}{}
+	visit := func(n *redBlackNode[interface{}, interface{}]) bool {
+		if to != nil && m.tree.compare(n.key, to) > 0 {
+			return false
+		}
+		keys = append(keys, n.key)
+		return true
+	}
+	if from == nil {
+		m.tree.Each(false, visit)
+	} else {
+		m.tree.VisitAscend(from, visit)
+	}
+	for _, key := range keys {
+		m.tree.Delete(key)
+		delete(m.mm, key)
+	}
+	return len(keys)
+}
+
 func (m *TreeMap) UnmarshalJSON(bs []byte) (err error) {
 	err = UnmarshalJSON(m, bs)
 	return
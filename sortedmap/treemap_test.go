@@ -0,0 +1,57 @@
+package sortedmap_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wecisecode/util/sortedmap"
+)
+
+// 覆盖已有 key 后遍历及首尾项返回新值
+func TestTreeMapPutReplace(t *testing.T) {
+	m := sortedmap.NewTreeMap()
+	assert.True(t, m.Put("a", 1))
+	assert.True(t, m.Put("b", 1))
+	assert.False(t, m.Put("a", 2))
+	assert.False(t, m.Put("b", 2))
+	values := []interface{}{}
+	m.FetchRange(nil, nil, func(key interface{}, value interface{}) bool {
+		values = append(values, value)
+		return true
+	}, false)
+	assert.Equal(t, []interface{}{2, 2}, values)
+	assert.Equal(t, 2, m.FirstItem().Value)
+	assert.Equal(t, 2, m.LastItem().Value)
+}
+
+func TestRedBlackTree(t *testing.T) {
+	tree := sortedmap.NewRedBlackTree(sortedmap.KeyCompare)
+	assert.Nil(t, tree.Min())
+	for _, k := range []int{3, 1, 4, 5, 9, 2, 6} {
+		assert.True(t, tree.Insert(k))
+	}
+	assert.False(t, tree.Insert(4))
+	assert.Equal(t, 7, tree.Size())
+	assert.Equal(t, 1, tree.Min())
+	assert.Equal(t, 9, tree.Max())
+	item, ok := tree.Search(5)
+	assert.True(t, ok)
+	assert.Equal(t, 5, item)
+	assert.True(t, tree.Delete(5))
+	assert.False(t, tree.Delete(5))
+	_, ok = tree.Search(5)
+	assert.False(t, ok)
+
+	items := []sortedmap.Item{}
+	tree.VisitAscend(3, func(i sortedmap.Item) bool {
+		items = append(items, i)
+		return true
+	})
+	assert.Equal(t, []sortedmap.Item{3, 4, 6, 9}, items)
+	items = items[:0]
+	tree.VisitDescend(4, func(i sortedmap.Item) bool {
+		items = append(items, i)
+		return len(items) < 3
+	})
+	assert.Equal(t, []sortedmap.Item{4, 3, 2}, items)
+}
@@ -0,0 +1,272 @@
+package sortedmap
+
+import (
+	"cmp"
+	"sync"
+)
+
+// 有序 map 中的键值对
+type Entry[K any, V any] struct {
+	Key   K
+	Value V
+}
+
+// 类型安全的红黑树有序 map
+type TreeMapOf[K any, V any] struct {
+	sync.RWMutex
+	tree *redBlackTree[K, V]
+}
+
+// 使用 cmp.Compare 比较 key
+func NewTreeMapOf[K cmp.Ordered, V any]() *TreeMapOf[K, V] {
+	return NewTreeMapFunc[K, V](cmp.Compare[K])
+}
+
+// 使用指定的比较函数，a < b 返回负数，a == b 返回 0，a > b 返回正数
+func NewTreeMapFunc[K any, V any](compare func(a, b K) int) *TreeMapOf[K, V] {
+	return &TreeMapOf[K, V]{tree: newRedBlackTree[K, V](compare)}
+}
+
+func (m *TreeMapOf[K, V]) Copy() *TreeMapOf[K, V] {
+	m.RLock()
+	defer m.RUnlock()
+	sm := NewTreeMapFunc[K, V](m.tree.compare)
+	m.tree.Each(false, func(n *redBlackNode[K, V]) bool {
+		sm.tree.Insert(n.key, n.value)
+		return true
+	})
+	return sm
+}
+
+// 为空时返回 nil
+func (m *TreeMapOf[K, V]) FirstItem() *Entry[K, V] {
+	m.RLock()
+	defer m.RUnlock()
+	return m.tree.Min().entry()
+}
+
+// 为空时返回 nil
+func (m *TreeMapOf[K, V]) LastItem() *Entry[K, V] {
+	m.RLock()
+	defer m.RUnlock()
+	return m.tree.Max().entry()
+}
+
+func (n *redBlackNode[K, V]) entry() *Entry[K, V] {
+	if n == nil {
+		return nil
+	}
+	return &Entry[K, V]{Key: n.key, Value: n.value}
+}
+
+func (m *TreeMapOf[K, V]) Get(key K, defaultValue ...V) (V, bool) {
+	m.RLock()
+	defer m.RUnlock()
+	if n := m.tree.Search(key); n != nil {
+		return n.value, true
+	}
+	if len(defaultValue) > 0 {
+		return defaultValue[0], false
+	}
+	var v V
+	return v, false
+}
+
+func (m *TreeMapOf[K, V]) GetValue(key K, defaultValue ...V) V {
+	v, _ := m.Get(key, defaultValue...)
+	return v
+}
+
+func (m *TreeMapOf[K, V]) Has(key K) bool {
+	m.RLock()
+	defer m.RUnlock()
+	return m.tree.Search(key) != nil
+}
+
+// key 不存在时返回 true，否则替换原值并返回 false
+func (m *TreeMapOf[K, V]) Put(key K, value V) bool {
+	m.Lock()
+	defer m.Unlock()
+	return m.tree.Insert(key, value)
+}
+
+func (m *TreeMapOf[K, V]) Delete(key K) bool {
+	m.Lock()
+	defer m.Unlock()
+	return m.tree.Delete(key)
+}
+
+func (m *TreeMapOf[K, V]) Clear() {
+	m.Lock()
+	defer m.Unlock()
+	m.tree = newRedBlackTree[K, V](m.tree.compare)
+}
+
+func (m *TreeMapOf[K, V]) Len() int {
+	m.RLock()
+	defer m.RUnlock()
+	return m.tree.Size()
+}
+
+func (m *TreeMapOf[K, V]) Keys() []K {
+	m.RLock()
+	defer m.RUnlock()
+	keys := make([]K, 0, m.tree.Size())
+	m.tree.Each(false, func(n *redBlackNode[K, V]) bool {
+		keys = append(keys, n.key)
+		return true
+	})
+	return keys
+}
+
+func (m *TreeMapOf[K, V]) Values() []V {
+	m.RLock()
+	defer m.RUnlock()
+	vals := make([]V, 0, m.tree.Size())
+	m.tree.Each(false, func(n *redBlackNode[K, V]) bool {
+		vals = append(vals, n.value)
+		return true
+	})
+	return vals
+}
+
+// 按 key 升序遍历，p 返回 false 时结束，p 中不能修改 map
+func (m *TreeMapOf[K, V]) Fetch(p func(key K, value V) bool) {
+	m.RLock()
+	defer m.RUnlock()
+	m.tree.Each(false, func(n *redBlackNode[K, V]) bool {
+		return p(n.key, n.value)
+	})
+}
+
+// 按 key 降序遍历，p 返回 false 时结束，p 中不能修改 map
+func (m *TreeMapOf[K, V]) FetchReverse(p func(key K, value V) bool) {
+	m.RLock()
+	defer m.RUnlock()
+	m.tree.Each(true, func(n *redBlackNode[K, V]) bool {
+		return p(n.key, n.value)
+	})
+}
+
+// 遍历 from 到 to 之间的数据，包括 from 和 to，from 或 to 为 nil 时不限制
+func (m *TreeMapOf[K, V]) FetchRange(from, to *K, p func(key K, value V) bool, reverse bool) {
+	m.RLock()
+	defer m.RUnlock()
+	if reverse {
+		visit := func(n *redBlackNode[K, V]) bool {
+			if from != nil && m.tree.compare(n.key, *from) < 0 {
+				return false
+			}
+			return p(n.key, n.value)
+		}
+		if to == nil {
+			m.tree.Each(true, visit)
+		} else {
+			m.tree.VisitDescend(*to, visit)
+		}
+	} else {
+		visit := func(n *redBlackNode[K, V]) bool {
+			if to != nil && m.tree.compare(n.key, *to) > 0 {
+				return false
+			}
+			return p(n.key, n.value)
+		}
+		if from == nil {
+			m.tree.Each(false, visit)
+		} else {
+			m.tree.VisitAscend(*from, visit)
+		}
+	}
+}
+
+// 小于等于 key 的最大项，不存在时返回 nil
+func (m *TreeMapOf[K, V]) Floor(key K) *Entry[K, V] {
+	m.RLock()
+	defer m.RUnlock()
+	return m.tree.Floor(key, true).entry()
+}
+
+// 大于等于 key 的最小项，不存在时返回 nil
+func (m *TreeMapOf[K, V]) Ceiling(key K) *Entry[K, V] {
+	m.RLock()
+	defer m.RUnlock()
+	return m.tree.Ceiling(key, true).entry()
+}
+
+// 小于 key 的最大项，不存在时返回 nil
+func (m *TreeMapOf[K, V]) Lower(key K) *Entry[K, V] {
+	m.RLock()
+	defer m.RUnlock()
+	return m.tree.Floor(key, false).entry()
+}
+
+// 大于 key 的最小项，不存在时返回 nil
+func (m *TreeMapOf[K, V]) Higher(key K) *Entry[K, V] {
+	m.RLock()
+	defer m.RUnlock()
+	return m.tree.Ceiling(key, false).entry()
+}
+
+// 小于 key 的项数
+func (m *TreeMapOf[K, V]) Rank(key K) int {
+	m.RLock()
+	defer m.RUnlock()
+	return m.tree.Rank(key)
+}
+
+// 按顺序的第 i 项，从 0 开始，超出范围时返回 nil
+func (m *TreeMapOf[K, V]) Select(i int) *Entry[K, V] {
+	m.RLock()
+	defer m.RUnlock()
+	return m.tree.Select(i).entry()
+}
+
+// 删除并返回第一项，为空时返回 nil
+func (m *TreeMapOf[K, V]) PopFirst() *Entry[K, V] {
+	m.Lock()
+	defer m.Unlock()
+	e := m.tree.Min().entry()
+	if e != nil {
+		m.tree.Delete(e.Key)
+	}
+	return e
+}
+
+// 删除并返回最后一项，为空时返回 nil
+func (m *TreeMapOf[K, V]) PopLast() *Entry[K, V] {
+	m.Lock()
+	defer m.Unlock()
+	e := m.tree.Max().entry()
+	if e != nil {
+		m.tree.Delete(e.Key)
+	}
+	return e
+}
+
+// 删除 from 到 to 之间的项，包括 from 和 to，from 或 to 为 nil 时不限制，返回删除的项数
+func (m *TreeMapOf[K, V]) DeleteRange(from, to *K) int {
+	m.Lock()
+	defer m.Unlock()
+	if from == nil && to == nil {
+		n := m.tree.Size()
+		m.tree = newRedBlackTree[K, V](m.tree.compare)
+		return n
+	}
+	keys := []K{}
+	visit := func(n *redBlackNode[K, V]) bool {
+		if to != nil && m.tree.compare(n.key, *to) > 0 {
+			return false
+		}
+		keys = append(keys, n.key)
+		return true
+	}
+	if from == nil {
+		m.tree.Each(false, visit)
+	} else {
+		m.tree.VisitAscend(*from, visit)
+	}
+	for _, key := range keys {
+		m.tree.Delete(key)
+	}
+	return len(keys)
+}